@@ -0,0 +1,101 @@
+// Package breach checks passwords against a list of SHA-1 hashes of passwords
+// known from breaches. Lookups go by the first five hex characters of the
+// hash, k-anonymity style, so the list can be served locally from a file or
+// by a range service without ever holding a password or its full hash.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Length of the hash prefix a range is looked up by
+const PrefixLength = 5
+
+// Source of hash suffixes sharing a prefix
+type Ranger interface {
+	Range(prefix string) ([]string, error)
+}
+
+// List used by the handlers, replaced in main and in tests
+var Default Ranger = List{}
+
+// Breached hashes kept in memory, indexed by prefix. Meant for tests and
+// small lists, large ones are searched on disk with SortedFile
+type List map[string][]string
+
+// Reads a hash list with one uppercase or lowercase SHA-1 hash per line,
+// optionally followed by ":count" as in the Pwned Passwords downloads.
+// Blank lines and lines starting with # are skipped
+func Parse(r io.Reader) (List, error) {
+	list := List{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		prefix := hash[:PrefixLength]
+		list[prefix] = append(list[prefix], hash[PrefixLength:])
+	}
+	return list, scanner.Err()
+}
+
+// Uppercase hash of a "hash[:count]" line
+func parseLine(text string) (string, error) {
+	hash, _, _ := strings.Cut(text, ":")
+	hash = strings.ToUpper(hash)
+	if len(hash) != sha1.Size*2 {
+		return "", errNotAHash
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", errNotAHash
+	}
+	return hash, nil
+}
+
+var errNotAHash = errors.New("not a SHA-1 hash")
+
+// Loads the list named by BREACHED_PASSWORDS_FILE. Without one the check
+// finds nothing, so it never blocks a password. A list that is named but can
+// not be read is an error, the check is not quietly turned off
+func FromEnv() (Ranger, error) {
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		log.Printf("BREACHED_PASSWORDS_FILE not set, passwords are not checked against breaches")
+		return List{}, nil
+	}
+	return OpenSorted(path)
+}
+
+func (l List) Range(prefix string) ([]string, error) {
+	return l[strings.ToUpper(prefix)], nil
+}
+
+// Whether the password's hash is in the range its prefix names
+func Contains(r Ranger, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := r.Range(hash[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if strings.EqualFold(suffix, hash[PrefixLength:]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,161 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// SHA-1 OF "password" AND OF "123456"
+const sample = `# sample
+5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+7c4a8d09ca3762af61e59520943dc26494f8941b
+
+`
+
+func TestParseAndContains(t *testing.T) {
+	list, err := Parse(strings.NewReader(sample))
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, []string{"1E4C9B93F3F0682250B6CF8331B7EE68FD8"}, list["5BAA6"])
+
+	for _, password := range []string{"password", "123456"} {
+		found, err := Contains(list, password)
+		assert.NoError(t, err)
+		assert.True(t, found, password)
+	}
+
+	found, _ := Contains(list, "correct horse battery staple")
+	assert.False(t, found)
+}
+
+func TestParse_RejectsMalformedLines(t *testing.T) {
+	_, err := Parse(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\nnot-a-hash\n"))
+	assert.EqualError(t, err, "line 2: not a SHA-1 hash")
+
+	_, err = Parse(strings.NewReader("ZZAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\n"))
+	assert.Error(t, err)
+}
+
+type failingRanger struct{}
+
+func (failingRanger) Range(string) ([]string, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestContains_OnlySendsThePrefix(t *testing.T) {
+	var asked []string
+	ranger := rangerFunc(func(prefix string) ([]string, error) {
+		asked = append(asked, prefix)
+		return nil, nil
+	})
+	Contains(ranger, "password")
+	assert.Equal(t, []string{"5BAA6"}, asked)
+
+	_, err := Contains(failingRanger{}, "password")
+	assert.Error(t, err)
+}
+
+type rangerFunc func(string) ([]string, error)
+
+func (f rangerFunc) Range(prefix string) ([]string, error) {
+	return f(prefix)
+}
+
+// WRITES THE HASHES OF THE PASSWORDS, SORTED, AS THE DOWNLOADER DOES
+func sortedList(t *testing.T, passwords ...string) string {
+	var lines []string
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, fmt.Sprintf("%X:%d", sum, i+1))
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+	return path
+}
+
+func TestSortedFile_FindsEveryRange(t *testing.T) {
+	var passwords []string
+	for i := 0; i < 200; i++ {
+		passwords = append(passwords, fmt.Sprintf("password%d", i))
+	}
+	list, err := OpenSorted(sortedList(t, passwords...))
+	assert.NoError(t, err)
+	defer list.Close()
+
+	for _, password := range passwords {
+		found, err := Contains(list, password)
+		assert.NoError(t, err)
+		assert.True(t, found, password)
+	}
+	for _, password := range []string{"password200", "correct horse battery staple"} {
+		found, err := Contains(list, password)
+		assert.NoError(t, err)
+		assert.False(t, found, password)
+	}
+
+	// PREFIXES BEFORE THE FIRST LINE AND AFTER THE LAST ONE
+	for _, prefix := range []string{"00000", "fffff"} {
+		suffixes, err := list.Range(prefix)
+		assert.NoError(t, err)
+		assert.Empty(t, suffixes)
+	}
+}
+
+func TestSortedFile_SharedPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	content := "5BAA60000000000000000000000000000000000A\n" +
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n" +
+		"5BAA6FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n" +
+		"5BAA70000000000000000000000000000000000A:1"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	list, err := OpenSorted(path)
+	assert.NoError(t, err)
+	defer list.Close()
+
+	suffixes, err := list.Range("5baa6")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0000000000000000000000000000000000A", "1E4C9B93F3F0682250B6CF8331B7EE68FD8", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"}, suffixes)
+}
+
+func TestOpenSorted_RefusesUnusableFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := OpenSorted(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.txt")
+	assert.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = OpenSorted(empty)
+	assert.ErrorContains(t, err, "empty hash list")
+
+	garbage := filepath.Join(dir, "garbage.txt")
+	assert.NoError(t, os.WriteFile(garbage, []byte("<html>not found</html>\n"), 0o600))
+	_, err = OpenSorted(garbage)
+	assert.ErrorContains(t, err, "not a SHA-1 hash")
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("BREACHED_PASSWORDS_FILE", "")
+	ranger, err := FromEnv()
+	assert.NoError(t, err)
+	found, _ := Contains(ranger, "password")
+	assert.False(t, found)
+
+	t.Setenv("BREACHED_PASSWORDS_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	_, err = FromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("BREACHED_PASSWORDS_FILE", sortedList(t, "password"))
+	ranger, err = FromEnv()
+	assert.NoError(t, err)
+	found, _ = Contains(ranger, "password")
+	assert.True(t, found)
+}
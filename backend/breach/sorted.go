@@ -0,0 +1,127 @@
+package breach
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Hash list on disk sorted by hash, one "hash[:count]" line each, as the
+// Pwned Passwords downloader writes it. Ranges are found by binary search
+// so the list, tens of gigabytes in full, is never loaded
+type SortedFile struct {
+	file *os.File
+	size int64
+}
+
+// Opens a sorted hash list, refusing files that are empty or do not start
+// with a hash
+func OpenSorted(path string) (*SortedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s: empty hash list", path)
+	}
+
+	s := &SortedFile{file: file, size: info.Size()}
+	if _, _, err := s.lineFrom(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *SortedFile) Close() error {
+	return s.file.Close()
+}
+
+func (s *SortedFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+
+	// FIRST OFFSET WHOSE LINE IS NOT BEFORE THE PREFIX
+	low, high := int64(0), s.size
+	for low < high {
+		mid := low + (high-low)/2
+		_, hash, err := s.lineFrom(mid)
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" && hash[:PrefixLength] < prefix {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+
+	start, _, err := s.lineFrom(low)
+	if err != nil {
+		return nil, err
+	}
+	var suffixes []string
+	scanner := bufio.NewScanner(io.NewSectionReader(s.file, start, s.size-start))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		hash, err := parseLine(text)
+		if err != nil {
+			return nil, err
+		}
+		if hash[:PrefixLength] != prefix {
+			break
+		}
+		suffixes = append(suffixes, hash[PrefixLength:])
+	}
+	return suffixes, scanner.Err()
+}
+
+// First line starting at or after the offset, with the hash on it. The hash
+// is empty past the last line
+func (s *SortedFile) lineFrom(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// A LINE STARTS AT THE OFFSET ONLY IF A NEWLINE ENDS THE ONE BEFORE
+		start = offset - 1
+	}
+	reader := bufio.NewReader(io.NewSectionReader(s.file, start, s.size-start))
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return s.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, "", err
+		}
+		if line := strings.TrimSpace(text); line != "" {
+			hash, parseErr := parseLine(line)
+			if parseErr != nil {
+				return 0, "", fmt.Errorf("byte %d: %w", start, parseErr)
+			}
+			return start, hash, nil
+		}
+		if err != nil {
+			return s.size, "", nil
+		}
+		start += int64(len(text))
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/search"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -40,19 +44,255 @@ func ConnectDB() {
 		log.Fatalf("Failed to ping DB: %v", err)
 	}
 
+	// CONVERTING NUMERIC ISBN COLUMNS TO ISBN-13 STRINGS BEFORE THE SCHEMA IS SYNCED
+	if err := migrateISBNColumns(DB); err != nil {
+		log.Fatalf("Failed to migrate ISBN columns: %v", err)
+	}
+
 	// Database migration
 	err = DB.AutoMigrate(
 		&models.Library{},
+		&models.Role{},
+		&models.RolePermission{},
 		&models.User{},
+		&models.Invitation{},
+		&models.APIKey{},
+		&models.APIKeyScope{},
+		&models.SSOConfig{},
+		&models.UserIdentity{},
+		&models.SSOLogin{},
+		&models.SigningKey{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordReset{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.MFAChallenge{},
+		&models.LoginThrottle{},
+		&models.PasswordPolicy{},
+		&models.PasswordHistory{},
 		&models.Books{},
+		&models.BookItem{},
+		&models.BookSubject{},
 		&models.IssueRegistry{},
 		&models.RequestEvents{},
+		&models.RequestTransition{},
+		&models.Hold{},
+		&models.FineEntry{},
+		&models.CirculationPolicy{},
+		&models.AuditEntry{},
 	)
 
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// FULL-TEXT INDEX OF THE CATALOGUE
+	if err := search.For(DB).Migrate(DB); err != nil {
+		log.Fatalf("Failed to migrate search index: %v", err)
+	}
+
+	// THE AUDIT LOG REFUSES CHANGES IN THE DATABASE TOO, NOT ONLY THROUGH GORM
+	if err := ProtectAuditLog(DB); err != nil {
+		log.Fatalf("Failed to protect the audit log: %v", err)
+	}
+
+	// RECREATING CHECK CONSTRAINTS THAT WERE WIDENED AFTER THE TABLE WAS CREATED
+	if DB.Migrator().HasConstraint(&models.RequestEvents{}, "chk_request_events_request_type") {
+		if err := DB.Migrator().DropConstraint(&models.RequestEvents{}, "chk_request_events_request_type"); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		if err := DB.Migrator().CreateConstraint(&models.RequestEvents{}, "chk_request_events_request_type"); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	// GIVING LIBRARIES FROM BEFORE CIRCULATION POLICIES THEIR DEFAULT POLICY
+	if err := migrateCirculationPolicies(DB); err != nil {
+		log.Fatalf("Failed to migrate circulation policies: %v", err)
+	}
+
+	// GIVING BOOKS FROM BEFORE PER-COPY INVENTORY THEIR ITEMS
+	if err := migrateBookItems(DB); err != nil {
+		log.Fatalf("Failed to migrate book items: %v", err)
+	}
+
 	log.Println("Successfully connected to Postgres database!")
 
 }
+
+// Triggers that reject every UPDATE, DELETE and TRUNCATE of audit_entries, so
+// raw SQL and code skipping the model hooks can not rewrite the log either
+func ProtectAuditLog(db *gorm.DB) error {
+	statements := []string{
+		"CREATE TRIGGER IF NOT EXISTS audit_entries_no_update BEFORE UPDATE ON audit_entries " +
+			"BEGIN SELECT RAISE(ABORT, 'audit entries can not be changed'); END",
+		"CREATE TRIGGER IF NOT EXISTS audit_entries_no_delete BEFORE DELETE ON audit_entries " +
+			"BEGIN SELECT RAISE(ABORT, 'audit entries can not be changed'); END",
+	}
+	if db.Dialector.Name() == "postgres" {
+		statements = []string{
+			`CREATE OR REPLACE FUNCTION audit_entries_immutable() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit entries can not be changed';
+			END
+			$$ LANGUAGE plpgsql`,
+			"DROP TRIGGER IF EXISTS audit_entries_immutable ON audit_entries",
+			"CREATE TRIGGER audit_entries_immutable BEFORE UPDATE OR DELETE ON audit_entries " +
+				"FOR EACH ROW EXECUTE FUNCTION audit_entries_immutable()",
+			// TRUNCATE SKIPS ROW TRIGGERS
+			"DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries",
+			"CREATE TRIGGER audit_entries_no_truncate BEFORE TRUNCATE ON audit_entries " +
+				"FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_immutable()",
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Creates the default policy of every library that lacks one
+func migrateCirculationPolicies(db *gorm.DB) error {
+	var libraries []models.Library
+	if err := db.Find(&libraries).Error; err != nil {
+		return err
+	}
+
+	for _, lib := range libraries {
+		var count int64
+		db.Model(&models.CirculationPolicy{}).Where("lib_id = ? AND category = '' AND reader_type = ''", lib.LibID).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		policy := models.DefaultCirculationPolicy(lib.LibID)
+		if err := db.Create(&policy).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates items for books that only have copy counters and links every open
+// loan to one of the copies marked as on loan
+func migrateBookItems(db *gorm.DB) error {
+	var books []models.Books
+	if err := db.Find(&books).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, book := range books {
+			if err := models.CreateItemsForCounters(tx, book); err != nil {
+				return err
+			}
+		}
+
+		var loans []models.IssueRegistry
+		if err := tx.Where("status = ? AND item_id IS NULL", "issued").Find(&loans).Error; err != nil {
+			return err
+		}
+		for _, loan := range loans {
+			var item models.BookItem
+			err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", loan.ISBN, loan.LibID, "on_loan").
+				Where("item_id NOT IN (?)", tx.Model(&models.IssueRegistry{}).Select("item_id").Where("status = ? AND item_id IS NOT NULL", "issued")).
+				Order("item_id ASC").First(&item).Error
+			if err != nil {
+				continue
+			}
+			if err := tx.Model(&loan).Update("item_id", item.ItemID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Tables and columns holding an ISBN, with the relation tying them to books
+var isbnColumns = []struct {
+	Model    interface{}
+	Table    string
+	Column   string
+	Relation string
+}{
+	{&models.Books{}, "books", "isbn", ""},
+	{&models.BookItem{}, "book_items", "isbn", "Book"},
+	{&models.IssueRegistry{}, "issue_registries", "isbn", "Book"},
+	{&models.RequestEvents{}, "request_events", "book_id", "Book"},
+	{&models.Hold{}, "holds", "isbn", "Book"},
+}
+
+// ISBNs used to be stored as integers, losing leading zeros. Every column is
+// turned into a string, the ISBN-10 zeros are restored and the value is
+// converted to ISBN-13. Numbers that are not valid ISBNs are kept as they are
+func migrateISBNColumns(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Books{}) {
+		return nil
+	}
+	columnTypes, err := db.Migrator().ColumnTypes(&models.Books{})
+	if err != nil {
+		return err
+	}
+	numeric := false
+	for _, column := range columnTypes {
+		if column.Name() == "isbn" {
+			name := strings.ToLower(column.DatabaseTypeName())
+			numeric = !strings.Contains(name, "char") && !strings.Contains(name, "text")
+		}
+	}
+	if !numeric {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// FOREIGN KEYS ARE RECREATED BY AUTOMIGRATE ONCE THE TYPES MATCH AGAIN
+		for _, ref := range isbnColumns {
+			if ref.Relation != "" && tx.Migrator().HasTable(ref.Model) && tx.Migrator().HasConstraint(ref.Model, ref.Relation) {
+				if err := tx.Migrator().DropConstraint(ref.Model, ref.Relation); err != nil {
+					return err
+				}
+			}
+		}
+		for _, ref := range isbnColumns {
+			if !tx.Migrator().HasTable(ref.Model) {
+				continue
+			}
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE varchar(13) USING %s::text", ref.Table, ref.Column, ref.Column)).Error; err != nil {
+				return err
+			}
+		}
+
+		var legacy []string
+		if err := tx.Model(&models.Books{}).Distinct("isbn").Pluck("isbn", &legacy).Error; err != nil {
+			return err
+		}
+		for _, old := range legacy {
+			padded := old
+			if len(padded) < 10 {
+				padded = strings.Repeat("0", 10-len(padded)) + padded
+			}
+			isbn, err := utils.NormalizeISBN(padded)
+			if err != nil {
+				log.Printf("Keeping invalid legacy ISBN %s", old)
+				continue
+			}
+			if isbn == old {
+				continue
+			}
+			for _, ref := range isbnColumns {
+				if !tx.Migrator().HasTable(ref.Model) {
+					continue
+				}
+				if err := tx.Table(ref.Table).Where(ref.Column+" = ?", old).Update(ref.Column, isbn).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// API key as returned by the API; the key itself is only shown on creation
+func apiKeyResponse(key models.APIKey) gin.H {
+	scopes := permissions.Set{}
+	for _, s := range key.Scopes {
+		scopes[permissions.Permission(s.Permission)] = true
+	}
+	now := time.Now()
+	status := "active"
+	switch {
+	case key.RevokedAt != nil:
+		status = "revoked"
+	case !key.Active(now):
+		status = "expired"
+	}
+	return gin.H{
+		"keyID":        key.KeyID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       scopes.List(),
+		"status":       status,
+		"created_by":   key.CreatedBy,
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"revoked_at":   key.RevokedAt,
+		"created_at":   key.CreatedAt,
+	}
+}
+
+// LISTING THE API KEYS OF THE LIBRARY
+func ListAPIKeys(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	var keys []models.APIKey
+	if err := config.DB.Preload("Scopes").Where("lib_id = ?", libId).Order("created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, apiKeyResponse(key))
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": results})
+}
+
+// CREATING AN API KEY FOR A KIOSK OR AN INTEGRATION
+func CreateAPIKey(c *gin.Context) {
+	var input struct {
+		Name      string                   `json:"name" binding:"required"`
+		Scopes    []permissions.Permission `json:"scopes" binding:"required,min=1"`
+		ExpiresAt *time.Time               `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if err := validateGrants(input.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	token, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	secret := utils.APIKeyPrefix + token
+
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+	key := models.APIKey{
+		LibID:     libId.(uint),
+		Name:      input.Name,
+		Prefix:    secret[:12],
+		TokenHash: utils.HashToken(secret),
+		CreatedBy: id.(uint),
+		ExpiresAt: input.ExpiresAt,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&key).Error; err != nil {
+			return err
+		}
+		seen := permissions.Set{}
+		for _, p := range input.Scopes {
+			if seen.Has(p) {
+				continue
+			}
+			seen[p] = true
+			if err := tx.Create(&models.APIKeyScope{KeyID: key.KeyID, Permission: string(p)}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Preload("Scopes").First(&key, key.KeyID).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "api_key.create", "api_key", key.KeyID, nil, apiKeyResponse(key))
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created, store it now as it will not be shown again",
+		"key":     secret,
+		"api_key": apiKeyResponse(key),
+	})
+}
+
+// REVOKING AN API KEY
+func RevokeAPIKey(c *gin.Context) {
+	libId, _ := c.Get("libid")
+	var key models.APIKey
+	if err := config.DB.Preload("Scopes").Where("key_id = ? AND lib_id = ?", c.Param("id"), libId).First(&key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if key.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key is already revoked"})
+		return
+	}
+
+	before := apiKeyResponse(key)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "api_key.revoke", "api_key", key.KeyID, before, apiKeyResponse(key))
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
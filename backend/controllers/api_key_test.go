@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAPIKeys(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@example.com", Contact_number: "1", Role: "Owner", LibID: 1},
+		},
+	})
+
+	config.DB.Create(&models.APIKey{KeyID: 9, LibID: 2, Name: "Elsewhere", Prefix: "lms_other", TokenHash: "other", CreatedBy: 1})
+
+	owner := testutils.AsCaller(router, "/owner", testutils.Caller{ID: 1, LibID: 1, Role: "Owner"})
+	owner.GET("/api-keys", ListAPIKeys)
+	owner.POST("/api-keys", CreateAPIKey)
+	owner.DELETE("/api-keys/:id", RevokeAPIKey)
+	return router
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	router := setupAPIKeys(t)
+
+	w := postJSON(router, "/owner/api-keys", `{"name": "Scanner kiosk", "scopes": ["books:read", "books:read", "requests:approve"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	body := decode(t, w.Body.Bytes())
+	secret := body["key"].(string)
+	assert.True(t, strings.HasPrefix(secret, utils.APIKeyPrefix))
+
+	// ONLY THE HASH IS KEPT
+	var key models.APIKey
+	config.DB.Preload("Scopes").First(&key, body["api_key"].(map[string]interface{})["keyID"])
+	assert.Equal(t, utils.HashToken(secret), key.TokenHash)
+	assert.Equal(t, secret[:12], key.Prefix)
+	assert.Len(t, key.Scopes, 2)
+
+	w = getRequest(router, "/owner/api-keys")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), secret)
+	keys := decode(t, w.Body.Bytes())["api_keys"].([]interface{})
+	assert.Len(t, keys, 1)
+	assert.Equal(t, []interface{}{"books:read", "requests:approve"}, keys[0].(map[string]interface{})["scopes"])
+}
+
+func TestCreateAPIKey_Invalid(t *testing.T) {
+	router := setupAPIKeys(t)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/owner/api-keys", `{"name": "Kiosk", "scopes": []}`).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/owner/api-keys", `{"name": "Kiosk", "scopes": ["books:burn"]}`).Code)
+
+	w := postJSON(router, "/owner/api-keys", `{"name": "Kiosk", "scopes": ["api-keys:manage"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reserved to the owner")
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/owner/api-keys", `{"name": "Kiosk", "scopes": ["books:read"], "expires_at": "`+past+`"}`).Code)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	router := setupAPIKeys(t)
+	assert.Equal(t, http.StatusCreated, postJSON(router, "/owner/api-keys", `{"name": "Kiosk", "scopes": ["books:read"]}`).Code)
+
+	assert.Equal(t, http.StatusNotFound, deleteRequest(router, "/owner/api-keys/9").Code)
+	assert.Equal(t, http.StatusOK, deleteRequest(router, "/owner/api-keys/10").Code)
+	assert.Equal(t, http.StatusConflict, deleteRequest(router, "/owner/api-keys/10").Code)
+
+	keys := decode(t, getRequest(router, "/owner/api-keys").Body.Bytes())["api_keys"].([]interface{})
+	assert.Equal(t, "revoked", keys[0].(map[string]interface{})["status"])
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Fields never copied into the audit log
+var auditRedacted = map[string]bool{"password": true, "Password": true}
+
+// Fields that change on every write and say nothing about the action
+var auditIgnored = map[string]bool{"updated_at": true, "UpdatedAt": true}
+
+// JSON FIELDS OF A RECORD, WITHOUT SECRETS OR THE RELATIONS IT WAS LOADED WITH
+func auditSnapshot(record interface{}) map[string]interface{} {
+	if record == nil {
+		return nil
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+	for name, value := range fields {
+		if _, nested := value.(map[string]interface{}); nested || auditRedacted[name] {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+// FIELDS THAT DIFFER BETWEEN TWO SNAPSHOTS, AS THEY WERE AND AS THEY BECAME.
+// A MISSING SNAPSHOT KEEPS THE OTHER WHOLE, FOR CREATIONS AND DELETIONS
+func auditDiff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	if before == nil || after == nil {
+		return before, after
+	}
+
+	was, became := map[string]interface{}{}, map[string]interface{}{}
+	for name, value := range after {
+		if old, ok := before[name]; !auditIgnored[name] && (!ok || !reflect.DeepEqual(old, value)) {
+			was[name], became[name] = old, value
+		}
+	}
+	for name, old := range before {
+		if _, ok := after[name]; !ok && !auditIgnored[name] {
+			was[name], became[name] = old, nil
+		}
+	}
+	return was, became
+}
+
+// Appends what the logged in staff member did to the audit log. Callers pass
+// the transaction of the change, so neither is kept without the other
+func recordAudit(c *gin.Context, tx *gorm.DB, action, entityType string, entityID interface{}, before, after interface{}) error {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+	email, _ := c.Get("email")
+	role, _ := c.Get("role")
+
+	entry := models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+	}
+	if c.Request != nil {
+		entry.Method = c.Request.Method
+		entry.Path = c.Request.URL.Path
+		entry.IPAddress = c.ClientIP()
+		entry.UserAgent = c.Request.UserAgent()
+	}
+	entry.LibID, _ = libId.(uint)
+	entry.ActorID, _ = id.(uint)
+	entry.ActorEmail, _ = email.(string)
+	entry.ActorRole, _ = role.(string)
+	if keyId, ok := c.Get("api_key"); ok {
+		key := keyId.(uint)
+		entry.APIKeyID = &key
+	}
+	entry.Before, entry.After = auditDiff(auditSnapshot(before), auditSnapshot(after))
+	return tx.Create(&entry).Error
+}
+
+type auditFilter struct {
+	ActorID    uint   `form:"actor_id"`
+	Action     string `form:"action"`
+	EntityType string `form:"entity_type"`
+	EntityID   string `form:"entity_id"`
+	From       string `form:"from"`
+	To         string `form:"to"`
+}
+
+// Dates are whole days or RFC 3339 instants; a whole day given as the end of
+// a range includes all of it
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (f auditFilter) apply(libID uint) (*gorm.DB, error) {
+	query := config.DB.Model(&models.AuditEntry{}).Where("lib_id = ?", libID)
+	if f.ActorID != 0 {
+		query = query.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.EntityType != "" {
+		query = query.Where("entity_type = ?", f.EntityType)
+	}
+	if f.EntityID != "" {
+		query = query.Where("entity_id = ?", f.EntityID)
+	}
+	if f.From != "" {
+		from, err := parseAuditTime(f.From, false)
+		if err != nil {
+			return nil, errors.New("from must be a date or an RFC 3339 time")
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if f.To != "" {
+		to, err := parseAuditTime(f.To, true)
+		if err != nil {
+			return nil, errors.New("to must be a date or an RFC 3339 time")
+		}
+		query = query.Where("created_at < ?", to)
+	}
+	return query, nil
+}
+
+// LISTING THE AUDIT LOG OF THE LIBRARY, NEWEST FIRST
+func ListAuditLog(c *gin.Context) {
+	var input struct {
+		auditFilter
+		Page  int `form:"page" binding:"omitempty,min=1"`
+		Limit int `form:"limit" binding:"omitempty,min=1,max=200"`
+	}
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.Limit == 0 {
+		input.Limit = 50
+	}
+
+	libId, _ := c.Get("libid")
+	query, err := input.apply(libId.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.AuditEntry
+	if err := query.Order("audit_id DESC").Offset((input.Page - 1) * input.Limit).Limit(input.Limit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":     entries,
+		"total":       total,
+		"page":        input.Page,
+		"limit":       input.Limit,
+		"total_pages": (total + int64(input.Limit) - 1) / int64(input.Limit),
+	})
+}
+
+var auditCSVHeader = []string{
+	"audit_id", "created_at", "actor_id", "actor_email", "actor_role", "api_key_id",
+	"action", "entity_type", "entity_id", "before", "after",
+	"method", "path", "ip_address", "user_agent",
+}
+
+// Spreadsheets run cells starting with these as formulas
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func auditJSON(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(fields)
+	return string(raw)
+}
+
+// EXPORTING THE FILTERED AUDIT LOG AS CSV, OLDEST FIRST
+func ExportAuditLog(c *gin.Context) {
+	var filter auditFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	query, err := filter.apply(libId.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename=audit-log.csv")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(auditCSVHeader)
+
+	// THE LOG ONLY GROWS, SO IT IS STREAMED RATHER THAN LOADED WHOLE
+	var batch []models.AuditEntry
+	query.Order("audit_id ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			apiKey := ""
+			if entry.APIKeyID != nil {
+				apiKey = strconv.FormatUint(uint64(*entry.APIKeyID), 10)
+			}
+			w.Write([]string{
+				strconv.FormatUint(uint64(entry.AuditID), 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatUint(uint64(entry.ActorID), 10),
+				csvCell(entry.ActorEmail),
+				entry.ActorRole,
+				apiKey,
+				entry.Action,
+				entry.EntityType,
+				csvCell(entry.EntityID),
+				auditJSON(entry.Before),
+				auditJSON(entry.After),
+				entry.Method,
+				entry.Path,
+				entry.IPAddress,
+				csvCell(entry.UserAgent),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	})
+	w.Flush()
+}
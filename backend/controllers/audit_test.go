@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// ROUTES AS THE ADMIN (ID 2) OF LIBRARY 1, AND THE AUDIT LOG AS ITS OWNER
+func setupAudit(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}, {LibID: 2, Name: "Other Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@example.com", Contact_number: "1", Role: "Owner", LibID: 1},
+			{ID: 2, Name: "Adam", Email: "admin@example.com", Contact_number: "2", Role: "Admin", LibID: 1},
+			{ID: 3, Name: "Rita", Email: "rita@example.com", Contact_number: "3", Role: "Reader", LibID: 1},
+		},
+	})
+	admin := testutils.AsCaller(router, "/admin", testutils.Caller{ID: 2, LibID: 1, Email: "admin@example.com", Role: "Admin"})
+	admin.POST("/books/add", AddBook)
+	admin.PATCH("/books/:isbn", UpdateBook)
+	admin.DELETE("/books/:isbn", DeleteBook)
+	admin.PATCH("/users/:id", UpdateUser)
+	owner := testutils.AsCaller(router, "/owner", testutils.Caller{ID: 1, LibID: 1, Email: "owner@example.com", Role: "Owner"})
+	owner.GET("/audit", ListAuditLog)
+	owner.GET("/audit/export", ExportAuditLog)
+	return router
+}
+
+const auditedBook = `{"ISBN": "9780306406157", "title": "Go Programming", "authors": "John Doe", "publisher": "Tech Press", "version": "1st", "total_copies": 2}`
+
+func TestAuditLog_BookLifecycle(t *testing.T) {
+	router := setupAudit(t)
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/admin/books/add", auditedBook).Code)
+	assert.Equal(t, http.StatusOK, patchJSON(router, "/admin/books/9780306406157", `{"isbn": "9780306406157", "title": "Go in Practice"}`).Code)
+	assert.Equal(t, http.StatusOK, deleteRequest(router, "/admin/books/9780306406157").Code)
+
+	var entries []models.AuditEntry
+	config.DB.Order("audit_id ASC").Find(&entries)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, []string{"book.create", "book.update", "book.delete"}, []string{entries[0].Action, entries[1].Action, entries[2].Action})
+
+	created := entries[0]
+	assert.Equal(t, uint(2), created.ActorID)
+	assert.Equal(t, "admin@example.com", created.ActorEmail)
+	assert.Equal(t, "9780306406157", created.EntityID)
+	assert.Equal(t, "/admin/books/add", created.Path)
+	assert.Nil(t, created.Before)
+	assert.Equal(t, "Go Programming", created.After["title"])
+
+	// AN UPDATE KEEPS ONLY WHAT CHANGED
+	updated := entries[1]
+	assert.Equal(t, map[string]interface{}{"title": "Go Programming"}, updated.Before)
+	assert.Equal(t, map[string]interface{}{"title": "Go in Practice"}, updated.After)
+
+	// THE DELETED BOOK SURVIVES IN THE LOG
+	deleted := entries[2]
+	assert.Equal(t, "Go in Practice", deleted.Before["title"])
+	assert.Nil(t, deleted.After)
+}
+
+func TestAuditLog_NoSecrets(t *testing.T) {
+	router := setupAudit(t)
+
+	assert.Equal(t, http.StatusOK, patchJSON(router, "/admin/users/3", `{"name": "Rita R"}`).Code)
+
+	var entry models.AuditEntry
+	assert.NoError(t, config.DB.Where("action = ?", "user.update").First(&entry).Error)
+	assert.Equal(t, map[string]interface{}{"name": "Rita"}, entry.Before)
+	assert.Equal(t, map[string]interface{}{"name": "Rita R"}, entry.After)
+
+	snapshot := auditSnapshot(models.User{Name: "Rita", Password: "hash"})
+	assert.NotContains(t, snapshot, "password")
+	assert.Equal(t, "Rita", snapshot["name"])
+}
+
+func TestAuditLog_AppendOnly(t *testing.T) {
+	router := setupAudit(t)
+	postJSON(router, "/admin/books/add", auditedBook)
+
+	var entry models.AuditEntry
+	assert.NoError(t, config.DB.First(&entry).Error)
+	assert.ErrorIs(t, config.DB.Model(&entry).Update("action", "book.read").Error, models.ErrAuditImmutable)
+	assert.ErrorIs(t, config.DB.Delete(&entry).Error, models.ErrAuditImmutable)
+
+	// THE DATABASE REFUSES WHAT GETS PAST THE HOOKS
+	raw := config.DB.Session(&gorm.Session{SkipHooks: true})
+	assert.ErrorContains(t, raw.Model(&entry).Update("action", "book.read").Error, "audit entries can not be changed")
+	assert.ErrorContains(t, raw.Delete(&entry).Error, "audit entries can not be changed")
+	assert.Error(t, config.DB.Exec("DELETE FROM audit_entries").Error)
+
+	var count int64
+	config.DB.Model(&models.AuditEntry{}).Where("action = ?", "book.create").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestListAuditLog_Filters(t *testing.T) {
+	router := setupAudit(t)
+	postJSON(router, "/admin/books/add", auditedBook)
+	patchJSON(router, "/admin/users/3", `{"name": "Rita R"}`)
+	config.DB.Create(&models.AuditEntry{LibID: 2, ActorID: 9, ActorEmail: "x@example.com", ActorRole: "Owner", Action: "book.create", EntityType: "book", EntityID: "1", Method: "POST", Path: "/"})
+
+	code, body := getJSON(router, "/owner/audit")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), body["total"])
+	// NEWEST FIRST
+	assert.Equal(t, "user.update", body["entries"].([]interface{})[0].(map[string]interface{})["action"])
+
+	_, body = getJSON(router, "/owner/audit?entity_type=book&actor_id=2")
+	assert.Equal(t, float64(1), body["total"])
+	_, body = getJSON(router, "/owner/audit?action=user.update&entity_id=3")
+	assert.Equal(t, float64(1), body["total"])
+	_, body = getJSON(router, "/owner/audit?to=2000-01-01")
+	assert.Equal(t, float64(0), body["total"])
+
+	code, _ = getJSON(router, "/owner/audit?from=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestExportAuditLog(t *testing.T) {
+	router := setupAudit(t)
+	postJSON(router, "/admin/books/add", auditedBook)
+	patchJSON(router, "/admin/users/3", `{"name": "=HYPERLINK(\"http://evil\")"}`)
+
+	w := getRequest(router, "/owner/audit/export?entity_type=user")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, auditCSVHeader, rows[0])
+	assert.Equal(t, "user.update", rows[1][6])
+	assert.Equal(t, "3", rows[1][8])
+	assert.JSONEq(t, `{"name": "=HYPERLINK(\"http://evil\")"}`, rows[1][10])
+}
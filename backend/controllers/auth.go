@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"math"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
-	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -31,18 +33,30 @@ func Signup(c *gin.Context) {
 		return
 	}
 
-	// LIBRARY CREATION
+	// THE NEW LIBRARY STARTS OUT WITH THE DEFAULT PASSWORD POLICY
+	if !acceptablePassword(c, 0, nil, input.Password) {
+		return
+	}
+
+	// PASSWORD HASHING, BEFORE ANYTHING IS CREATED
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bcrypt failed to generate password!"})
+		return
+	}
+
+	// LIBRARY CREATION WITH THE DEFAULT CIRCULATION POLICY
 	library := models.Library{Name: input.LibraryName}
 	config.DB.Create(&library)
+	policy := models.DefaultCirculationPolicy(library.LibID)
+	config.DB.Create(&policy)
 
-	// PASSWORD HASHING
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	user := models.User{
 		Name:           input.Name,
 		Email:          input.Email,
 		Password:       string(hashedPassword),
 		Contact_number: input.ContactNumber,
-		Role:           "Owner",
+		Role:           permissions.Owner,
 		LibID:          library.LibID,
 	}
 	config.DB.Create(&user)
@@ -61,107 +75,74 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// CHECKING IF USER EXISTS
+	// HOLDING BACK ACCOUNTS AND CLIENTS WITH REPEATED FAILURES
+	keys := loginKeysOf(c, input.Email)
+	if wait := loginRetryAfter(config.DB, keys, time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": tooManyAttemptsMessage})
+		return
+	}
+
+	// CHECKING IF USER EXISTS, ANSWERING LIKE A WRONG PASSWORD WHEN NOT
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(input.Password))
+		recordLoginFailure(config.DB, keys, nil, time.Now())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	// PASSWORD VERIFICATION
 	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		recordLoginFailure(config.DB, keys, &user.ID, time.Now())
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
-
-	// TOKEN GENERATION
-	token, _ := utils.GenerateJWT(user.ID, user.LibID, user.Email, user.Role)
-
-	// FOR SETTING SECURE SITE
-	prodMode := os.Getenv("PROD_MODE") == "true"
-	c.SetCookie("token", token, 3600*72, "/", "localhost", prodMode, true)
-
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful"})
-}
-
-// CREATING ADMIN USER
-func CreateAdminUser(c *gin.Context) {
-	var input struct {
-		Name          string `json:"name" binding:"required"`
-		Email         string `json:"email" binding:"required"`
-		Password      string `json:"password" binding:"required"`
-		ContactNumber string `json:"contactNumber" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// DEACTIVATED ACCOUNTS ARE TOLD SO ONLY AFTER THE RIGHT PASSWORD
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
 		return
 	}
 
-	// VALIDATING OWNER USING COOKIES
-	ownerEmail, _ := c.Get("email")
-	var owner models.User
-	if err := config.DB.Where("email = ?", ownerEmail).First(&owner).Error; err != nil || owner.Role != "Owner" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	// ACCOUNTS WITH TWO-FACTOR AUTHENTICATION FINISH AT v1/auth/login/2fa
+	mfaToken, enrol, err := secondFactorChallenge(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	adminUser := models.User{
-		Name:           input.Name,
-		Email:          input.Email,
-		Password:       string(hashedPassword),
-		Contact_number: input.ContactNumber,
-		Role:           "Admin",
-		LibID:          owner.LibID,
-	}
-
-	if err := config.DB.Create(&adminUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create admin user"})
+	if mfaToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Two-factor code required",
+			"mfa_required":        true,
+			"mfa_token":           mfaToken,
+			"enrollment_required": enrol,
+		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Admin user created successfully"})
-}
-
-// CREATING READER USER
-func CreateReaderUser(c *gin.Context) {
-	var input struct {
-		Name          string `json:"name" binding:"required"`
-		Email         string `json:"email" binding:"required"`
-		Password      string `json:"password" binding:"required"`
-		ContactNumber string `json:"contactNumber" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// FAILURES ARE ONLY FORGOTTEN ONCE THE WHOLE LOGIN HAS SUCCEEDED
+	if err := clearAccountLockout(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// VALIDATING ADMIN USER USING COOKIES
-	adminEmail, _ := c.Get("email")
-	var admin models.User
-	if err := config.DB.Where("email = ?", adminEmail).First(&admin).Error; err != nil || !(admin.Role == "Admin" || admin.Role == "Owner") {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	// SHORT-LIVED ACCESS TOKEN AND THE REFRESH TOKEN OF A NEW SESSION
+	accessToken, refreshToken, err := startSession(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	sendTokens(c, accessToken, refreshToken, gin.H{"message": "Login successful"})
+}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	readerUser := models.User{
-		Name:           input.Name,
-		Email:          input.Email,
-		Password:       string(hashedPassword),
-		Contact_number: input.ContactNumber,
-		Role:           "Reader",
-		LibID:          admin.LibID,
-	}
-
-	if err := config.DB.Create(&readerUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reader user"})
-		return
-	}
+// INVITING AN ADMIN USER, WHO CHOOSES THEIR OWN PASSWORD
+func CreateAdminUser(c *gin.Context) {
+	invite(c, permissions.Admin)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Reader user created successfully"})
+// INVITING A READER USER, WHO CHOOSES THEIR OWN PASSWORD
+func CreateReaderUser(c *gin.Context) {
+	invite(c, permissions.Reader)
 }
 
 // UPDATE USER PASSWORD
@@ -192,6 +173,9 @@ func UpdatePassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong Password"})
 		return
 	}
+	if !acceptablePassword(c, user.LibID, &user, input.NewPassword) {
+		return
+	}
 
 	// NEW PASSWORD HASHING AND SAVING
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost) //; err != nil {
@@ -202,10 +186,24 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	if err := rememberPassword(config.DB, user.ID, user.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	user.Password = string(hashedPassword)
 	config.DB.Save(&user)
 
-	c.JSON(http.StatusOK, gin.H{
+	// LOGGING OUT EVERY OTHER DEVICE, THIS ONE CONTINUES IN A NEW SESSION
+	if err := revokeUserSessions(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	accessToken, refreshToken, err := startSession(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sendTokens(c, accessToken, refreshToken, gin.H{
 		"message": "Password updated successfully!",
 	})
 
@@ -213,6 +211,13 @@ func UpdatePassword(c *gin.Context) {
 
 // LOGOUT FUNCTIONALITY
 func Logout(c *gin.Context) {
-	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	// ENDING THE SESSION SO ITS ACCESS AND REFRESH TOKENS STOP WORKING
+	if sessionID, ok := currentSessionID(c); ok {
+		if err := revokeSession(config.DB, sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	clearAuthCookies(c)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -7,7 +7,6 @@ import (
 	"net/http/httptest"
 	"testing"
 
-	"github.com/gin-gonic/gin"
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 
 	
@@ -18,10 +17,7 @@ import (
 )
 
 func TestSignup(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 	router.POST("/auth/signup", Signup)
 
 	signupPayload := `{
@@ -43,21 +39,13 @@ func TestSignup(t *testing.T) {
 }
  
 func TestLogin(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Test User", Email: "test@example.com", Role: "Owner", LibID: 1},
+		},
+	})
 	router.POST("/auth/login", Login)
 
-	
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
-	user := models.User{
-		Name:     "Test User",
-		Email:    "test@example.com",
-		Password: string(hashedPassword),
-		Role:     "Owner",
-		LibID:    1,
-	}
-	config.DB.Create(&user)
-
 	loginPayload := `{"email": "test@example.com", "password": "password123"}`
 
 	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer([]byte(loginPayload)))
@@ -70,34 +58,20 @@ func TestLogin(t *testing.T) {
 }
 
 func TestCreateAdminUser(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
-
-	
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("ownerpassword"), bcrypt.DefaultCost)
-	owner := models.User{
-		Name:     "Owner User",
-		Email:    "owner@example.com",
-		Password: string(hashedPassword),
-		Role:     "Owner",
-		LibID:    1,
-	}
-	config.DB.Create(&owner)
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Owner User", Email: "owner@example.com", Password: "ownerpassword", Role: "Owner", LibID: 1},
+		},
+	})
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "owner@example.com")
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "owner@example.com"})
 
-	router.POST("/admin/create", CreateAdminUser)
+	caller.POST("/admin/create", CreateAdminUser)
 
 	adminPayload := `{
 		"name": "Admin User",
 		"email": "admin@example.com",
-		"password": "adminpassword",
 		"contactNumber": "9876543210"
 	}`
 
@@ -108,44 +82,35 @@ func TestCreateAdminUser(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Admin user created successfully")
+	assert.Contains(t, w.Body.String(), "Invitation sent")
 
 	
-	var admin models.User
-	err := config.DB.Where("email = ?", "admin@example.com").First(&admin).Error
+	var invitation models.Invitation
+	err := config.DB.Where("email = ?", "admin@example.com").First(&invitation).Error
 	assert.Nil(t, err)
-	assert.Equal(t, "Admin", admin.Role)
+	assert.Equal(t, "Admin", invitation.Role)
+
+	// THE ACCOUNT EXISTS ONCE THE INVITATION IS ACCEPTED
+	var count int64
+	config.DB.Model(&models.User{}).Where("email = ?", "admin@example.com").Count(&count)
+	assert.Equal(t, int64(0), count)
 }
  
 func TestCreateReaderUser(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
-
-	
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("adminpassword"), bcrypt.DefaultCost)
-	admin := models.User{
-		Name:     "Admin User",
-		Email:    "admin@example.com",
-		Password: string(hashedPassword),
-		Role:     "Admin",
-		LibID:    1,
-	}
-	config.DB.Create(&admin)
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Admin User", Email: "admin@example.com", Password: "adminpassword", Role: "Admin", LibID: 1},
+		},
+	})
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "admin@example.com")
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "admin@example.com"})
 
-	router.POST("/reader/create", CreateReaderUser)
+	caller.POST("/reader/create", CreateReaderUser)
 
 	readerPayload := `{
 		"name": "Reader User",
 		"email": "reader@example.com",
-		"password": "readerpassword",
 		"contactNumber": "1234567890"
 	}`
 
@@ -156,39 +121,29 @@ func TestCreateReaderUser(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Reader user created successfully")
+	assert.Contains(t, w.Body.String(), "Invitation sent")
 
 	
-	var reader models.User
-	err := config.DB.Where("email = ?", "reader@example.com").First(&reader).Error
+	var invitation models.Invitation
+	err := config.DB.Where("email = ?", "reader@example.com").First(&invitation).Error
 	assert.Nil(t, err)
-	assert.Equal(t, "Reader", reader.Role)
+	assert.Equal(t, "Reader", invitation.Role)
+
+	// THE ACCOUNT EXISTS ONCE THE INVITATION IS ACCEPTED
+	var count int64
+	config.DB.Model(&models.User{}).Where("email = ?", "reader@example.com").Count(&count)
+	assert.Equal(t, int64(0), count)
 }
  
 func TestUpdatePassword(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-	router := gin.Default()
-
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.DefaultCost)
-	user := models.User{
-		Name:     "Test User",
-		Email:    "user@example.com",
-		Password: string(hashedPassword),
-		Role:     "Reader",
-		LibID:    1,
-	}
-
-	if err := config.DB.Create(&user).Error; err != nil {
-		t.Fatalf("Failed to create test user: %v", err)
-	}
-
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "user@example.com")
-		c.Next()
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Test User", Email: "user@example.com", Password: "oldpassword", Role: "Reader", LibID: 1},
+		},
 	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "user@example.com"})
 
-	router.POST("/user/update-password", UpdatePassword)
+	caller.POST("/user/update-password", UpdatePassword)
 
 	passwordPayload := map[string]string{
 		"oldPassword": "oldpassword",
@@ -227,10 +182,7 @@ func TestUpdatePassword(t *testing.T) {
 }
  
 func TestLogout(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 	router.GET("/logout", Logout)
 
 	req, _ := http.NewRequest("GET", "/logout", nil)
@@ -242,9 +194,7 @@ func TestLogout(t *testing.T) {
 }
 
 func TestSignup_DuplicateLibrary(t *testing.T) {
-    gin.SetMode(gin.TestMode)
-    testutils.SetupTestDB()
-    router := gin.Default()
+    router := testutils.SetupRouter(testutils.Seed{})
     router.POST("/auth/signup", Signup)
 
     
@@ -279,20 +229,13 @@ func TestSignup_DuplicateLibrary(t *testing.T) {
 
 
 func TestLogin_InvalidCredentials(t *testing.T) {
-    gin.SetMode(gin.TestMode)
-    testutils.SetupTestDB()
-    router := gin.Default()
+    router := testutils.SetupRouter(testutils.Seed{
+        Users: []models.User{
+            {Email: "validuser@example.com", Password: "correctpassword", Role: "Owner", LibID: 1},
+        },
+    })
     router.POST("/auth/login", Login)
 
-    hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("correctpassword"), bcrypt.DefaultCost)
-    user := models.User{
-        Email: "validuser@example.com",
-        Password: string(hashedPassword),
-        Role:  "Owner",
-        LibID: 1,
-    }
-    config.DB.Create(&user)
-
     invalidLoginPayload := `{"email": "validuser@example.com", "password": "wrongpassword"}`
     req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer([]byte(invalidLoginPayload)))
     req.Header.Set("Content-Type", "application/json")
@@ -305,15 +248,9 @@ func TestLogin_InvalidCredentials(t *testing.T) {
 }
 
 func TestCreateAdminUser_Unauthorized(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-	router := gin.Default()
-
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "nonowner@example.com") 
-		c.Next()
-	})
-	router.POST("/admin/create", CreateAdminUser)
+	router := testutils.SetupRouter(testutils.Seed{})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "nonowner@example.com"})
+	caller.POST("/admin/create", CreateAdminUser)
 
 	adminPayload := `{
 		"name": "Admin User",
@@ -333,15 +270,9 @@ func TestCreateAdminUser_Unauthorized(t *testing.T) {
 }
 
 func TestUpdatePassword_MissingFields(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-	router := gin.Default()
-
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "user@example.com")
-		c.Next()
-	})
-	router.POST("/user/update-password", UpdatePassword)
+	router := testutils.SetupRouter(testutils.Seed{})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "user@example.com"})
+	caller.POST("/user/update-password", UpdatePassword)
 
 	payloadMissingNewPass := `{"oldPassword":"oldpassword"}`
 	req, _ := http.NewRequest("POST", "/user/update-password", bytes.NewBuffer([]byte(payloadMissingNewPass)))
@@ -3,15 +3,55 @@ package controllers
 import (
 	"fmt"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/search"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// ADDING A TITLE, OR MORE COPIES OF IT IF THE ISBN ALREADY EXISTS IN THE LIBRARY
+func upsertBook(tx *gorm.DB, book models.Books) (bool, error) {
+	var existing models.Books
+	if err := tx.Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).First(&existing).Error; err == nil {
+		if err := addItems(tx, existing.ISBN, existing.LibID, book.Total_copies); err != nil {
+			return false, err
+		}
+		return false, promoteNextHold(tx, existing.ISBN, existing.LibID)
+	}
+
+	book.Available_copies = book.Total_copies
+	return true, tx.Create(&book).Error
+}
+
+// BOOK AS STORED WITH ITS SUBJECTS, FOR THE AUDIT LOG; NIL IF THERE IS NONE
+func storedBook(tx *gorm.DB, isbn string, libID uint) *models.Books {
+	var book models.Books
+	if tx.Where("isbn = ? AND lib_id = ?", isbn, libID).First(&book).Error != nil {
+		return nil
+	}
+	book.Subjects = []string{}
+	tx.Model(&models.BookSubject{}).Where("isbn = ? AND lib_id = ?", isbn, libID).Order("subject ASC").Pluck("subject", &book.Subjects)
+	return &book
+}
+
+// UPSERTING A BOOK FOR THE LOGGED IN STAFF MEMBER, RECORDED IN THE AUDIT LOG
+func auditedUpsertBook(c *gin.Context, tx *gorm.DB, book models.Books) (bool, error) {
+	before := storedBook(tx, book.ISBN, book.LibID)
+	created, err := upsertBook(tx, book)
+	if err != nil {
+		return false, err
+	}
+	action := "book.create"
+	if !created {
+		action = "book.add_copies"
+	}
+	return created, recordAudit(c, tx, action, "book", book.ISBN, before, storedBook(tx, book.ISBN, book.LibID))
+}
+
 func AddBook(c *gin.Context) {
 	var book models.Books
 	libId, _ := c.Get("libid")
@@ -30,114 +70,212 @@ func AddBook(c *gin.Context) {
 		return
 	}
 
-	var existing models.Books
-	if err := config.DB.Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).First(&existing).Error; err == nil {
-		existing.Total_copies += book.Total_copies
-		existing.Available_copies += book.Total_copies
-		config.DB.Save(&existing)
-		c.JSON(http.StatusOK, gin.H{"message": "Book copies updated"})
+	isbn, err := utils.NormalizeISBN(book.ISBN)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN"})
+		return
+	}
+	book.ISBN = isbn
+
+	var created bool
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = auditedUpsertBook(c, tx, book)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	book.Available_copies = book.Total_copies
-	config.DB.Create(&book)
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": "Book copies updated"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book added successfully"})
 }
 
-// SEARCHING A BOOK
+// CASE INSENSITIVE MATCH, SQLITE LIKE ALREADY IGNORES CASE
+func ilike(column string) string {
+	if config.DB.Dialector.Name() == "sqlite" {
+		return column + " LIKE ?"
+	}
+	return column + " ILIKE ?"
+}
+
+var searchSortOrders = map[string]string{
+	"title":        "title ASC, isbn ASC",
+	"author":       "authors ASC, title ASC, isbn ASC",
+	"newest":       "created_at DESC, isbn ASC",
+	"availability": "available_copies DESC, title ASC, isbn ASC",
+}
+
+type searchResult struct {
+	ISBN                     string            `json:"isbn"`
+	Title                    string            `json:"title"`
+	Authors                  string            `json:"authors"`
+	Publisher                string            `json:"publisher"`
+	Version                  string            `json:"version"`
+	Category                 string            `json:"category"`
+	Description              string            `json:"description"`
+	Language                 string            `json:"language"`
+	PublicationYear          uint              `json:"publication_year"`
+	Subjects                 []string          `json:"subjects"`
+	TotalCopies              uint              `json:"total_copies"`
+	AvailableCopies          uint              `json:"available_copies"`
+	ExpectedAvailabilityDate *string           `json:"expected_availability_date,omitempty"`
+	Highlights               *search.Highlight `json:"highlights,omitempty"`
+}
+
+// SEARCHING THE CATALOGUE: FULL-TEXT QUERY RANKED BY RELEVANCE, FIELD FILTERS,
+// PAGINATION, SORTING AND AN AVAILABILITY FILTER
 func SearchBook(c *gin.Context) {
 	var input struct {
-		Title   string `json:"title"`
-		ISBN    uint   `json:"isbn"`
-		Authors string `json:"authors"`
+		catalogueFilter
+		Sort  string `form:"sort" binding:"omitempty,oneof=relevance title author newest availability"`
+		Page  int    `form:"page" binding:"omitempty,min=1"`
+		Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBindQuery(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	if input.Title == "" && input.ISBN == 0 && input.Authors == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one search field is required"})
+	if err := input.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// RELEVANCE NEEDS A FULL-TEXT QUERY TO RANK AGAINST
+	if input.Sort == "" {
+		input.Sort = "relevance"
+	}
+	if input.Sort == "relevance" && input.Query == "" {
+		input.Sort = "title"
+	}
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.Limit == 0 {
+		input.Limit = 20
+	}
 
 	libId, _ := c.Get("libid")
 
-	var book models.Books
-	query := config.DB.Where("lib_id = ?", libId)
-	// if input.Title != "" {
-	// 	query = query.Where("title ILIKE ?", "%"+input.Title+"%")
-	// }
-	if input.Title != "" {
-		if config.DB.Dialector.Name() == "sqlite" {
-			query = query.Where("title LIKE ?", "%"+input.Title+"%")
-		} else {
-			query = query.Where("title ILIKE ?", "%"+input.Title+"%")
-		}
+	engine := search.For(config.DB)
+	query, text, err := input.apply(libId.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	
-	
-	if input.ISBN != 0 {
-		query = query.Where("isbn = ?", input.ISBN)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	if input.Authors != "" {
-		query = query.Where("authors ILIKE ?", "%"+input.Authors+"%")
-	}
-
-	// EXPECTED DATE A BOOK BECOMES AVAILABLE
-	if err := query.First(&book).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-	var bookDetails struct {
-		ISBN, Available_copies             uint
-		Title, Authors, Publisher, Version string
-	}
-	bookDetails.ISBN = book.ISBN
-	bookDetails.Title = book.Title
-	bookDetails.Authors = book.Authors
-	bookDetails.Publisher = book.Publisher
-	bookDetails.Version = book.Version
-	bookDetails.Available_copies = book.Available_copies
-
-	if book.Available_copies == 0 {
-		var nextAvailable time.Time
-		if e := config.DB.Raw(`
-			SELECT expected_return_date FROM issue_registries 
-			WHERE isbn = ? AND lib_id = ? AND issue_status ILIKE 'approve' 
-			ORDER BY expected_return_date ASC LIMIT 1`, book.ISBN, libId).Scan(&nextAvailable).Error; e != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": e.Error(),
-			})
+
+	ordered := query
+	if input.Sort == "relevance" {
+		ordered = ordered.Order(engine.Rank(text)).Order(searchSortOrders["title"])
+	} else {
+		ordered = ordered.Order(searchSortOrders[input.Sort])
+	}
+
+	var books []models.Books
+	if err := ordered.Offset((input.Page - 1) * input.Limit).Limit(input.Limit).Find(&books).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// EXPECTED DATE AN UNAVAILABLE BOOK COMES BACK: ITS EARLIEST DUE LOAN
+	var unavailable []string
+	for _, book := range books {
+		if book.Available_copies == 0 {
+			unavailable = append(unavailable, book.ISBN)
+		}
+	}
+	nextAvailable := map[string]string{}
+	if len(unavailable) > 0 {
+		var loans []models.IssueRegistry
+		if err := config.DB.Where("lib_id = ? AND status = ? AND isbn IN ?", libId, "issued", unavailable).
+			Order("expected_return_date ASC").Find(&loans).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		for _, loan := range loans {
+			if _, ok := nextAvailable[loan.ISBN]; !ok {
+				nextAvailable[loan.ISBN] = loan.ExpectedReturnDate.Format("2006-01-02")
+			}
+		}
+	}
 
-		if !nextAvailable.IsZero() {
-			c.JSON(http.StatusOK, gin.H{
-				"Message":                    "Book is currently unavailable",
-				"expected_availability_date": nextAvailable.Format("2006-01-02"),
-				"book":                       bookDetails,
-			})
+	isbns := make([]string, 0, len(books))
+	for _, book := range books {
+		isbns = append(isbns, book.ISBN)
+	}
+	subjects, err := subjectsOf(libId.(uint), isbns)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var highlights map[string]search.Highlight
+	if !text.Empty() && len(books) > 0 {
+		if highlights, err = engine.Highlight(config.DB, libId.(uint), isbns, text); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"book": bookDetails})
-}
+	results := make([]searchResult, 0, len(books))
+	for _, book := range books {
+		result := searchResult{
+			ISBN:            book.ISBN,
+			Title:           book.Title,
+			Authors:         book.Authors,
+			Publisher:       book.Publisher,
+			Version:         book.Version,
+			Category:        book.Category,
+			Description:     book.Description,
+			Language:        book.Language,
+			PublicationYear: book.PublicationYear,
+			Subjects:        append([]string{}, subjects[book.ISBN]...),
+			TotalCopies:     book.Total_copies,
+			AvailableCopies: book.Available_copies,
+		}
+		if date, ok := nextAvailable[book.ISBN]; ok {
+			result.ExpectedAvailabilityDate = &date
+		}
+		if highlight, ok := highlights[book.ISBN]; ok {
+			result.Highlights = &highlight
+		}
+		results = append(results, result)
+	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"books":       results,
+		"total":       total,
+		"page":        input.Page,
+		"limit":       input.Limit,
+		"total_pages": (total + int64(input.Limit) - 1) / int64(input.Limit),
+	})
+}
 
 // UPDATING THE DETAILS OF A BOOK
 func UpdateBook(c *gin.Context) {
 	var input struct {
-		ISBN             uint   `json:"isbn" binding:"required"`
-		LibID            uint   `json:"lib_id"`
-		Title            string `json:"title"`
-		Authors          string `json:"authors"`
-		Publisher        string `json:"publisher"`
-		Version          string `json:"version"`
-		TotalCopies      uint   `json:"total_copies"`
-		Available_copies uint   `json:"available_copies"`
+		ISBN             string    `json:"isbn" binding:"required"`
+		LibID            uint      `json:"lib_id"`
+		Title            string    `json:"title"`
+		Authors          string    `json:"authors"`
+		Publisher        string    `json:"publisher"`
+		Version          string    `json:"version"`
+		Category         string    `json:"category"`
+		Description      string    `json:"description"`
+		Language         string    `json:"language"`
+		PublicationYear  uint      `json:"publication_year"`
+		Subjects         *[]string `json:"subjects"`
+		TotalCopies      uint      `json:"total_copies"`
+		Available_copies uint      `json:"available_copies"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -147,6 +285,13 @@ func UpdateBook(c *gin.Context) {
 	libId, _ := c.Get("libid")
 	input.LibID = libId.(uint)
 
+	isbn, err := utils.NormalizeISBN(input.ISBN)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN"})
+		return
+	}
+	input.ISBN = isbn
+
 	// SEARCHING BOOK
 	var book models.Books
 	if err := config.DB.Where("isbn = ? AND lib_id = ?", input.ISBN, input.LibID).First(&book).Error; err != nil {
@@ -173,25 +318,34 @@ func UpdateBook(c *gin.Context) {
 		book.Version = input.Version
 		flag = false
 	}
+	if input.Category != "" {
+		book.Category = input.Category
+		flag = false
+	}
+	if input.Description != "" {
+		book.Description = input.Description
+		flag = false
+	}
+	if input.Language != "" {
+		book.Language = input.Language
+		flag = false
+	}
+	if input.PublicationYear != 0 {
+		book.PublicationYear = input.PublicationYear
+		flag = false
+	}
+	if input.Subjects != nil {
+		flag = false
+	}
 
 	if input.TotalCopies != 0 {
-		avaialbe_copies := book.Available_copies + input.TotalCopies - book.Total_copies
-		if avaialbe_copies < 0 {
-			book.Available_copies = input.TotalCopies
-		}
-		book.Total_copies = input.TotalCopies
-
 		flag = false
 	}
 	if input.Available_copies != 0 {
-		book.Available_copies = input.Available_copies
-		if book.Available_copies > book.Total_copies {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Available copies can not be more than toatl copies",
-			})
-			return
-		}
-		flag = false
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Available copies are derived from item status, update the items instead",
+		})
+		return
 	}
 
 	// TODO If nothing to update, return error
@@ -202,7 +356,37 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
-	config.DB.Save(&book)
+	// COPY COUNT CHANGES ADD OR WITHDRAW ITEMS, THE COUNTERS FOLLOW FROM THEM
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		before := storedBook(tx, book.ISBN, book.LibID)
+		if err := tx.Omit("total_copies", "available_copies").Save(&book).Error; err != nil {
+			return err
+		}
+		if input.Subjects != nil {
+			if err := models.SetBookSubjects(tx, book.ISBN, book.LibID, *input.Subjects); err != nil {
+				return err
+			}
+		}
+		if input.TotalCopies > book.Total_copies {
+			if err := addItems(tx, book.ISBN, book.LibID, input.TotalCopies-book.Total_copies); err != nil {
+				return err
+			}
+			if err := promoteNextHold(tx, book.ISBN, book.LibID); err != nil {
+				return err
+			}
+		}
+		if input.TotalCopies != 0 && input.TotalCopies < book.Total_copies {
+			if err := withdrawItems(tx, book.ISBN, book.LibID, book.Total_copies-input.TotalCopies); err != nil {
+				return err
+			}
+		}
+		return recordAudit(c, tx, "book.update", "book", book.ISBN, before, storedBook(tx, book.ISBN, book.LibID))
+	})
+
+	if txErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": txErr.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book updated successfully"})
 }
 
@@ -211,7 +395,7 @@ func DeleteBook(c *gin.Context) {
 	isbnStr := c.Param("isbn")
 	fmt.Println("Received ISBN:", isbnStr)
 
-	isbn, err := strconv.ParseUint(isbnStr, 10, 64)
+	isbn, err := utils.NormalizeISBN(isbnStr)
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN format"})
         return
@@ -232,17 +416,30 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
-	// CHECKING IF BOOK HAS BEEN ISSUED
+	// CHECKING IF ANY COPY OF THE BOOK HAS BEEN ISSUED
 	var issuedCount int64
-	config.DB.Raw(`
-		SELECT COUNT(*) FROM issue_requests 
-		WHERE book_id = ? AND status = 'Issued'`, book.ISBN).Scan(&issuedCount)
+	config.DB.Model(&models.BookItem{}).Where("isbn = ? AND lib_id = ? AND status = ?", book.ISBN, book.LibID, "on_loan").Count(&issuedCount)
 
 	if issuedCount > 0 {
 		c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the book. It is currently issued."})
 		return
 	}
 
-	config.DB.Delete(&book)
+	// THE ROWS GO, SO THE AUDIT LOG KEEPS THE BOOK AS IT WAS
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(c, tx, "book.delete", "book", book.ISBN, storedBook(tx, book.ISBN, book.LibID), nil); err != nil {
+			return err
+		}
+		if err := tx.Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).Delete(&models.BookItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).Delete(&models.BookSubject{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&book).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book deleted successfully"})
 }
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var requiredImportColumns = []string{"isbn", "title", "authors", "publisher", "version", "total_copies"}
+
+// LARGEST CSV UPLOAD ACCEPTED, IN BYTES
+var maxImportSize int64 = 10 << 20
+
+type importRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+type importRow struct {
+	Row  int
+	Book models.Books
+}
+
+// READING AND VALIDATING EVERY ROW OF A CATALOGUE CSV
+func parseBookCSV(r io.Reader, libID uint) ([]importRow, []importRowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("CSV file is empty or unreadable")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	var missing []string
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+
+	var rows []importRow
+	rowErrors := []importRowError{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Row: line, Errors: []string{err.Error()}})
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		var problems []string
+		book := models.Books{
+			LibID:       libID,
+			Title:       field("title"),
+			Authors:     field("authors"),
+			Publisher:   field("publisher"),
+			Version:     field("version"),
+			Category:    field("category"),
+			Description: field("description"),
+			Language:    field("language"),
+			Subjects:    strings.Split(field("subjects"), ";"),
+		}
+
+		isbn, err := utils.NormalizeISBN(field("isbn"))
+		if err != nil {
+			problems = append(problems, "invalid isbn")
+		}
+		book.ISBN = isbn
+
+		for _, name := range []string{"title", "authors", "publisher", "version"} {
+			if field(name) == "" {
+				problems = append(problems, name+" is required")
+			}
+		}
+
+		if year := field("publication_year"); year != "" {
+			parsed, err := strconv.ParseUint(year, 10, 32)
+			if err != nil || len(year) != 4 {
+				problems = append(problems, "publication_year must be a four digit year")
+			}
+			book.PublicationYear = uint(parsed)
+		}
+
+		copies, err := strconv.ParseUint(field("total_copies"), 10, 32)
+		if err != nil || copies < 1 {
+			problems = append(problems, "total_copies must be a whole number of at least 1")
+		}
+		book.Total_copies = uint(copies)
+
+		if len(problems) > 0 {
+			rowErrors = append(rowErrors, importRowError{Row: line, Errors: problems})
+			continue
+		}
+		rows = append(rows, importRow{Row: line, Book: book})
+	}
+
+	return rows, rowErrors, nil
+}
+
+// BULK IMPORT OF BOOKS FROM A CSV UPLOAD
+func ImportBooks(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	// THE FORM IS READ ONLY UP TO THE LIMIT, LEAVING ROOM FOR THE MULTIPART FRAMING
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+4096)
+	fileHeader, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && fileHeader.Size > maxImportSize) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("CSV file must not exceed %d bytes", maxImportSize)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required in the 'file' field"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	libId, _ := c.Get("libid")
+	rows, rowErrors, err := parseBookCSV(file, libId.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// WORKING OUT WHICH ROWS CREATE A TITLE AND WHICH ADD COPIES
+	isbns := make([]string, 0, len(rows))
+	for _, row := range rows {
+		isbns = append(isbns, row.Book.ISBN)
+	}
+	var known []string
+	if len(isbns) > 0 {
+		if err := config.DB.Model(&models.Books{}).Where("lib_id = ? AND isbn IN ?", libId, isbns).Pluck("isbn", &known).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	seen := map[string]bool{}
+	for _, isbn := range known {
+		seen[isbn] = true
+	}
+	created, updated := 0, 0
+	for _, row := range rows {
+		if !seen[row.Book.ISBN] {
+			seen[row.Book.ISBN] = true
+			created++
+			continue
+		}
+		updated++
+	}
+
+	report := gin.H{
+		"dry_run": dryRun,
+		"rows":    len(rows) + len(rowErrors),
+		"valid":   len(rows),
+		"created": created,
+		"updated": updated,
+		"errors":  rowErrors,
+	}
+
+	if len(rowErrors) > 0 && !dryRun {
+		report["error"] = "CSV has invalid rows, nothing was imported"
+		c.JSON(http.StatusBadRequest, report)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	// ALL OR NOTHING: A FAILING ROW ROLLS BACK THE WHOLE IMPORT
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if _, err := auditedUpsertBook(c, tx, row.Book); err != nil {
+				return fmt.Errorf("row %d: %v", row.Row, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report["message"] = "Books imported successfully"
+	c.JSON(http.StatusOK, report)
+}
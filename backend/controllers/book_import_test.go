@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCSVUpload(t *testing.T, url, content string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "books.csv")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func setupImportRouter() *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.POST("/books/import", ImportBooks)
+	return router
+}
+
+func TestImportBooks_DryRunReportsRowErrors(t *testing.T) {
+	router := setupImportRouter()
+
+	csvContent := "isbn,title,authors,publisher,version,total_copies\n" +
+		"9780306406157,Go Programming,John Doe,Tech Press,1st,2\n" +
+		"abc,No ISBN,Jane Doe,Tech Press,1st,1\n" +
+		"9781617294549,,Jane Doe,Tech Press,1st,0\n"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import?dry_run=true", csvContent))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":1`)
+	assert.Contains(t, w.Body.String(), `{"row":3,"errors":["invalid isbn"]}`)
+	assert.Contains(t, w.Body.String(), `"row":4`)
+	assert.Contains(t, w.Body.String(), "title is required")
+	assert.Contains(t, w.Body.String(), "total_copies must be a whole number")
+
+	var count int64
+	config.DB.Model(&models.Books{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// THE SAME FILE IS REJECTED OUTRIGHT WITHOUT DRY RUN
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import", csvContent))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	config.DB.Model(&models.Books{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestImportBooks_UpsertsCopies(t *testing.T) {
+	router := setupImportRouter()
+
+	existing := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 1,
+	}
+	config.DB.Create(&existing)
+
+	csvContent := "ISBN,Title,Authors,Publisher,Version,Total_Copies,Category,Language,Publication_Year,Subjects\n" +
+		"9780306406157,Go Programming,John Doe,Tech Press,1st,2,,,,\n" +
+		"9781617294549,Rust in Action,Tim McNamara,Manning,1st,3,Programming,ENG,2019,Rust; Systems programming\n"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import", csvContent))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Books imported successfully")
+	assert.Contains(t, w.Body.String(), `"created":1`)
+	assert.Contains(t, w.Body.String(), `"updated":1`)
+
+	var book models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&book)
+	assert.Equal(t, uint(3), book.Total_copies)
+	assert.Equal(t, uint(3), book.Available_copies)
+
+	var imported models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9781617294549", 1).First(&imported)
+	assert.Equal(t, "Rust in Action", imported.Title)
+	assert.Equal(t, "Programming", imported.Category)
+	assert.Equal(t, uint(3), imported.Total_copies)
+	assert.Equal(t, "eng", imported.Language)
+	assert.Equal(t, uint(2019), imported.PublicationYear)
+
+	var subjects []string
+	config.DB.Model(&models.BookSubject{}).Where("isbn = ?", "9781617294549").Order("subject ASC").Pluck("subject", &subjects)
+	assert.Equal(t, []string{"Rust", "Systems programming"}, subjects)
+}
+
+func TestImportBooks_RejectsOversizedUpload(t *testing.T) {
+	router := setupImportRouter()
+
+	limit := maxImportSize
+	maxImportSize = 64
+	defer func() { maxImportSize = limit }()
+
+	row := "9780306406157,Go Programming,John Doe,Tech Press,1st,2\n"
+	csvContent := "isbn,title,authors,publisher,version,total_copies\n" + row
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import?dry_run=true", csvContent))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "must not exceed 64 bytes")
+
+	// FAR OVER THE LIMIT THE BODY IS CUT OFF BEFORE THE FORM IS READ
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import?dry_run=true", csvContent+strings.Repeat(row, 200)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestImportBooks_DryRunCountsKnownTitles(t *testing.T) {
+	router := setupImportRouter()
+
+	config.DB.Create(&models.Books{ISBN: "9780306406157", Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", LibID: 1})
+	config.DB.Create(&models.Books{ISBN: "9781617294549", Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", LibID: 2})
+
+	// A TITLE OF ANOTHER LIBRARY IS NEW HERE, A REPEATED NEW TITLE IS CREATED ONCE
+	csvContent := "isbn,title,authors,publisher,version,total_copies\n" +
+		"9780306406157,Go Programming,John Doe,Tech Press,1st,2\n" +
+		"9781617294549,Rust in Action,Tim McNamara,Manning,1st,1\n" +
+		"9781617294549,Rust in Action,Tim McNamara,Manning,1st,1\n"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newCSVUpload(t, "/books/import?dry_run=true", csvContent))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"created":1`)
+	assert.Contains(t, w.Body.String(), `"updated":2`)
+}
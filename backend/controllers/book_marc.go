@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/marc"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ISBD PUNCTUATION LEFT AT THE END OF MARC SUBFIELDS
+func trimMarcPunctuation(value string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(value), " /:;,=."))
+}
+
+// FIRST RUN OF DIGITS (AND A TRAILING X) IN AN 020 $a LIKE "0306406152 (pbk.)"
+func marcISBN(value string) string {
+	var digits strings.Builder
+	for _, r := range strings.TrimSpace(value) {
+		if (r >= '0' && r <= '9') || r == 'X' || r == 'x' {
+			digits.WriteRune(r)
+			continue
+		}
+		if r == '-' {
+			continue
+		}
+		break
+	}
+	return digits.String()
+}
+
+// FIRST FOUR DIGIT YEAR IN A DATE LIKE "c2019." OR "[2004?]"
+func marcYear(value string) uint {
+	run := 0
+	for i, r := range value {
+		if r < '0' || r > '9' {
+			run = 0
+			continue
+		}
+		if run++; run == 4 && (i+1 == len(value) || value[i+1] < '0' || value[i+1] > '9') {
+			year, _ := strconv.ParseUint(value[i-3:i+1], 10, 32)
+			return uint(year)
+		}
+	}
+	return 0
+}
+
+// MAPPING A MARC BIBLIOGRAPHIC RECORD ONTO A BOOK
+func recordToBook(record marc.Record, libID uint) (models.Books, []string) {
+	var problems []string
+	book := models.Books{LibID: libID}
+
+	isbn, err := utils.NormalizeISBN(marcISBN(record.Subfield("020", "a")))
+	if err != nil {
+		problems = append(problems, "missing or invalid ISBN in 020 $a")
+	}
+	book.ISBN = isbn
+
+	title := trimMarcPunctuation(record.Subfield("245", "a"))
+	if subtitle := trimMarcPunctuation(record.Subfield("245", "b")); subtitle != "" {
+		title += ": " + subtitle
+	}
+	book.Title = title
+
+	var authors []string
+	for _, tag := range []string{"100", "700"} {
+		for _, name := range record.Subfields(tag, "a") {
+			if name = trimMarcPunctuation(name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+	}
+	book.Authors = strings.Join(authors, "; ")
+
+	// 264 SECOND INDICATOR 1 IS PUBLICATION, OLDER RECORDS USE 260
+	for _, field := range record.Fields("264") {
+		if field.Ind2 != "1" {
+			continue
+		}
+		for _, sf := range field.Subfields {
+			if sf.Code == "b" && book.Publisher == "" {
+				book.Publisher = trimMarcPunctuation(sf.Value)
+			}
+			if sf.Code == "c" && book.PublicationYear == 0 {
+				book.PublicationYear = marcYear(sf.Value)
+			}
+		}
+	}
+	if book.Publisher == "" {
+		book.Publisher = trimMarcPunctuation(record.Subfield("260", "b"))
+	}
+	if book.PublicationYear == 0 {
+		book.PublicationYear = marcYear(record.Subfield("260", "c"))
+	}
+
+	// 041 $a, ELSE THE LANGUAGE CODE AT 008/35-37
+	book.Language = trimMarcPunctuation(record.Subfield("041", "a"))
+	for _, field := range record.ControlFields {
+		if field.Tag == "008" && book.Language == "" && len(field.Value) >= 38 {
+			book.Language = strings.TrimSpace(field.Value[35:38])
+		}
+	}
+	book.Language = strings.ToLower(book.Language)
+
+	// TOPICAL SUBJECT HEADINGS AND UNCONTROLLED INDEX TERMS
+	for _, tag := range []string{"650", "653"} {
+		for _, subject := range record.Subfields(tag, "a") {
+			if subject = trimMarcPunctuation(subject); subject != "" {
+				book.Subjects = append(book.Subjects, subject)
+			}
+		}
+	}
+
+	book.Version = trimMarcPunctuation(record.Subfield("250", "a"))
+
+	if book.Title == "" {
+		problems = append(problems, "missing title in 245 $a")
+	}
+	if book.Authors == "" {
+		problems = append(problems, "missing author in 100 $a or 700 $a")
+	}
+	if book.Publisher == "" {
+		problems = append(problems, "missing publisher in 264 $b or 260 $b")
+	}
+	if book.Version == "" {
+		problems = append(problems, "missing edition in 250 $a")
+	}
+	return book, problems
+}
+
+// MAPPING A BOOK ONTO A MARC BIBLIOGRAPHIC RECORD
+func bookToRecord(book models.Books) marc.Record {
+	record := marc.Record{
+		Leader:        marc.DefaultLeader,
+		ControlFields: []marc.ControlField{{Tag: "001", Value: book.ISBN}},
+	}
+	record.DataFields = append(record.DataFields, marc.DataField{
+		Tag: "020", Ind1: " ", Ind2: " ",
+		Subfields: []marc.Subfield{{Code: "a", Value: book.ISBN}},
+	})
+	if book.Language != "" {
+		record.DataFields = append(record.DataFields, marc.DataField{
+			Tag: "041", Ind1: " ", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: book.Language}},
+		})
+	}
+
+	var authors []string
+	for _, name := range strings.Split(book.Authors, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	titleInd1 := "0"
+	if len(authors) > 0 {
+		titleInd1 = "1"
+		record.DataFields = append(record.DataFields, marc.DataField{
+			Tag: "100", Ind1: "1", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: authors[0]}},
+		})
+	}
+
+	record.DataFields = append(record.DataFields,
+		marc.DataField{
+			Tag: "245", Ind1: titleInd1, Ind2: "0",
+			Subfields: []marc.Subfield{{Code: "a", Value: book.Title}},
+		},
+		marc.DataField{
+			Tag: "250", Ind1: " ", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: book.Version}},
+		},
+	)
+	publication := marc.DataField{
+		Tag: "264", Ind1: " ", Ind2: "1",
+		Subfields: []marc.Subfield{{Code: "b", Value: book.Publisher}},
+	}
+	if book.PublicationYear != 0 {
+		publication.Subfields = append(publication.Subfields, marc.Subfield{Code: "c", Value: strconv.FormatUint(uint64(book.PublicationYear), 10)})
+	}
+	record.DataFields = append(record.DataFields, publication)
+
+	for _, subject := range book.Subjects {
+		record.DataFields = append(record.DataFields, marc.DataField{
+			Tag: "653", Ind1: " ", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: subject}},
+		})
+	}
+
+	for _, name := range authors[min(1, len(authors)):] {
+		record.DataFields = append(record.DataFields, marc.DataField{
+			Tag: "700", Ind1: "1", Ind2: " ",
+			Subfields: []marc.Subfield{{Code: "a", Value: name}},
+		})
+	}
+	return record
+}
+
+// EXPORTING THE CATALOGUE OF THE LIBRARY AS MARC21 OR MARCXML
+func ExportBooksMARC(c *gin.Context) {
+	format := c.DefaultQuery("format", "marcxml")
+	if format != "marc21" && format != "marcxml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be marc21 or marcxml"})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var books []models.Books
+	if err := config.DB.Where("lib_id = ?", libId).Order("isbn ASC").Find(&books).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	isbns := make([]string, 0, len(books))
+	for _, book := range books {
+		isbns = append(isbns, book.ISBN)
+	}
+	subjects, err := subjectsOf(libId.(uint), isbns)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	records := make([]marc.Record, 0, len(books))
+	for _, book := range books {
+		book.Subjects = subjects[book.ISBN]
+		records = append(records, bookToRecord(book))
+	}
+
+	var buf bytes.Buffer
+	contentType, filename := "application/marcxml+xml", "catalogue.xml"
+	if format == "marc21" {
+		contentType, filename = "application/marc", "catalogue.mrc"
+		err = marc.WriteBinary(&buf, records)
+	} else {
+		err = marc.WriteXML(&buf, records)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// IMPORTING VENDOR RECORDS FROM A MARC21 OR MARCXML UPLOAD
+func ImportBooksMARC(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	copies, err := strconv.ParseUint(c.DefaultQuery("copies", "1"), 10, 32)
+	if err != nil || copies < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "copies must be a whole number of at least 1"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A MARC file is required in the 'file' field"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	// MARCXML STARTS WITH MARKUP, BINARY MARC21 WITH THE RECORD LENGTH
+	reader := bufio.NewReader(file)
+	peek, _ := reader.Peek(64)
+	var records []marc.Record
+	if bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(peek, []byte("\ufeff"))), []byte("<")) {
+		records, err = marc.ReadXML(reader)
+	} else {
+		records, err = marc.ReadBinary(reader)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unreadable MARC file: " + err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MARC file has no records"})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var rows []importRow
+	rowErrors := []importRowError{}
+	for i, record := range records {
+		book, problems := recordToBook(record, libId.(uint))
+		if len(problems) > 0 {
+			rowErrors = append(rowErrors, importRowError{Row: i + 1, Errors: problems})
+			continue
+		}
+		book.Total_copies = uint(copies)
+		rows = append(rows, importRow{Row: i + 1, Book: book})
+	}
+
+	// NEW ISBNS ARE CREATED, KNOWN ONES ONLY GET THEIR BIBLIOGRAPHIC DATA REFRESHED
+	existing := map[string]bool{}
+	created, updated := 0, 0
+	for _, row := range rows {
+		if _, seen := existing[row.Book.ISBN]; !seen {
+			var count int64
+			config.DB.Model(&models.Books{}).Where("isbn = ? AND lib_id = ?", row.Book.ISBN, row.Book.LibID).Count(&count)
+			existing[row.Book.ISBN] = count > 0
+			if count == 0 {
+				created++
+				continue
+			}
+		}
+		updated++
+	}
+
+	report := gin.H{
+		"dry_run": dryRun,
+		"records": len(records),
+		"valid":   len(rows),
+		"created": created,
+		"updated": updated,
+		"errors":  rowErrors,
+	}
+
+	if len(rowErrors) > 0 && !dryRun {
+		report["error"] = "MARC file has invalid records, nothing was imported"
+		c.JSON(http.StatusBadRequest, report)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			var book models.Books
+			err := tx.Where("isbn = ? AND lib_id = ?", row.Book.ISBN, row.Book.LibID).First(&book).Error
+			if err == gorm.ErrRecordNotFound {
+				if _, err := auditedUpsertBook(c, tx, row.Book); err != nil {
+					return fmt.Errorf("record %d: %v", row.Row, err)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			before := storedBook(tx, book.ISBN, book.LibID)
+			changes := map[string]interface{}{
+				"title":     row.Book.Title,
+				"authors":   row.Book.Authors,
+				"publisher": row.Book.Publisher,
+				"version":   row.Book.Version,
+			}
+			if row.Book.Language != "" {
+				changes["language"] = row.Book.Language
+			}
+			if row.Book.PublicationYear != 0 {
+				changes["publication_year"] = row.Book.PublicationYear
+			}
+			if err := tx.Model(&book).Updates(changes).Error; err != nil {
+				return fmt.Errorf("record %d: %v", row.Row, err)
+			}
+			if len(row.Book.Subjects) > 0 {
+				if err := models.SetBookSubjects(tx, book.ISBN, book.LibID, row.Book.Subjects); err != nil {
+					return fmt.Errorf("record %d: %v", row.Row, err)
+				}
+			}
+			if err := recordAudit(c, tx, "book.update", "book", book.ISBN, before, storedBook(tx, book.ISBN, book.LibID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report["message"] = "MARC records imported successfully"
+	c.JSON(http.StatusOK, report)
+}
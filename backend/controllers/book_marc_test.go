@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/marc"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMARCUpload(t *testing.T, url string, content []byte) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "records.mrc")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func setupMARCRouter(libID uint) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: libID})
+	caller.POST("/books/import/marc", ImportBooksMARC)
+	caller.GET("/books/export", ExportBooksMARC)
+	return router
+}
+
+func vendorRecord(isbn, title string) marc.Record {
+	return marc.Record{
+		Leader:        marc.DefaultLeader,
+		ControlFields: []marc.ControlField{{Tag: "008", Value: "190101s2019    xxu                 eng d"}},
+		DataFields: []marc.DataField{
+			{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: isbn + " (pbk.)"}}},
+			{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "Doe, John,"}}},
+			{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []marc.Subfield{{Code: "a", Value: title + " /"}}},
+			{Tag: "250", Ind1: " ", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "2nd ed."}}},
+			{Tag: "260", Ind1: " ", Ind2: " ", Subfields: []marc.Subfield{{Code: "b", Value: "Tech Press,"}, {Code: "c", Value: "c2019."}}},
+			{Tag: "700", Ind1: "1", Ind2: " ", Subfields: []marc.Subfield{{Code: "a", Value: "Roe, Jane."}}},
+			{Tag: "650", Ind1: " ", Ind2: "0", Subfields: []marc.Subfield{{Code: "a", Value: "Computer programming."}}},
+		},
+	}
+}
+
+func TestImportBooksMARC_Binary(t *testing.T) {
+	router := setupMARCRouter(1)
+
+	existing := models.Books{ISBN: "9780306406157", LibID: 1, Title: "Old Title", Authors: "Someone", Publisher: "Old Press", Version: "1st", Total_copies: 2}
+	config.DB.Create(&existing)
+
+	var buf bytes.Buffer
+	marc.WriteBinary(&buf, []marc.Record{vendorRecord("0-306-40615-2", "Go Programming"), vendorRecord("9781617294549", "Rust Programming")})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newMARCUpload(t, "/books/import/marc?copies=3", buf.Bytes()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"created":1`)
+	assert.Contains(t, w.Body.String(), `"updated":1`)
+
+	// KNOWN ISBN KEEPS ITS COPIES BUT TAKES THE VENDOR DESCRIPTION
+	var updated models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&updated)
+	assert.Equal(t, "Go Programming", updated.Title)
+	assert.Equal(t, "Doe, John; Roe, Jane", updated.Authors)
+	assert.Equal(t, "Tech Press", updated.Publisher)
+	assert.Equal(t, "2nd ed", updated.Version)
+	assert.Equal(t, uint(2), updated.Total_copies)
+
+	var created models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9781617294549", 1).First(&created)
+	assert.Equal(t, "Rust Programming", created.Title)
+	assert.Equal(t, uint(3), created.Total_copies)
+	assert.Equal(t, "eng", created.Language)
+	assert.Equal(t, uint(2019), created.PublicationYear)
+
+	var subjects []string
+	config.DB.Model(&models.BookSubject{}).Where("isbn = ?", "9781617294549").Pluck("subject", &subjects)
+	assert.Equal(t, []string{"Computer programming"}, subjects)
+
+	var items int64
+	config.DB.Model(&models.BookItem{}).Where("isbn = ?", "9781617294549").Count(&items)
+	assert.Equal(t, int64(3), items)
+}
+
+func TestImportBooksMARC_XMLWithInvalidRecord(t *testing.T) {
+	router := setupMARCRouter(1)
+
+	incomplete := vendorRecord("9781617294549", "Rust Programming")
+	incomplete.DataFields = incomplete.DataFields[:3]
+
+	var buf bytes.Buffer
+	marc.WriteXML(&buf, []marc.Record{vendorRecord("9780306406157", "Go Programming"), incomplete})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newMARCUpload(t, "/books/import/marc", buf.Bytes()))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"row":2`)
+	assert.Contains(t, w.Body.String(), "missing edition in 250 $a")
+
+	var count int64
+	config.DB.Model(&models.Books{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestExportBooksMARC_ScopedToLibrary(t *testing.T) {
+	router := setupMARCRouter(1)
+
+	config.DB.Create(&models.Books{ISBN: "9780306406157", LibID: 1, Title: "Go Programming", Authors: "Doe, John; Roe, Jane", Publisher: "Tech Press", Version: "1st", Language: "eng", PublicationYear: 2015, Subjects: []string{"Go", "Programming"}, Total_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9781617294549", LibID: 2, Title: "Other Library", Authors: "Someone", Publisher: "Press", Version: "1st", Total_copies: 1})
+
+	req, _ := http.NewRequest("GET", "/books/export?format=marc21", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/marc", w.Header().Get("Content-Type"))
+
+	records, err := marc.ReadBinary(w.Body)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	book, problems := recordToBook(records[0], 1)
+	assert.Empty(t, problems)
+	assert.Equal(t, "9780306406157", book.ISBN)
+	assert.Equal(t, "Go Programming", book.Title)
+	assert.Equal(t, "Doe, John; Roe, Jane", book.Authors)
+	assert.Equal(t, "Tech Press", book.Publisher)
+	assert.Equal(t, "eng", book.Language)
+	assert.Equal(t, uint(2015), book.PublicationYear)
+	assert.Equal(t, []string{"Go", "Programming"}, book.Subjects)
+
+	req, _ = http.NewRequest("GET", "/books/export", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<subfield code="a">Go Programming</subfield>`)
+	assert.NotContains(t, w.Body.String(), "Other Library")
+}
@@ -2,12 +2,12 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"strconv"
 	"testing"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
 	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
@@ -15,23 +15,17 @@ import (
 )
 
 func TestAddBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB() 
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	if config.DB == nil {
 		t.Fatalf("❌ config.DB is nil! Database not initialized.")
 	}
 
-	router := gin.Default()
-
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("libid", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
 
-	router.POST("/books/add", AddBook)
+	caller.POST("/books/add", AddBook)
 
 	
 	lib := models.Library{Name: "Test Library"}
@@ -48,7 +42,7 @@ func TestAddBook(t *testing.T) {
 		"authors": "John Doe",
 		"publisher": "Tech Press",
 		"version": "1st",
-		"isbn": 123456,
+		"isbn": "9780306406157",
 		"total_copies": 5
 	}`
 
@@ -63,20 +57,47 @@ func TestAddBook(t *testing.T) {
 
 	
 	var book models.Books
-	err := config.DB.First(&book, "isbn = ?", 123456).Error
+	err := config.DB.First(&book, "isbn = ?", "9780306406157").Error
 	assert.Nil(t, err, "❌ Book should exist in the database")
 	assert.Equal(t, "Go Programming", book.Title)
 }
 
-func TestSearchBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
+func TestAddBook_NormalisesISBN(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{Name: "Test Library"}},
+	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.POST("/books/add", AddBook)
+
+	// ISBN-10 WITH A CHECK DIGIT X IS STORED AS ITS ISBN-13
+	bookPayload := `{"title": "Go Programming", "authors": "John Doe", "publisher": "Tech Press", "version": "1st", "isbn": "0-8044-2957-X", "total_copies": 1}`
+	req, _ := http.NewRequest("POST", "/books/add", bytes.NewBuffer([]byte(bookPayload)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var book models.Books
+	err := config.DB.First(&book, "isbn = ?", "9780804429573").Error
+	assert.Nil(t, err)
+
+	// WRONG CHECK DIGIT
+	bookPayload = `{"title": "Go Programming", "authors": "John Doe", "publisher": "Tech Press", "version": "1st", "isbn": "9780306406158", "total_copies": 1}`
+	req, _ = http.NewRequest("POST", "/books/add", bytes.NewBuffer([]byte(bookPayload)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 
-	router := gin.Default()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid ISBN")
+}
+
+func TestSearchBook(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	book := models.Books{
-		ISBN:      123456,
+		ISBN:      "9780306406157",
 		Title:     "Go Programming",
 		Authors:   "John Doe",
 		Publisher: "Tech Press",
@@ -88,36 +109,122 @@ func TestSearchBook(t *testing.T) {
 	config.DB.Create(&book)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("libid", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
 
-	router.POST("/books/search", SearchBook)
+	caller.GET("/books/search", SearchBook)
 
-	searchPayload := `{
-		"title": "Go Programming"
-	}`
-
-	req, _ := http.NewRequest("POST", "/books/search", bytes.NewBuffer([]byte(searchPayload)))
-	req.Header.Set("Content-Type", "application/json")
+	req, _ := http.NewRequest("GET", "/books/search?title=go+programming", nil)
 
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "Go Programming")
+	assert.Contains(t, w.Body.String(), `"total":1`)
+}
+
+func TestSearchBook_PaginatesSortsAndFilters(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	titles := map[string]string{
+		"9780306406157": "Go Programming",
+		"9781617294549": "Rust in Action",
+		"9781492071266": "Learning Go",
+	}
+	for isbn, title := range titles {
+		config.DB.Create(&models.Books{ISBN: isbn, LibID: 1, Title: title, Authors: "John Doe", Publisher: "Tech Press", Version: "1st", Total_copies: 1, Available_copies: 1})
+	}
+	config.DB.Create(&models.Books{ISBN: "9780804429573", LibID: 2, Title: "Go in Another Library", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", Total_copies: 1, Available_copies: 1})
+
+	// THE ONLY COPY OF RUST IN ACTION IS ON LOAN
+	config.DB.Model(&models.Books{}).Where("isbn = ?", "9781617294549").Update("available_copies", 0)
+	due := time.Now().AddDate(0, 0, 5)
+	config.DB.Create(&models.IssueRegistry{ISBN: "9781617294549", LibID: 1, ReaderID: 2, Status: "issued", IssueDate: time.Now(), ExpectedReturnDate: due})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.GET("/books/search", SearchBook)
+
+	search := func(query string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", "/books/search?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+	titlesOf := func(body map[string]interface{}) []string {
+		var out []string
+		for _, b := range body["books"].([]interface{}) {
+			out = append(out, b.(map[string]interface{})["title"].(string))
+		}
+		return out
+	}
+
+	code, body := search("q=go&sort=title&limit=1&page=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), body["total"])
+	assert.Equal(t, float64(2), body["total_pages"])
+	assert.Equal(t, []string{"Learning Go"}, titlesOf(body))
+
+	code, body = search("sort=availability")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Rust in Action", titlesOf(body)[2])
+
+	code, body = search("available=false")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"Rust in Action"}, titlesOf(body))
+	book := body["books"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, due.Format("2006-01-02"), book["expected_availability_date"])
+
+	code, _ = search("sort=price")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestSearchBook_FullText(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.Books{ISBN: "9780306406157", LibID: 1, Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", Total_copies: 1, Available_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9781617294549", LibID: 1, Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", Description: "Systems programming explained through Rust", Total_copies: 1, Available_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9781492071266", LibID: 2, Title: "Programming in Another Library", Authors: "Jane Roe", Publisher: "Tech Press", Version: "1st", Total_copies: 1, Available_copies: 1})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.GET("/books/search", SearchBook)
+
+	// TYPO IN THE QUERY, TITLE MATCH RANKED ABOVE THE DESCRIPTION MATCH
+	req, _ := http.NewRequest("GET", "/books/search?q=progamming", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Total int64 `json:"total"`
+		Books []struct {
+			ISBN       string `json:"isbn"`
+			Highlights struct {
+				Title   string `json:"title"`
+				Snippet string `json:"snippet"`
+			} `json:"highlights"`
+		} `json:"books"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, int64(2), body.Total)
+	assert.Equal(t, "9780306406157", body.Books[0].ISBN)
+	assert.Equal(t, "Go <mark>Programming</mark>", body.Books[0].Highlights.Title)
+	assert.Equal(t, "9781617294549", body.Books[1].ISBN)
+	assert.Contains(t, body.Books[1].Highlights.Snippet, "<mark>programming</mark>")
+
+	req, _ = http.NewRequest("GET", "/books/search?q=%2A%2A", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
  
 func TestUpdateBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	book := models.Books{
-		ISBN:      123456,
+		ISBN:      "9780306406157",
 		Title:     "Go Programming",
 		Authors:   "John Doe",
 		Publisher: "Tech Press",
@@ -129,15 +236,12 @@ func TestUpdateBook(t *testing.T) {
 	config.DB.Create(&book)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("libid", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
 
-	router.PUT("/books/update", UpdateBook)
+	caller.PUT("/books/update", UpdateBook)
 
 	updatePayload := `{
-		"isbn": 123456,
+		"isbn": "9780306406157",
 		"title": "Advanced Go Programming",
 		"authors": "Jane Doe",
 		"publisher": "Tech Press 2nd Edition",
@@ -155,7 +259,7 @@ func TestUpdateBook(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Book updated successfully")
  
 	var updatedBook models.Books
-	config.DB.Where("isbn = ?", 123456).First(&updatedBook)
+	config.DB.Where("isbn = ?", "9780306406157").First(&updatedBook)
 	assert.Equal(t, "Advanced Go Programming", updatedBook.Title)
 	assert.Equal(t, "Jane Doe", updatedBook.Authors)
 	assert.Equal(t, "Tech Press 2nd Edition", updatedBook.Publisher)
@@ -165,23 +269,15 @@ func TestUpdateBook(t *testing.T) {
  
 
 func TestDeleteBook(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
-
-	
-	admin := models.User{
-		Name:  "Admin User",
-		Email: "admin@example.com",
-		Role:  "Admin",
-		LibID: 1,
-	}
-	config.DB.Create(&admin)
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Admin User", Email: "admin@example.com", Role: "Admin", LibID: 1},
+		},
+	})
 
 	
 	book := models.Books{
-		ISBN:             123456,
+		ISBN:             "9780306406157",
 		Title:            "Go Programming",
 		Authors:          "John Doe",
 		Publisher:        "Tech Press",
@@ -193,14 +289,11 @@ func TestDeleteBook(t *testing.T) {
 	config.DB.Create(&book)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("email", "admin@example.com")  
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{Email: "admin@example.com"})
 
 	
-	isbnStr := strconv.Itoa(123456)
-	router.DELETE("/books/delete/:isbn", DeleteBook)  
+	isbnStr := "9780306406157"
+	caller.DELETE("/books/delete/:isbn", DeleteBook)  
 
 	
 	req, _ := http.NewRequest("DELETE", "/books/delete/"+isbnStr, nil)
@@ -215,6 +308,6 @@ func TestDeleteBook(t *testing.T) {
 
 	
 	var deletedBook models.Books
-	err := config.DB.Where("isbn = ?", 123456).First(&deletedBook).Error
+	err := config.DB.Where("isbn = ?", "9780306406157").First(&deletedBook).Error
 	assert.NotNil(t, err)  
 }
\ No newline at end of file
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/search"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// FILTERS SHARED BY CATALOGUE SEARCH AND ITS FACETS
+type catalogueFilter struct {
+	Query     string   `form:"q"`
+	Title     string   `form:"title"`
+	ISBN      string   `form:"isbn"`
+	Authors   string   `form:"authors"`
+	Available string   `form:"available" binding:"omitempty,oneof=true false"`
+	Subjects  []string `form:"subject"`
+	Language  string   `form:"language"`
+	Publisher string   `form:"publisher"`
+	YearFrom  uint     `form:"year_from"`
+	YearTo    uint     `form:"year_to"`
+}
+
+func (f *catalogueFilter) validate() error {
+	if f.ISBN != "" {
+		isbn, err := utils.NormalizeISBN(f.ISBN)
+		if err != nil {
+			return errors.New("Invalid ISBN")
+		}
+		f.ISBN = isbn
+	}
+	if f.Query != "" && search.Parse(f.Query).Empty() {
+		return errors.New("Search query has no searchable words")
+	}
+	if f.YearFrom != 0 && f.YearTo != 0 && f.YearFrom > f.YearTo {
+		return errors.New("year_from can not be after year_to")
+	}
+	return nil
+}
+
+// BOOKS OF THE LIBRARY MATCHING THE FILTER, WITH THE PARSED FULL-TEXT QUERY
+func (f catalogueFilter) apply(libID uint) (*gorm.DB, search.Query, error) {
+	query := config.DB.Model(&models.Books{}).Where("books.lib_id = ?", libID)
+
+	// FULL-TEXT MATCH ON TITLE, AUTHORS, PUBLISHER AND DESCRIPTION
+	var text search.Query
+	if f.Query != "" {
+		var err error
+		if text, err = search.Prepare(config.DB, libID, f.Query); err != nil {
+			return nil, text, err
+		}
+		query = search.For(config.DB).Match(query, text)
+	}
+
+	if f.Title != "" {
+		query = query.Where(ilike("title"), "%"+f.Title+"%")
+	}
+	if f.Authors != "" {
+		query = query.Where(ilike("authors"), "%"+f.Authors+"%")
+	}
+	if f.ISBN != "" {
+		query = query.Where("isbn = ?", f.ISBN)
+	}
+	if f.Available == "true" {
+		query = query.Where("available_copies > 0")
+	} else if f.Available == "false" {
+		query = query.Where("available_copies = 0")
+	}
+
+	// EVERY SELECTED SUBJECT MUST BE PRESENT
+	for _, subject := range f.Subjects {
+		query = query.Where("isbn IN (?)", config.DB.Model(&models.BookSubject{}).Select("isbn").
+			Where("lib_id = ? AND subject = ?", libID, subject))
+	}
+	if f.Language != "" {
+		query = query.Where("language = ?", strings.ToLower(strings.TrimSpace(f.Language)))
+	}
+	if f.Publisher != "" {
+		query = query.Where("publisher = ?", f.Publisher)
+	}
+	if f.YearFrom != 0 {
+		query = query.Where("publication_year >= ?", f.YearFrom)
+	}
+	if f.YearTo != 0 {
+		query = query.Where("publication_year <= ? AND publication_year > 0", f.YearTo)
+	}
+
+	return query.Session(&gorm.Session{}), text, nil
+}
+
+// SUBJECT HEADINGS OF A PAGE OF BOOKS, BY ISBN
+func subjectsOf(libID uint, isbns []string) (map[string][]string, error) {
+	var rows []models.BookSubject
+	if err := config.DB.Where("lib_id = ? AND isbn IN ?", libID, isbns).Order("subject ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	subjects := map[string][]string{}
+	for _, row := range rows {
+		subjects[row.ISBN] = append(subjects[row.ISBN], row.Subject)
+	}
+	return subjects, nil
+}
+
+type facetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// COUNTS PER FACET VALUE FOR THE BOOKS MATCHING THE CURRENT SEARCH
+func BookFacets(c *gin.Context) {
+	var input struct {
+		catalogueFilter
+		FacetLimit int `form:"facet_limit" binding:"omitempty,min=1,max=100"`
+	}
+
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.FacetLimit == 0 {
+		input.FacetLimit = 20
+	}
+
+	libId, _ := c.Get("libid")
+	query, _, err := input.apply(libId.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// SUBJECTS COME FROM THEIR OWN TABLE, THE OTHER FACETS FROM BOOK COLUMNS
+	facets := map[string][]facetCount{}
+	subjects := []facetCount{}
+	if err := config.DB.Model(&models.BookSubject{}).Select("subject AS value, COUNT(*) AS count").
+		Where("lib_id = ? AND isbn IN (?)", libId, query.Select("isbn")).
+		Group("subject").Order("count DESC, value ASC").Limit(input.FacetLimit).Scan(&subjects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	facets["subjects"] = subjects
+
+	// UNKNOWN VALUES ARE LEFT OUT OF THE COUNTS
+	columns := map[string]struct {
+		column  string
+		unknown interface{}
+		order   string
+	}{
+		"publisher":        {"publisher", "", "count DESC, value ASC"},
+		"language":         {"language", "", "count DESC, value ASC"},
+		"publication_year": {"publication_year", 0, "value DESC"},
+	}
+	for name, facet := range columns {
+		counts := []facetCount{}
+		if err := query.Select(facet.column+" AS value, COUNT(*) AS count").
+			Where(facet.column+" <> ?", facet.unknown).
+			Group(facet.column).Order(facet.order).Limit(input.FacetLimit).Scan(&counts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		facets[name] = counts
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "facets": facets})
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCatalogue(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.Books{ISBN: "9780306406157", LibID: 1, Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", Language: "ENG", PublicationYear: 2015, Subjects: []string{"Programming", "Go"}, Total_copies: 1, Available_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9781617294549", LibID: 1, Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", Description: "Systems programming explained through Rust", Language: "eng", PublicationYear: 2021, Subjects: []string{"Programming", "Rust", "rust"}, Total_copies: 1, Available_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9781492071266", LibID: 1, Title: "Aprendiendo Go", Authors: "Jon Bodner", Publisher: "Tech Press", Version: "1st", Language: "spa", Subjects: []string{"Go"}, Total_copies: 1, Available_copies: 1})
+	config.DB.Create(&models.Books{ISBN: "9780804429573", LibID: 2, Title: "Go in Another Library", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", Language: "eng", PublicationYear: 2015, Subjects: []string{"Go"}, Total_copies: 1, Available_copies: 1})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.GET("/books/search", SearchBook)
+	caller.GET("/books/facets", BookFacets)
+	caller.PATCH("/books/:isbn", UpdateBook)
+	return router
+}
+
+func getJSON(router *gin.Engine, url string) (int, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+// COUNT OF EVERY VALUE OF A FACET
+func facetValues(body map[string]interface{}, name string) map[string]float64 {
+	out := map[string]float64{}
+	for _, f := range body["facets"].(map[string]interface{})[name].([]interface{}) {
+		facet := f.(map[string]interface{})
+		out[facet["value"].(string)] = facet["count"].(float64)
+	}
+	return out
+}
+
+func TestBookFacets(t *testing.T) {
+	router := setupCatalogue(t)
+
+	code, body := getJSON(router, "/books/facets")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(3), body["total"])
+	assert.Equal(t, map[string]float64{"Go": 2, "Programming": 2, "Rust": 1}, facetValues(body, "subjects"))
+	assert.Equal(t, map[string]float64{"Tech Press": 2, "Manning": 1}, facetValues(body, "publisher"))
+	assert.Equal(t, map[string]float64{"eng": 2, "spa": 1}, facetValues(body, "language"))
+	// BOOKS WITHOUT A YEAR ARE LEFT OUT
+	assert.Equal(t, map[string]float64{"2015": 1, "2021": 1}, facetValues(body, "publication_year"))
+
+	// COUNTS FOLLOW THE CURRENT SEARCH
+	code, body = getJSON(router, "/books/facets?q=programming&language=ENG")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), body["total"])
+	assert.Equal(t, map[string]float64{"Programming": 2, "Go": 1, "Rust": 1}, facetValues(body, "subjects"))
+
+	code, body = getJSON(router, "/books/facets?subject=Go&facet_limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), body["total"])
+	assert.Equal(t, map[string]float64{"Go": 2}, facetValues(body, "subjects"))
+
+	code, _ = getJSON(router, "/books/facets?year_from=2020&year_to=2010")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestSearchBook_FacetFilters(t *testing.T) {
+	router := setupCatalogue(t)
+
+	isbnsOf := func(body map[string]interface{}) []string {
+		var out []string
+		for _, b := range body["books"].([]interface{}) {
+			out = append(out, b.(map[string]interface{})["isbn"].(string))
+		}
+		return out
+	}
+
+	code, body := getJSON(router, "/books/search?subject=Go&subject=Programming")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"9780306406157"}, isbnsOf(body))
+	book := body["books"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{"Go", "Programming"}, book["subjects"])
+	assert.Equal(t, "eng", book["language"])
+	assert.Equal(t, float64(2015), book["publication_year"])
+
+	code, body = getJSON(router, "/books/search?language=spa")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"9781492071266"}, isbnsOf(body))
+
+	code, body = getJSON(router, "/books/search?year_from=2016&publisher=Manning")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"9781617294549"}, isbnsOf(body))
+
+	code, body = getJSON(router, "/books/search?year_to=2020")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"9780306406157"}, isbnsOf(body))
+}
+
+func TestUpdateBook_Subjects(t *testing.T) {
+	router := setupCatalogue(t)
+
+	payload, _ := json.Marshal(map[string]interface{}{"isbn": "9781492071266", "subjects": []string{"Programming", " ", "Spanish"}, "publication_year": 2020})
+	req, _ := http.NewRequest("PATCH", "/books/9781492071266", bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var subjects []string
+	config.DB.Model(&models.BookSubject{}).Where("isbn = ?", "9781492071266").Order("subject ASC").Pluck("subject", &subjects)
+	assert.Equal(t, []string{"Programming", "Spanish"}, subjects)
+
+	var book models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9781492071266", 1).First(&book)
+	assert.Equal(t, uint(2020), book.PublicationYear)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OVERDUE FINE FOR A LOAN: FULL DAYS LATE BEYOND THE GRACE PERIOD, CAPPED IF A CAP IS SET
+func computeFine(policy models.CirculationPolicy, expected, returned time.Time) uint {
+	if expected.IsZero() || !returned.After(expected) || policy.FineDailyRate == 0 {
+		return 0
+	}
+
+	lateDays := uint(returned.Sub(expected) / (24 * time.Hour))
+	if lateDays <= policy.FineGraceDays {
+		return 0
+	}
+
+	fine := (lateDays - policy.FineGraceDays) * policy.FineDailyRate
+	if policy.FineCap > 0 && fine > policy.FineCap {
+		fine = policy.FineCap
+	}
+	return fine
+}
+
+// CHARGING THE READER FOR A LATE RETURN
+func assessFine(tx *gorm.DB, issueReg models.IssueRegistry) (uint, error) {
+	if issueReg.ReturnDate == nil {
+		return 0, nil
+	}
+
+	policy := loanPolicy(tx, issueReg.LibID, issueReg.ISBN, issueReg.ReaderID)
+	fine := computeFine(policy, issueReg.ExpectedReturnDate, *issueReg.ReturnDate)
+	if fine == 0 {
+		return 0, nil
+	}
+
+	entry := models.FineEntry{
+		LibID:        issueReg.LibID,
+		ReaderID:     issueReg.ReaderID,
+		IssueID:      &issueReg.IssueID,
+		EntryType:    "charge",
+		Amount:       fine,
+		Reason:       "Overdue return",
+		RecordedByID: issueReg.ReturnApproverID,
+	}
+	return fine, tx.Create(&entry).Error
+}
+
+// OUTSTANDING BALANCE OF A READER: CHARGES MINUS PAYMENTS AND WAIVERS
+func readerBalance(tx *gorm.DB, libID, readerID uint) (int64, error) {
+	var balance int64
+	err := tx.Model(&models.FineEntry{}).
+		Select("COALESCE(SUM(CASE WHEN entry_type = 'charge' THEN amount ELSE -amount END), 0)").
+		Where("lib_id = ? AND reader_id = ?", libID, readerID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+func respondWithLedger(c *gin.Context, libID, readerID uint) {
+	var entries []models.FineEntry
+	if err := config.DB.Where("lib_id = ? AND reader_id = ?", libID, readerID).Order("entry_id ASC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := readerBalance(config.DB, libID, readerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "balance": balance})
+}
+
+// FINE LEDGER OF THE LOGGED IN READER
+func ListMyFines(c *gin.Context) {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+	respondWithLedger(c, libId.(uint), id.(uint))
+}
+
+// FINE LEDGER OF A READER IN THE LIBRARY
+func ListReaderFines(c *gin.Context) {
+	readerId, err := strconv.ParseUint(c.Param("readerId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reader ID"})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var reader models.User
+	if err := config.DB.Where("id = ? AND lib_id = ?", readerId, libId).First(&reader).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reader not found"})
+		return
+	}
+
+	respondWithLedger(c, reader.LibID, reader.ID)
+}
+
+// RECORDING A PAYMENT OR A WAIVER AGAINST A READER'S BALANCE
+func recordFineCredit(c *gin.Context, entryType string) {
+	var input struct {
+		ReaderID uint   `json:"reader_id" binding:"required"`
+		Amount   uint   `json:"amount" binding:"required,min=1"`
+		Reason   string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if entryType == "waiver" && input.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to waive fines"})
+		return
+	}
+
+	id, _ := c.Get("id")
+	adminId := id.(uint)
+	libId, _ := c.Get("libid")
+
+	var reader models.User
+	if err := config.DB.Where("id = ? AND lib_id = ?", input.ReaderID, libId).First(&reader).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reader not found"})
+		return
+	}
+
+	var entry models.FineEntry
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		balance, err := readerBalance(tx, reader.LibID, reader.ID)
+		if err != nil {
+			return err
+		}
+		if int64(input.Amount) > balance {
+			return errors.New("amount exceeds outstanding balance")
+		}
+
+		entry = models.FineEntry{
+			LibID:        reader.LibID,
+			ReaderID:     reader.ID,
+			EntryType:    entryType,
+			Amount:       input.Amount,
+			Reason:       input.Reason,
+			RecordedByID: &adminId,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "fine."+entryType, "fine_entry", entry.EntryID, nil, entry)
+	})
+
+	if txErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": txErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Fine " + entryType + " recorded successfully", "entry": entry})
+}
+
+// RECORDING A FINE PAYMENT
+func RecordFinePayment(c *gin.Context) {
+	recordFineCredit(c, "payment")
+}
+
+// WAIVING PART OR ALL OF A READER'S FINES
+func WaiveFine(c *gin.Context) {
+	recordFineCredit(c, "waiver")
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeFine(t *testing.T) {
+	policy := models.CirculationPolicy{FineDailyRate: 10, FineGraceDays: 2, FineCap: 100}
+	due := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, uint(0), computeFine(policy, due, due.Add(-time.Hour)))
+	assert.Equal(t, uint(0), computeFine(policy, due, due.AddDate(0, 0, 2)))
+	assert.Equal(t, uint(10), computeFine(policy, due, due.AddDate(0, 0, 3)))
+	assert.Equal(t, uint(20), computeFine(policy, due, due.AddDate(0, 0, 4).Add(time.Hour)))
+	assert.Equal(t, uint(100), computeFine(policy, due, due.AddDate(0, 1, 0)))
+	assert.Equal(t, uint(0), computeFine(models.CirculationPolicy{}, due, due.AddDate(0, 1, 0)))
+}
+
+func TestHandleReturnRequest_ChargesFine(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutils.SetupTestDB()
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 14, FineDailyRate: 5})
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 0,
+	}
+	config.DB.Create(&book)
+
+	config.DB.Create(&models.IssueRegistry{
+		ISBN:               book.ISBN,
+		LibID:              book.LibID,
+		ReaderID:           2,
+		Status:             "issued",
+		IssueDate:          time.Now().AddDate(0, 0, -17),
+		ExpectedReturnDate: time.Now().AddDate(0, 0, -3),
+	})
+
+	returnRequest := models.RequestEvents{BookID: book.ISBN, ReaderID: 2, LibID: 1, RequestType: "return", RequestDate: time.Now()}
+	config.DB.Create(&returnRequest)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("libid", uint(1))
+	handleReturnRequest(c, 1, returnRequest.ReqID)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"fine":15`)
+
+	var charge models.FineEntry
+	err := config.DB.Where("reader_id = ? AND entry_type = ?", 2, "charge").First(&charge).Error
+	assert.Nil(t, err)
+	assert.Equal(t, uint(15), charge.Amount)
+	assert.NotNil(t, charge.IssueID)
+}
+
+func TestRecordFinePayment(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	reader := models.User{Name: "Reader User", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	config.DB.Create(&reader)
+	config.DB.Create(&models.FineEntry{LibID: 1, ReaderID: reader.ID, EntryType: "charge", Amount: 50})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 9, LibID: 1})
+	caller.POST("/fines/payments", RecordFinePayment)
+	caller.GET("/fines/:readerId", ListReaderFines)
+
+	req, _ := http.NewRequest("POST", "/fines/payments", bytes.NewBuffer([]byte(`{"reader_id": 1, "amount": 80}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "amount exceeds outstanding balance")
+
+	req, _ = http.NewRequest("POST", "/fines/payments", bytes.NewBuffer([]byte(`{"reader_id": 1, "amount": 30}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Fine payment recorded successfully")
+
+	req, _ = http.NewRequest("GET", "/fines/1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"balance":20`)
+}
+
+func TestWaiveFine_RequiresReason(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	reader := models.User{Name: "Reader User", Email: "reader@example.com", Role: "Reader", LibID: 1}
+	config.DB.Create(&reader)
+	config.DB.Create(&models.FineEntry{LibID: 1, ReaderID: reader.ID, EntryType: "charge", Amount: 50})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 9, LibID: 1})
+	caller.POST("/fines/waivers", WaiveFine)
+
+	req, _ := http.NewRequest("POST", "/fines/waivers", bytes.NewBuffer([]byte(`{"reader_id": 1, "amount": 50}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "A reason is required")
+
+	req, _ = http.NewRequest("POST", "/fines/waivers", bytes.NewBuffer([]byte(`{"reader_id": 1, "amount": 50, "reason": "Book returned damaged by flood"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	balance, _ := readerBalance(config.DB, 1, reader.ID)
+	assert.Equal(t, int64(0), balance)
+}
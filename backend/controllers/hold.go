@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DAYS A READER HAS TO COLLECT A BOOK ONCE THEIR HOLD IS PROMOTED
+const holdPickupDays = 3
+
+type holdDetails struct {
+	models.Hold
+	Position int64 `json:"position"`
+}
+
+// COPIES SET ASIDE FOR READERS WHOSE HOLD IS READY FOR PICKUP
+func reservedCopies(tx *gorm.DB, isbn string, libID uint) int64 {
+	var count int64
+	tx.Model(&models.Hold{}).Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, "ready").Count(&count)
+	return count
+}
+
+// POSITION OF A WAITING HOLD IN ITS QUEUE, 0 ONCE IT IS READY
+func holdPosition(tx *gorm.DB, hold models.Hold) int64 {
+	if hold.Status != "waiting" {
+		return 0
+	}
+	var ahead int64
+	tx.Model(&models.Hold{}).
+		Where("isbn = ? AND lib_id = ? AND status = ? AND hold_id < ?", hold.ISBN, hold.LibID, "waiting", hold.HoldID).
+		Count(&ahead)
+	return ahead + 1
+}
+
+// ADDING A READER TO THE HOLD QUEUE OF A BOOK
+func joinHoldQueue(tx *gorm.DB, isbn string, libID, readerID uint) (models.Hold, int64, error) {
+	var hold models.Hold
+	err := tx.Where("isbn = ? AND lib_id = ? AND reader_id = ? AND status IN ?", isbn, libID, readerID, []string{"waiting", "ready"}).
+		First(&hold).Error
+	if err == nil {
+		return hold, holdPosition(tx, hold), nil
+	}
+
+	hold = models.Hold{
+		ISBN:     isbn,
+		LibID:    libID,
+		ReaderID: readerID,
+		Status:   "waiting",
+	}
+	if err := tx.Create(&hold).Error; err != nil {
+		return hold, 0, err
+	}
+	return hold, holdPosition(tx, hold), nil
+}
+
+// PROMOTING WAITING HOLDS TO ISSUE REQUESTS WHILE UNRESERVED COPIES REMAIN
+func promoteNextHold(tx *gorm.DB, isbn string, libID uint) error {
+	var book models.Books
+	if err := tx.Where("isbn = ? AND lib_id = ?", isbn, libID).First(&book).Error; err != nil {
+		return err
+	}
+
+	for int64(book.Available_copies) > reservedCopies(tx, isbn, libID) {
+		var hold models.Hold
+		if err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, "waiting").
+			Order("hold_id ASC").First(&hold).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+
+		now := time.Now()
+		req := models.RequestEvents{
+			BookID:      isbn,
+			ReaderID:    hold.ReaderID,
+			LibID:       libID,
+			RequestType: "issue",
+			RequestDate: now,
+		}
+		if err := createRequest(tx, &req, nil); err != nil {
+			return err
+		}
+
+		deadline := now.AddDate(0, 0, holdPickupDays)
+		hold.Status = "ready"
+		hold.ReqID = &req.ReqID
+		hold.PickupDeadline = &deadline
+		if err := tx.Save(&hold).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RELEASING A READY HOLD AND PASSING THE COPY TO THE NEXT READER IN LINE. THE
+// ISSUE REQUEST OF THE HOLD, IF STILL PENDING, IS CANCELLED OR EXPIRED WITH IT
+func releaseHold(tx *gorm.DB, hold *models.Hold, status string, actorID *uint) error {
+	wasReady := hold.Status == "ready"
+	hold.Status = status
+	if err := tx.Save(hold).Error; err != nil {
+		return err
+	}
+	if !wasReady {
+		return nil
+	}
+	if hold.ReqID != nil {
+		var req models.RequestEvents
+		if tx.First(&req, *hold.ReqID).Error == nil && req.Status == models.RequestPending {
+			if err := transitionRequest(tx, &req, status, actorID, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return promoteNextHold(tx, hold.ISBN, hold.LibID)
+}
+
+// EXPIRING READY HOLDS WHOSE PICKUP DEADLINE HAS PASSED, A FAILING HOLD DOES NOT STOP THE REST
+func ExpireHolds(db *gorm.DB) error {
+	var expired []models.Hold
+	if err := db.Where("status = ? AND pickup_deadline < ?", "ready", time.Now()).Order("hold_id ASC").Find(&expired).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range expired {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return releaseHold(tx, &expired[i], "expired", nil)
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("hold %d: %w", expired[i].HoldID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PERIODICALLY EXPIRING UNCOLLECTED HOLDS
+func StartHoldExpiryWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := ExpireHolds(config.DB); err != nil {
+				log.Printf("Failed to expire holds: %v", err)
+			}
+		}
+	}()
+}
+
+// LISTING HOLDS OF THE LOGGED IN READER
+func ListMyHolds(c *gin.Context) {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+
+	var holds []models.Hold
+	if err := config.DB.Where("reader_id = ? AND lib_id = ? AND status IN ?", id, libId, []string{"waiting", "ready"}).
+		Order("hold_id ASC").Find(&holds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	details := make([]holdDetails, 0, len(holds))
+	for _, hold := range holds {
+		details = append(details, holdDetails{Hold: hold, Position: holdPosition(config.DB, hold)})
+	}
+	c.JSON(http.StatusOK, gin.H{"holds": details})
+}
+
+// CANCELLING A HOLD
+func CancelHold(c *gin.Context) {
+	holdId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+
+	var hold models.Hold
+	if err := config.DB.Where("hold_id = ? AND reader_id = ? AND lib_id = ? AND status IN ?", holdId, id, libId, []string{"waiting", "ready"}).
+		First(&hold).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+		return
+	}
+
+	readerID := id.(uint)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return releaseHold(tx, &hold, "cancelled", &readerID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hold cancelled successfully"})
+}
+
+// LISTING THE HOLD QUEUE OF THE LIBRARY
+func ListHolds(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	query := config.DB.Where("lib_id = ? AND status IN ?", libId, []string{"waiting", "ready"})
+	if isbnStr := c.Query("isbn"); isbnStr != "" {
+		isbn, err := utils.NormalizeISBN(isbnStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN format"})
+			return
+		}
+		query = query.Where("isbn = ?", isbn)
+	}
+
+	var holds []models.Hold
+	if err := query.Order("isbn ASC, hold_id ASC").Find(&holds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	details := make([]holdDetails, 0, len(holds))
+	for _, hold := range holds {
+		details = append(details, holdDetails{Hold: hold, Position: holdPosition(config.DB, hold)})
+	}
+	c.JSON(http.StatusOK, gin.H{"holds": details})
+}
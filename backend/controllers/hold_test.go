@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRaiseBookRequest_JoinsHoldQueue(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 0,
+	}
+	config.DB.Create(&book)
+	config.DB.Create(&models.Hold{ISBN: book.ISBN, LibID: book.LibID, ReaderID: 3, Status: "waiting"})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
+	caller.POST("/requests/raise", RaiseBookRequest)
+
+	issuePayload := `{
+		"isbn": "9780306406157",
+		"requestType": "issue"
+	}`
+
+	req, _ := http.NewRequest("POST", "/requests/raise", bytes.NewBuffer([]byte(issuePayload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "added to hold queue")
+	assert.Contains(t, w.Body.String(), `"position":2`)
+
+	var count int64
+	config.DB.Model(&models.RequestEvents{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestHandleReturnRequest_PromotesHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutils.SetupTestDB()
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 0,
+	}
+	config.DB.Create(&book)
+
+	config.DB.Create(&models.IssueRegistry{
+		ISBN:      book.ISBN,
+		LibID:     book.LibID,
+		ReaderID:  2,
+		Status:    "issued",
+		IssueDate: time.Now(),
+	})
+
+	returnRequest := models.RequestEvents{
+		BookID:      book.ISBN,
+		ReaderID:    2,
+		LibID:       book.LibID,
+		RequestType: "return",
+		RequestDate: time.Now(),
+	}
+	config.DB.Create(&returnRequest)
+
+	hold := models.Hold{ISBN: book.ISBN, LibID: book.LibID, ReaderID: 3, Status: "waiting"}
+	config.DB.Create(&hold)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("libid", uint(1))
+	handleReturnRequest(c, 1, returnRequest.ReqID)
+
+	var promoted models.Hold
+	config.DB.First(&promoted, hold.HoldID)
+	assert.Equal(t, "ready", promoted.Status)
+	assert.NotNil(t, promoted.PickupDeadline)
+	assert.NotNil(t, promoted.ReqID)
+
+	var issueReq models.RequestEvents
+	err := config.DB.First(&issueReq, *promoted.ReqID).Error
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), issueReq.ReaderID)
+	assert.Equal(t, "issue", issueReq.RequestType)
+}
+
+func TestExpireHolds_PromotesNextInQueue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutils.SetupTestDB()
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 1,
+	}
+	config.DB.Create(&book)
+
+	pending := models.RequestEvents{BookID: book.ISBN, ReaderID: 2, LibID: 1, RequestType: "issue", RequestDate: time.Now()}
+	config.DB.Create(&pending)
+
+	deadline := time.Now().Add(-time.Hour)
+	first := models.Hold{ISBN: book.ISBN, LibID: 1, ReaderID: 2, Status: "ready", ReqID: &pending.ReqID, PickupDeadline: &deadline}
+	config.DB.Create(&first)
+	second := models.Hold{ISBN: book.ISBN, LibID: 1, ReaderID: 3, Status: "waiting"}
+	config.DB.Create(&second)
+
+	err := ExpireHolds(config.DB)
+	assert.Nil(t, err)
+
+	config.DB.First(&first, first.HoldID)
+	assert.Equal(t, "expired", first.Status)
+
+	config.DB.First(&pending, pending.ReqID)
+	assert.Equal(t, models.RequestExpired, pending.Status)
+	assert.Nil(t, pending.AdminID)
+
+	config.DB.First(&second, second.HoldID)
+	assert.Equal(t, "ready", second.Status)
+	assert.NotNil(t, second.ReqID)
+}
+
+func TestExpireHolds_ContinuesPastFailingHold(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutils.SetupTestDB()
+
+	config.DB.Create(&models.Books{ISBN: "9780306406157", Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", LibID: 1})
+	config.DB.Create(&models.Books{ISBN: "9781617294549", Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", LibID: 1})
+
+	deadline := time.Now().Add(-time.Hour)
+	broken := models.Hold{ISBN: "9780306406157", LibID: 1, ReaderID: 2, Status: "ready", PickupDeadline: &deadline}
+	config.DB.Create(&broken)
+	stale := models.Hold{ISBN: "9781617294549", LibID: 1, ReaderID: 3, Status: "ready", PickupDeadline: &deadline}
+	config.DB.Create(&stale)
+
+	// SAVING THE FIRST HOLD FAILS
+	config.DB.Callback().Update().Before("gorm:update").Register("test:fail_hold", func(db *gorm.DB) {
+		if hold, ok := db.Statement.Dest.(*models.Hold); ok && hold.HoldID == broken.HoldID {
+			db.AddError(errors.New("disk full"))
+		}
+	})
+
+	err := ExpireHolds(config.DB)
+	assert.ErrorContains(t, err, fmt.Sprintf("hold %d: disk full", broken.HoldID))
+
+	config.DB.First(&broken, broken.HoldID)
+	assert.Equal(t, "ready", broken.Status)
+	config.DB.First(&stale, stale.HoldID)
+	assert.Equal(t, "expired", stale.Status)
+}
+
+func TestCancelHold(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	hold := models.Hold{ISBN: "9780306406157", LibID: 1, ReaderID: 2, Status: "waiting"}
+	config.DB.Create(&hold)
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
+	caller.DELETE("/holds/:id", CancelHold)
+
+	req, _ := http.NewRequest("DELETE", "/holds/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hold cancelled successfully")
+
+	config.DB.First(&hold, hold.HoldID)
+	assert.Equal(t, "cancelled", hold.Status)
+}
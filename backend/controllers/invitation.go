@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+var errInvalidInvitation = errors.New("Invalid or expired invitation")
+
+// Page of the frontend that takes the token and the chosen password
+func invitationLink(token string) string {
+	base := os.Getenv("INVITE_URL")
+	if base == "" {
+		base = "http://localhost:3000/accept-invite"
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// Mails the invitation link through the configured sender
+func sendInvitation(invite models.Invitation, token string) error {
+	var library models.Library
+	config.DB.Select("name").Where("lib_id = ?", invite.LibID).Take(&library)
+
+	return mailer.Default.Send(mailer.Message{
+		To:      invite.Email,
+		Subject: "You are invited to " + library.Name,
+		Body: fmt.Sprintf("Hello %s,\n\nYou have been invited to %s as %s. Use the link below to choose your password; it expires on %s.\n\n%s\n",
+			invite.Name, library.Name, strings.ToLower(invite.Role), invite.ExpiresAt.Format("2 January 2006"), invitationLink(token)),
+	})
+}
+
+// INVITING A NEW ACCOUNT, SHARED BY THE ADMIN AND READER ENDPOINTS
+func invite(c *gin.Context, role string) {
+	var input struct {
+		Name          string `json:"name" binding:"required"`
+		Email         string `json:"email" binding:"required,email"`
+		ContactNumber string `json:"contactNumber" binding:"required"`
+		ReaderType    string `json:"reader_type"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// THE INVITING ACCOUNT, THE ROUTE ALREADY CHECKED THE PERMISSION
+	inviterEmail, _ := c.Get("email")
+	var inviter models.User
+	if err := config.DB.Where("email = ?", inviterEmail).First(&inviter).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var taken int64
+	config.DB.Model(&models.User{}).Where("email = ?", input.Email).Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+	config.DB.Model(&models.Invitation{}).
+		Where("lib_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", inviter.LibID, input.Email, time.Now()).
+		Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An invitation is already pending for this email"})
+		return
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invitation := models.Invitation{
+		LibID:         inviter.LibID,
+		Name:          input.Name,
+		Email:         input.Email,
+		ContactNumber: input.ContactNumber,
+		Role:          role,
+		InvitedBy:     inviter.ID,
+		TokenHash:     hash,
+		ExpiresAt:     time.Now().Add(invitationTTL),
+	}
+	if role == permissions.Reader {
+		invitation.ReaderType = input.ReaderType
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "invitation.create", "invitation", invitation.InviteID, nil, invitation)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	if err := sendInvitation(invitation, token); err != nil {
+		log.Printf("Failed to send invitation mail: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Invitation created but the email could not be sent, resend it later", "invitation": invitation})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation sent", "invitation": invitation})
+}
+
+// Invitation of the route's :id in the caller's library that may be acted on
+func findInvitation(c *gin.Context) (models.Invitation, bool) {
+	libId, _ := c.Get("libid")
+	var invitation models.Invitation
+	if err := config.DB.Where("invite_id = ? AND lib_id = ?", c.Param("id"), libId).First(&invitation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return invitation, false
+	}
+	if invitation.Role != permissions.Reader && !granted(c, permissions.StaffManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can manage staff invitations"})
+		return invitation, false
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is no longer pending"})
+		return invitation, false
+	}
+	return invitation, true
+}
+
+// LISTING INVITATIONS OF THE LIBRARY THAT HAVE NOT BEEN ACCEPTED OR REVOKED
+func ListInvitations(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	var invitations []models.Invitation
+	if err := config.DB.Where("lib_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", libId).
+		Order("created_at DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	results := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		results = append(results, gin.H{"invitation": invitation, "expired": !invitation.Pending(now)})
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": results})
+}
+
+// SENDING AN INVITATION AGAIN WITH A NEW LINK, THE OLD ONE STOPS WORKING
+func ResendInvitation(c *gin.Context) {
+	invitation, ok := findInvitation(c)
+	if !ok {
+		return
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	before := invitation
+	invitation.TokenHash = hash
+	invitation.ExpiresAt = time.Now().Add(invitationTTL)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invitation).Updates(map[string]interface{}{"token_hash": hash, "expires_at": invitation.ExpiresAt}).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "invitation.resend", "invitation", invitation.InviteID, before, invitation)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := sendInvitation(invitation, token); err != nil {
+		log.Printf("Failed to send invitation mail: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The email could not be sent, try again later"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation sent", "invitation": invitation})
+}
+
+// REVOKING A PENDING INVITATION
+func RevokeInvitation(c *gin.Context) {
+	invitation, ok := findInvitation(c)
+	if !ok {
+		return
+	}
+	before := invitation
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&invitation).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "invitation.revoke", "invitation", invitation.InviteID, before, invitation)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// ACCEPTING AN INVITATION BY CHOOSING A PASSWORD
+func AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitation models.Invitation
+	if err := config.DB.Where("token_hash = ?", utils.HashToken(input.Token)).First(&invitation).Error; err != nil ||
+		!invitation.Pending(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidInvitation.Error()})
+		return
+	}
+	if !acceptablePassword(c, invitation.LibID, nil, input.Password) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bcrypt failed to generate password!"})
+		return
+	}
+
+	user := models.User{
+		Name:           invitation.Name,
+		Email:          invitation.Email,
+		Password:       string(hashedPassword),
+		Contact_number: invitation.ContactNumber,
+		Role:           invitation.Role,
+		ReaderType:     invitation.ReaderType,
+		LibID:          invitation.LibID,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// SINGLE USE, EVEN WHEN TWO ACCEPTANCES RACE
+		result := tx.Model(&models.Invitation{}).Where("invite_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.InviteID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidInvitation
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, errInvalidInvitation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		// THE EMAIL WAS TAKEN SINCE THE INVITATION WAS SENT
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account created, please log in"})
+}
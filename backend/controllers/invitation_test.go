@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// ROUTES AS THE ADMIN (ID 2) OR THE OWNER (ID 1) OF LIBRARY 1
+func setupInvitations(t *testing.T, callerID uint, email, role string) (*gin.Engine, *mailer.Memory) {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@example.com", Contact_number: "1", Role: "Owner", LibID: 1},
+			{ID: 2, Name: "Admin", Email: "admin@example.com", Contact_number: "2", Role: "Admin", LibID: 1},
+		},
+	})
+
+	outbox := &mailer.Memory{}
+	previous := mailer.Default
+	mailer.Default = outbox
+	t.Cleanup(func() { mailer.Default = previous })
+
+	router.POST("/auth/login", Login)
+	router.POST("/auth/invitations/accept", AcceptInvitation)
+	staff := testutils.AsCaller(router, "/staff", testutils.Caller{ID: callerID, LibID: 1, Email: email, Role: role})
+	staff.POST("/create-admin", CreateAdminUser)
+	staff.POST("/create-reader", CreateReaderUser)
+	staff.GET("/invitations", ListInvitations)
+	staff.POST("/invitations/:id/resend", ResendInvitation)
+	staff.DELETE("/invitations/:id", RevokeInvitation)
+	return router, outbox
+}
+
+func acceptInvitation(router *gin.Engine, token string) int {
+	return postJSON(router, "/auth/invitations/accept", `{"token": "`+token+`", "password": "readerpassword"}`).Code
+}
+
+func deleteRequest(router *gin.Engine, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("DELETE", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+const readerInvite = `{"name": "Rita", "email": "rita@example.com", "contactNumber": "3", "reader_type": "student"}`
+
+func TestInvitation_AcceptCreatesAccount(t *testing.T) {
+	router, outbox := setupInvitations(t, 2, "admin@example.com", "Admin")
+
+	w := postJSON(router, "/staff/create-reader", readerInvite)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "token")
+	assert.Equal(t, "rita@example.com", outbox.Messages()[0].To)
+	assert.Contains(t, outbox.Messages()[0].Body, "Test Library")
+	token := resetTokenOf(t, outbox.Messages()[0])
+
+	// A PENDING INVITATION BLOCKS A SECOND ONE
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/staff/create-reader", readerInvite).Code)
+
+	assert.Equal(t, http.StatusBadRequest, acceptInvitation(router, "not-a-token"))
+	assert.Equal(t, http.StatusOK, acceptInvitation(router, token))
+	assert.Equal(t, http.StatusBadRequest, acceptInvitation(router, token))
+
+	var rita models.User
+	assert.NoError(t, config.DB.Where("email = ?", "rita@example.com").First(&rita).Error)
+	assert.Equal(t, "Reader", rita.Role)
+	assert.Equal(t, "student", rita.ReaderType)
+	assert.Equal(t, uint(1), rita.LibID)
+	assert.Equal(t, http.StatusOK, loginAs(router, "rita@example.com", "readerpassword").Code)
+
+	// THE EMAIL NOW BELONGS TO A USER
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/staff/create-reader", readerInvite).Code)
+}
+
+func TestInvitation_Expired(t *testing.T) {
+	router, outbox := setupInvitations(t, 2, "admin@example.com", "Admin")
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/create-reader", readerInvite).Code)
+	config.DB.Model(&models.Invitation{}).Where("invite_id = ?", 1).Update("expires_at", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusBadRequest, acceptInvitation(router, resetTokenOf(t, outbox.Messages()[0])))
+
+	w := getRequest(router, "/staff/invitations")
+	invitations := decode(t, w.Body.Bytes())["invitations"].([]interface{})
+	assert.Len(t, invitations, 1)
+	assert.Equal(t, true, invitations[0].(map[string]interface{})["expired"])
+
+	// RESENDING RENEWS THE LINK, THE OLD ONE STAYS DEAD
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/invitations/1/resend", "").Code)
+	assert.Equal(t, http.StatusBadRequest, acceptInvitation(router, resetTokenOf(t, outbox.Messages()[0])))
+	assert.Equal(t, http.StatusOK, acceptInvitation(router, resetTokenOf(t, outbox.Messages()[1])))
+
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/staff/invitations/1/resend", "").Code)
+}
+
+func TestInvitation_Revoke(t *testing.T) {
+	router, outbox := setupInvitations(t, 2, "admin@example.com", "Admin")
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/create-reader", readerInvite).Code)
+	w := deleteRequest(router, "/staff/invitations/1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, acceptInvitation(router, resetTokenOf(t, outbox.Messages()[0])))
+	assert.Empty(t, decode(t, getRequest(router, "/staff/invitations").Body.Bytes())["invitations"])
+	assert.Equal(t, http.StatusNotFound, deleteRequest(router, "/staff/invitations/9").Code)
+
+	// A REVOKED INVITATION DOES NOT BLOCK A NEW ONE
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/create-reader", readerInvite).Code)
+}
+
+func TestInvitation_StaffInvitesNeedOwner(t *testing.T) {
+	router, _ := setupInvitations(t, 2, "admin@example.com", "Admin")
+	config.DB.Create(&models.Invitation{InviteID: 1, LibID: 1, Name: "New Admin", Email: "new@example.com", ContactNumber: "4",
+		Role: "Admin", InvitedBy: 1, TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)})
+
+	assert.Equal(t, http.StatusForbidden, postJSON(router, "/staff/invitations/1/resend", "").Code)
+	assert.Equal(t, http.StatusForbidden, deleteRequest(router, "/staff/invitations/1").Code)
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ITEM STATUSES THAT STILL COUNT TOWARDS THE TOTAL COPIES OF A BOOK
+var ownedItemStatuses = []string{"available", "on_loan", "damaged"}
+
+// RECOMPUTING THE COPY COUNTERS OF A BOOK FROM THE STATUS OF ITS ITEMS
+func syncCopyCounts(tx *gorm.DB, isbn string, libID uint) error {
+	var total, available int64
+	if err := tx.Model(&models.BookItem{}).Where("isbn = ? AND lib_id = ? AND status IN ?", isbn, libID, ownedItemStatuses).Count(&total).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.BookItem{}).Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, "available").Count(&available).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Books{}).Where("isbn = ? AND lib_id = ?", isbn, libID).
+		UpdateColumns(map[string]interface{}{"total_copies": total, "available_copies": available}).Error
+}
+
+// ADDING NEW COPIES OF A BOOK WITH GENERATED BARCODES
+func addItems(tx *gorm.DB, isbn string, libID uint, copies uint) error {
+	var existing int64
+	if err := tx.Model(&models.BookItem{}).Where("isbn = ? AND lib_id = ?", isbn, libID).Count(&existing).Error; err != nil {
+		return err
+	}
+
+	n := existing
+	for added := uint(0); added < copies; added++ {
+		var barcode string
+		for {
+			n++
+			barcode = models.ItemBarcode(isbn, n)
+			var taken int64
+			tx.Model(&models.BookItem{}).Where("barcode = ? AND lib_id = ?", barcode, libID).Count(&taken)
+			if taken == 0 {
+				break
+			}
+		}
+
+		item := models.BookItem{Barcode: barcode, ISBN: isbn, LibID: libID, Condition: "new", Status: "available"}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+	return syncCopyCounts(tx, isbn, libID)
+}
+
+// WITHDRAWING AVAILABLE COPIES OF A BOOK
+func withdrawItems(tx *gorm.DB, isbn string, libID uint, copies uint) error {
+	var items []models.BookItem
+	if err := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, "available").
+		Order("item_id DESC").Limit(int(copies)).Find(&items).Error; err != nil {
+		return err
+	}
+	if uint(len(items)) < copies {
+		return errors.New("not enough available copies to withdraw")
+	}
+
+	for _, item := range items {
+		if err := tx.Model(&item).Update("status", "withdrawn").Error; err != nil {
+			return err
+		}
+	}
+	return syncCopyCounts(tx, isbn, libID)
+}
+
+// PICKING THE COPY TO LEND: THE SCANNED BARCODE, OR ANY AVAILABLE COPY
+func checkoutItem(tx *gorm.DB, isbn string, libID uint, barcode string) (models.BookItem, error) {
+	var item models.BookItem
+	query := tx.Where("isbn = ? AND lib_id = ? AND status = ?", isbn, libID, "available")
+	if barcode != "" {
+		query = query.Where("barcode = ?", barcode)
+	}
+	if err := query.Order("item_id ASC").First(&item).Error; err != nil {
+		return item, requestConflict{"no copies available"}
+	}
+
+	if err := tx.Model(&item).Update("status", "on_loan").Error; err != nil {
+		return item, err
+	}
+	return item, syncCopyCounts(tx, isbn, libID)
+}
+
+// PUTTING A RETURNED COPY BACK ON THE SHELF
+func checkinItem(tx *gorm.DB, issueReg models.IssueRegistry) error {
+	var item models.BookItem
+	query := tx.Where("isbn = ? AND lib_id = ? AND status = ?", issueReg.ISBN, issueReg.LibID, "on_loan")
+	if issueReg.ItemID != nil {
+		query = query.Where("item_id = ?", *issueReg.ItemID)
+	}
+	if err := query.Order("item_id ASC").First(&item).Error; err != nil {
+		return errors.New("no copy on loan for this book")
+	}
+
+	if err := tx.Model(&item).Update("status", "available").Error; err != nil {
+		return err
+	}
+	return syncCopyCounts(tx, issueReg.ISBN, issueReg.LibID)
+}
+
+// LISTING THE COPIES OF A BOOK
+func ListItems(c *gin.Context) {
+	isbn, err := utils.NormalizeISBN(c.Param("isbn"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN format"})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var items []models.BookItem
+	if err := config.DB.Where("isbn = ? AND lib_id = ?", isbn, libId).Order("item_id ASC").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// ADDING A COPY OF A BOOK WITH ITS OWN BARCODE
+func AddItem(c *gin.Context) {
+	isbn, err := utils.NormalizeISBN(c.Param("isbn"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN format"})
+		return
+	}
+
+	var input struct {
+		Barcode       string `json:"barcode" binding:"required"`
+		ShelfLocation string `json:"shelf_location"`
+		Condition     string `json:"condition" binding:"omitempty,oneof=new good fair poor damaged"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var book models.Books
+	if err := config.DB.Where("isbn = ? AND lib_id = ?", isbn, libId).First(&book).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return
+	}
+
+	item := models.BookItem{
+		Barcode:       input.Barcode,
+		ISBN:          book.ISBN,
+		LibID:         book.LibID,
+		ShelfLocation: input.ShelfLocation,
+		Condition:     input.Condition,
+		Status:        "available",
+	}
+	if item.Condition == "" {
+		item.Condition = "new"
+	}
+	if item.Condition == "damaged" {
+		item.Status = "damaged"
+	}
+
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		tx.Model(&models.BookItem{}).Where("barcode = ? AND lib_id = ?", item.Barcode, item.LibID).Count(&taken)
+		if taken > 0 {
+			return errors.New("barcode already in use")
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "item.create", "item", item.ItemID, nil, item); err != nil {
+			return err
+		}
+		if err := syncCopyCounts(tx, book.ISBN, book.LibID); err != nil {
+			return err
+		}
+		return promoteNextHold(tx, book.ISBN, book.LibID)
+	})
+
+	if txErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": txErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Item added successfully", "item": item})
+}
+
+// UPDATING SHELF LOCATION, CONDITION OR STATUS OF A COPY
+func UpdateItem(c *gin.Context) {
+	itemId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var input struct {
+		ShelfLocation *string `json:"shelf_location"`
+		Condition     string  `json:"condition" binding:"omitempty,oneof=new good fair poor damaged"`
+		Status        string  `json:"status" binding:"omitempty,oneof=available damaged lost withdrawn"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.ShelfLocation == nil && input.Condition == "" && input.Status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var item models.BookItem
+	if err := config.DB.Where("item_id = ? AND lib_id = ?", itemId, libId).First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	// COPIES ON LOAN CHANGE STATUS ONLY THROUGH RETURNS
+	if input.Status != "" && item.Status == "on_loan" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item is currently on loan"})
+		return
+	}
+
+	before := item
+	if input.ShelfLocation != nil {
+		item.ShelfLocation = *input.ShelfLocation
+	}
+	if input.Condition != "" {
+		item.Condition = input.Condition
+	}
+	if input.Status != "" {
+		item.Status = input.Status
+	}
+
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "item.update", "item", item.ItemID, before, item); err != nil {
+			return err
+		}
+		if err := syncCopyCounts(tx, item.ISBN, item.LibID); err != nil {
+			return err
+		}
+		return promoteNextHold(tx, item.ISBN, item.LibID)
+	})
+
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": txErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully", "item": item})
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookCreation_MaterialisesItems(t *testing.T) {
+	testutils.SetupTestDB()
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     3,
+		Available_copies: 2,
+	}
+	config.DB.Create(&book)
+
+	var items []models.BookItem
+	config.DB.Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).Order("item_id ASC").Find(&items)
+	assert.Len(t, items, 3)
+	assert.Equal(t, "9780306406157-0001", items[0].Barcode)
+	assert.Equal(t, "available", items[1].Status)
+	assert.Equal(t, "on_loan", items[2].Status)
+}
+
+func TestUpdateItem_DamagedCopyLeavesCirculation(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     2,
+		Available_copies: 2,
+	}
+	config.DB.Create(&book)
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.PATCH("/items/:id", UpdateItem)
+
+	payload := `{"condition": "damaged", "status": "damaged", "shelf_location": "Repairs"}`
+	req, _ := http.NewRequest("PATCH", "/items/1", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Item updated successfully")
+
+	var updated models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&updated)
+	assert.Equal(t, uint(2), updated.Total_copies)
+	assert.Equal(t, uint(1), updated.Available_copies)
+
+	// LOST COPIES NO LONGER COUNT TOWARDS THE TOTAL
+	req, _ = http.NewRequest("PATCH", "/items/1", bytes.NewBuffer([]byte(`{"status": "lost"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&updated)
+	assert.Equal(t, uint(1), updated.Total_copies)
+}
+
+func TestProcessRequest_LendsScannedCopy(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     3,
+		Available_copies: 3,
+	}
+	config.DB.Create(&book)
+	config.DB.Create(&models.RequestEvents{BookID: book.ISBN, ReaderID: 2, LibID: 1, RequestType: "issue", RequestDate: time.Now()})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
+	caller.POST("/requests/process", ProcessRequest)
+
+	payload := `{"action": "approve", "reqtype": "issue", "reqid": 1, "barcode": "9780306406157-0002"}`
+	req, _ := http.NewRequest("POST", "/requests/process", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loan models.IssueRegistry
+	config.DB.Where("reader_id = ?", 2).First(&loan)
+	assert.NotNil(t, loan.ItemID)
+
+	var item models.BookItem
+	config.DB.First(&item, *loan.ItemID)
+	assert.Equal(t, "9780306406157-0002", item.Barcode)
+	assert.Equal(t, "on_loan", item.Status)
+
+	var updated models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&updated)
+	assert.Equal(t, uint(2), updated.Available_copies)
+}
+
+func TestAddItem_DuplicateBarcode(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     1,
+		Available_copies: 1,
+	}
+	config.DB.Create(&book)
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.POST("/books/:isbn/items", AddItem)
+
+	req, _ := http.NewRequest("POST", "/books/9780306406157/items", bytes.NewBuffer([]byte(`{"barcode": "LIB-0042", "shelf_location": "A3"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("POST", "/books/9780306406157/items", bytes.NewBuffer([]byte(`{"barcode": "LIB-0042"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "barcode already in use")
+
+	var updated models.Books
+	config.DB.Where("isbn = ? AND lib_id = ?", "9780306406157", 1).First(&updated)
+	assert.Equal(t, uint(2), updated.Total_copies)
+	assert.Equal(t, uint(2), updated.Available_copies)
+}
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+)
+
+// PUBLIC KEYS ACCESS TOKENS ARE SIGNED WITH, FOR SERVICES VERIFYING THEM.
+// A NEW KEY IS LISTED AHEAD OF SIGNING, SO CACHING FOR AN HOUR IS SAFE
+func JWKS(c *gin.Context) {
+	published := utils.Keys.Published(time.Now())
+	keys := make([]map[string]string, 0, len(published))
+	for _, key := range published {
+		keys = append(keys, key.JWK())
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How failed logins under a scope are slowed down and then locked out
+type throttleRule struct {
+	freeAttempts int // failures before any delay
+	lockoutAfter int // failures that lock the key out
+	lockout      time.Duration
+}
+
+var throttleRules = map[string]throttleRule{
+	models.ThrottleAccount: {freeAttempts: 3, lockoutAfter: 10, lockout: 15 * time.Minute},
+	// ONE IP MAY BE A WHOLE OFFICE BEHIND NAT, SO IT GETS MORE ROOM
+	models.ThrottleIP: {freeAttempts: 10, lockoutAfter: 50, lockout: 15 * time.Minute},
+}
+
+const (
+	// Failures older than this are forgotten
+	throttleWindow   = time.Hour
+	maxThrottleDelay = time.Minute
+)
+
+const tooManyAttemptsMessage = "Too many failed login attempts, try again later"
+
+type loginKey struct {
+	scope string
+	key   string
+}
+
+// Account and client a login attempt is counted against
+func loginKeysOf(c *gin.Context, email string) []loginKey {
+	return []loginKey{
+		{models.ThrottleAccount, strings.ToLower(strings.TrimSpace(email))},
+		{models.ThrottleIP, c.ClientIP()},
+	}
+}
+
+// Failures that still count at a moment
+func activeFailures(t models.LoginThrottle, now time.Time) int {
+	if now.Sub(t.LastFailureAt) > throttleWindow {
+		return 0
+	}
+	return t.Failures
+}
+
+// Moment the key may try again; zero when it is not held back. Every failure
+// past the free ones doubles the delay, up to a minute, until the lockout
+func retryAt(t models.LoginThrottle, now time.Time) time.Time {
+	if t.LockedUntil != nil && t.LockedUntil.After(now) {
+		return *t.LockedUntil
+	}
+	extra := activeFailures(t, now) - throttleRules[t.Scope].freeAttempts
+	if extra <= 0 {
+		return time.Time{}
+	}
+	delay := maxThrottleDelay
+	if extra <= 6 {
+		delay = min(time.Second<<(extra-1), maxThrottleDelay)
+	}
+	return t.LastFailureAt.Add(delay)
+}
+
+// Longest wait any of the keys is under
+func loginRetryAfter(db *gorm.DB, keys []loginKey, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		var t models.LoginThrottle
+		if err := db.Where("scope = ? AND key = ?", k.scope, k.key).First(&t).Error; err != nil {
+			continue
+		}
+		if until := retryAt(t, now); until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+	return wait
+}
+
+// Counts a failed login against each key, locking out those that reach the
+// limit. Both steps are single statements, so concurrent failures all count
+func recordLoginFailure(db *gorm.DB, keys []loginKey, userID *uint, now time.Time) {
+	for _, k := range keys {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			t := models.LoginThrottle{Scope: k.scope, Key: k.key, Failures: 1, LastFailureAt: now}
+			if k.scope == models.ThrottleAccount {
+				t.UserID = userID
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "scope"}, {Name: "key"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					// FAILURES OUTSIDE THE WINDOW ARE FORGOTTEN
+					"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", now.Add(-throttleWindow)),
+					"last_failure_at": now,
+					"user_id":         gorm.Expr("COALESCE(excluded.user_id, login_throttles.user_id)"),
+					"updated_at":      now,
+				}),
+			}).Create(&t).Error; err != nil {
+				return err
+			}
+
+			// THE COUNT STARTS OVER ONCE THE LOCKOUT IS SERVED
+			rule := throttleRules[k.scope]
+			return tx.Model(&models.LoginThrottle{}).
+				Where("scope = ? AND key = ? AND failures >= ?", k.scope, k.key, rule.lockoutAfter).
+				Updates(map[string]interface{}{"locked_until": now.Add(rule.lockout), "failures": 0}).Error
+		})
+		if err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+	}
+}
+
+// Forgets the failed logins of an account
+func clearAccountLockout(db *gorm.DB, userID uint) error {
+	return db.Where("scope = ? AND user_id = ?", models.ThrottleAccount, userID).Delete(&models.LoginThrottle{}).Error
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Hash to compare against for unknown emails, so they take as long as a wrong password
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+		if err != nil {
+			// WITHOUT IT UNKNOWN EMAILS WOULD ANSWER FASTER THAN KNOWN ONES
+			log.Panicf("bcrypt failed to hash the dummy password: %v", err)
+		}
+		dummyHash = hash
+	})
+	return dummyHash
+}
+
+// LISTING ACCOUNTS OF THE LIBRARY HELD BACK BY FAILED LOGINS
+func ListLockouts(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	var throttles []models.LoginThrottle
+	if err := config.DB.Preload("User").
+		Joins("JOIN users ON users.id = login_throttles.user_id").
+		Where("login_throttles.scope = ? AND users.lib_id = ?", models.ThrottleAccount, libId).
+		Order("login_throttles.last_failure_at DESC").
+		Find(&throttles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	lockouts := []gin.H{}
+	for _, t := range throttles {
+		locked := t.LockedUntil != nil && t.LockedUntil.After(now)
+		if !locked && activeFailures(t, now) == 0 {
+			continue
+		}
+		entry := gin.H{
+			"userID":          t.User.ID,
+			"email":           t.User.Email,
+			"role":            t.User.Role,
+			"failures":        activeFailures(t, now),
+			"last_failure_at": t.LastFailureAt,
+			"locked":          locked,
+			"retry_at":        nil,
+		}
+		if until := retryAt(t, now); until.After(now) {
+			entry["retry_at"] = until
+		}
+		lockouts = append(lockouts, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// CLEARING THE FAILED LOGINS OF A USER OF THE LIBRARY
+func ClearLockout(c *gin.Context) {
+	user, ok := findLibraryUser(c)
+	if !ok {
+		return
+	}
+	if !canManage(c, user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can clear lockouts of staff"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearAccountLockout(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.lockout_clear", "user", user.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupThrottle(t *testing.T, role string) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Admin", Email: "admin@example.com", Contact_number: "1", Role: "Admin", LibID: 1},
+			{ID: 2, Name: "Reader", Email: "reader@example.com", Contact_number: "2", Role: "Reader", LibID: 1},
+		},
+	})
+	router.POST("/auth/login", Login)
+	staff := testutils.AsCaller(router, "/admin", testutils.Caller{ID: 1, LibID: 1, Role: role})
+	staff.GET("/lockouts", ListLockouts)
+	staff.DELETE("/users/:id/lockout", ClearLockout)
+	return router
+}
+
+func loginAs(router *gin.Engine, email, password string) *httptest.ResponseRecorder {
+	return postJSON(router, "/auth/login", `{"email": "`+email+`", "password": "`+password+`"}`)
+}
+
+// MOVES THE FAILURES OF A KEY INTO THE PAST
+func ageThrottle(scope, key string, by time.Duration) {
+	var t models.LoginThrottle
+	config.DB.Where("scope = ? AND key = ?", scope, key).First(&t)
+	config.DB.Model(&t).Update("last_failure_at", t.LastFailureAt.Add(-by))
+}
+
+func TestLogin_UnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	router := setupThrottle(t, "Admin")
+
+	unknown := loginAs(router, "nobody@example.com", "password123")
+	wrong := loginAs(router, "reader@example.com", "wrong")
+
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, wrong.Code, unknown.Code)
+	assert.Equal(t, wrong.Body.String(), unknown.Body.String())
+}
+
+func TestLogin_FailuresAreDelayedProgressively(t *testing.T) {
+	router := setupThrottle(t, "Admin")
+
+	// THE FAILURE AFTER THE FREE ONES STARTS THE DELAY
+	for i := 0; i <= throttleRules[models.ThrottleAccount].freeAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, loginAs(router, "reader@example.com", "wrong").Code)
+	}
+
+	// EVEN THE RIGHT PASSWORD WAITS OUT THE DELAY
+	w := loginAs(router, "Reader@Example.com ", "password123")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), tooManyAttemptsMessage)
+
+	ageThrottle(models.ThrottleAccount, "reader@example.com", time.Second)
+	assert.Equal(t, http.StatusUnauthorized, loginAs(router, "reader@example.com", "wrong").Code)
+	assert.Equal(t, "2", loginAs(router, "reader@example.com", "password123").Header().Get("Retry-After"))
+
+	// A SUCCESSFUL LOGIN FORGETS THE ACCOUNT'S FAILURES
+	ageThrottle(models.ThrottleAccount, "reader@example.com", 2*time.Second)
+	assert.Equal(t, http.StatusOK, loginAs(router, "reader@example.com", "password123").Code)
+	var count int64
+	config.DB.Model(&models.LoginThrottle{}).Where("scope = ?", models.ThrottleAccount).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestLogin_LockoutIsUniform(t *testing.T) {
+	router := setupThrottle(t, "Admin")
+	rule := throttleRules[models.ThrottleAccount]
+
+	for _, email := range []string{"reader@example.com", "nobody@example.com"} {
+		keys := []loginKey{{models.ThrottleAccount, email}}
+		for i := 0; i < rule.lockoutAfter; i++ {
+			recordLoginFailure(config.DB, keys, nil, time.Now())
+		}
+	}
+
+	registered := loginAs(router, "reader@example.com", "password123")
+	unknown := loginAs(router, "nobody@example.com", "password123")
+	assert.Equal(t, http.StatusTooManyRequests, registered.Code)
+	assert.Equal(t, registered.Body.String(), unknown.Body.String())
+	assert.Equal(t, registered.Header().Get("Retry-After"), unknown.Header().Get("Retry-After"))
+}
+
+func TestLogin_ClientIPIsThrottled(t *testing.T) {
+	router := setupThrottle(t, "Admin")
+	rule := throttleRules[models.ThrottleIP]
+
+	// A SPRAY OVER MANY ACCOUNTS FROM ONE CLIENT
+	for i := 0; i <= rule.freeAttempts; i++ {
+		email := "user" + string(rune('a'+i)) + "@example.com"
+		assert.Equal(t, http.StatusUnauthorized, loginAs(router, email, "password123").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, loginAs(router, "admin@example.com", "password123").Code)
+}
+
+func TestRetryAt(t *testing.T) {
+	now := time.Now()
+	throttle := models.LoginThrottle{Scope: models.ThrottleAccount, Failures: 3, LastFailureAt: now}
+	assert.True(t, retryAt(throttle, now).IsZero())
+
+	throttle.Failures = 9
+	assert.Equal(t, now.Add(32*time.Second), retryAt(throttle, now))
+
+	// OLD FAILURES NO LONGER COUNT
+	throttle.LastFailureAt = now.Add(-2 * throttleWindow)
+	assert.True(t, retryAt(throttle, now).IsZero())
+
+	until := now.Add(time.Minute)
+	throttle.LockedUntil = &until
+	assert.Equal(t, until, retryAt(throttle, now))
+}
+
+func TestLockouts_ListAndClear(t *testing.T) {
+	router := setupThrottle(t, "Admin")
+	for _, email := range []string{"reader@example.com", "admin@example.com"} {
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, loginAs(router, email, "wrong").Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/lockouts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	lockouts := decode(t, w.Body.Bytes())["lockouts"].([]interface{})
+	assert.Len(t, lockouts, 2)
+	assert.Equal(t, float64(2), lockouts[0].(map[string]interface{})["failures"])
+
+	// ADMINS MAY NOT CLEAR STAFF LOCKOUTS
+	req, _ = http.NewRequest("DELETE", "/admin/users/1/lockout", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req, _ = http.NewRequest("DELETE", "/admin/users/2/lockout", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var remaining []models.LoginThrottle
+	config.DB.Where("scope = ?", models.ThrottleAccount).Find(&remaining)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, "admin@example.com", remaining[0].Key)
+}
+
+func TestRecordLoginFailure_CountsInTheDatabase(t *testing.T) {
+	setupThrottle(t, "Admin")
+	keys := []loginKey{{models.ThrottleAccount, "reader@example.com"}}
+	readerID := uint(2)
+
+	recordLoginFailure(config.DB, keys, &readerID, time.Now())
+	recordLoginFailure(config.DB, keys, nil, time.Now())
+	var throttle models.LoginThrottle
+	config.DB.Where("scope = ? AND key = ?", models.ThrottleAccount, "reader@example.com").First(&throttle)
+	assert.Equal(t, 2, throttle.Failures)
+	assert.Equal(t, readerID, *throttle.UserID)
+
+	// A FAILURE AFTER THE WINDOW STARTS THE COUNT OVER
+	ageThrottle(models.ThrottleAccount, "reader@example.com", throttleWindow+time.Minute)
+	recordLoginFailure(config.DB, keys, nil, time.Now())
+	config.DB.First(&throttle, throttle.ThrottleID)
+	assert.Equal(t, 1, throttle.Failures)
+	assert.Nil(t, throttle.LockedUntil)
+}
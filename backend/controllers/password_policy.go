@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/breach"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Most old passwords kept per account, whatever the policy asks for
+const maxPasswordHistory = 24
+
+// POLICY OF A LIBRARY, OR THE DEFAULT WHEN IT HAS NOT SET ONE
+func passwordPolicyOf(db *gorm.DB, libID uint) models.PasswordPolicy {
+	policy := models.DefaultPasswordPolicy(libID)
+	db.Where("lib_id = ?", libID).Take(&policy)
+	return policy
+}
+
+// Reasons a new password is refused. The user is nil for accounts being created
+func passwordProblems(db *gorm.DB, libID uint, user *models.User, password string) ([]string, error) {
+	policy := passwordPolicyOf(db, libID)
+	problems := policy.Violations(password)
+
+	if policy.RejectBreached {
+		breached, err := breach.Contains(breach.Default, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			problems = append(problems, "Password appears in a list of breached passwords")
+		}
+	}
+
+	if user != nil && policy.HistorySize > 0 {
+		reused, err := passwordReused(db, *user, password, policy.HistorySize)
+		if err != nil {
+			return nil, err
+		}
+		if reused {
+			problems = append(problems, fmt.Sprintf("Password must differ from the last %d passwords", policy.HistorySize))
+		}
+	}
+	return problems, nil
+}
+
+// Whether the password is the current one or among the n-1 before it
+func passwordReused(db *gorm.DB, user models.User, password string, n int) (bool, error) {
+	hashes := []string{user.Password}
+	var history []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("history_id DESC").Limit(n - 1).Find(&history).Error; err != nil {
+		return false, err
+	}
+	for _, h := range history {
+		hashes = append(hashes, h.PasswordHash)
+	}
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Keeps the hash of a replaced password, dropping the oldest past the limit
+func rememberPassword(tx *gorm.DB, userID uint, oldHash string) error {
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: oldHash}).Error; err != nil {
+		return err
+	}
+	var keep []uint
+	if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("history_id DESC").Limit(maxPasswordHistory).Pluck("history_id", &keep).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND history_id NOT IN ?", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// Answers with every rule the password breaks
+func rejectPassword(c *gin.Context, problems []string) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": strings.Join(problems, "; "), "violations": problems})
+}
+
+// Checks a new password, answering for the handler when it is refused
+func acceptablePassword(c *gin.Context, libID uint, user *models.User, password string) bool {
+	problems, err := passwordProblems(config.DB, libID, user, password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(problems) > 0 {
+		rejectPassword(c, problems)
+		return false
+	}
+	return true
+}
+
+// VIEWING THE PASSWORD POLICY OF THE LIBRARY
+func GetPasswordPolicy(c *gin.Context) {
+	libId, _ := c.Get("libid")
+	c.JSON(http.StatusOK, gin.H{"policy": passwordPolicyOf(config.DB, libId.(uint))})
+}
+
+// CHANGING THE PASSWORD POLICY OF THE LIBRARY
+func UpdatePasswordPolicy(c *gin.Context) {
+	var input struct {
+		MinLength      *int  `json:"min_length" binding:"omitempty,min=6,max=72"`
+		RequireUpper   *bool `json:"require_upper"`
+		RequireLower   *bool `json:"require_lower"`
+		RequireDigit   *bool `json:"require_digit"`
+		RequireSymbol  *bool `json:"require_symbol"`
+		HistorySize    *int  `json:"history_size" binding:"omitempty,min=0,max=24"`
+		RejectBreached *bool `json:"reject_breached"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	policy := passwordPolicyOf(config.DB, libId.(uint))
+	before := policy
+	if input.MinLength != nil {
+		policy.MinLength = *input.MinLength
+	}
+	if input.RequireUpper != nil {
+		policy.RequireUpper = *input.RequireUpper
+	}
+	if input.RequireLower != nil {
+		policy.RequireLower = *input.RequireLower
+	}
+	if input.RequireDigit != nil {
+		policy.RequireDigit = *input.RequireDigit
+	}
+	if input.RequireSymbol != nil {
+		policy.RequireSymbol = *input.RequireSymbol
+	}
+	if input.HistorySize != nil {
+		policy.HistorySize = *input.HistorySize
+	}
+	if input.RejectBreached != nil {
+		policy.RejectBreached = *input.RejectBreached
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "password_policy.update", "password_policy", policy.LibID, before, policy)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password policy updated", "policy": policy})
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/breach"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPasswordPolicy(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@example.com", Password: "ownerpassword", Contact_number: "1", Role: "Owner", LibID: 1},
+		},
+	})
+
+	sum := sha1.Sum([]byte("letmein123"))
+	list, err := breach.Parse(strings.NewReader(hex.EncodeToString(sum[:])))
+	assert.NoError(t, err)
+	previous := breach.Default
+	breach.Default = list
+	t.Cleanup(func() { breach.Default = previous })
+
+	router.POST("/auth/signup", Signup)
+	router.POST("/auth/invitations/accept", AcceptInvitation)
+	owner := testutils.AsCaller(router, "/owner", testutils.Caller{ID: 1, LibID: 1, Email: "owner@example.com", Role: "Owner"})
+	owner.POST("/password", UpdatePassword)
+	owner.POST("/create-reader", CreateReaderUser)
+	owner.GET("/password-policy", GetPasswordPolicy)
+	owner.PATCH("/password-policy", UpdatePasswordPolicy)
+	return router
+}
+
+func patchJSON(router *gin.Engine, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func changePassword(router *gin.Engine, from, to string) *httptest.ResponseRecorder {
+	return postJSON(router, "/owner/password", `{"OldPassword": "`+from+`", "NewPassword": "`+to+`"}`)
+}
+
+func TestSignup_DefaultPolicy(t *testing.T) {
+	router := setupPasswordPolicy(t)
+
+	w := postJSON(router, "/auth/signup", `{"Name": "New", "Email": "new@example.com", "Password": "short", "ContactNumber": "2", "LibraryName": "Other"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Password must be at least 8 characters long")
+
+	w = postJSON(router, "/auth/signup", `{"Name": "New", "Email": "new@example.com", "Password": "letmein123", "ContactNumber": "2", "LibraryName": "Other"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "breached")
+
+	// BCRYPT CAN NOT HASH PAST 72 BYTES, SO LONGER PASSWORDS ARE REFUSED UP FRONT
+	w = postJSON(router, "/auth/signup", `{"Name": "New", "Email": "new@example.com", "Password": "`+strings.Repeat("é", 37)+`", "ContactNumber": "2", "LibraryName": "Other"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Password must be at most 72 bytes long")
+
+	var count int64
+	config.DB.Model(&models.Library{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestAcceptInvitation_LibraryPolicy(t *testing.T) {
+	router := setupPasswordPolicy(t)
+	outbox := &mailer.Memory{}
+	previous := mailer.Default
+	mailer.Default = outbox
+	t.Cleanup(func() { mailer.Default = previous })
+
+	w := patchJSON(router, "/owner/password-policy", `{"min_length": 4}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = patchJSON(router, "/owner/password-policy", `{"min_length": 73}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = patchJSON(router, "/owner/password-policy", `{"min_length": 10, "require_upper": true, "require_digit": true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postJSON(router, "/owner/create-reader", `{"name": "Reader", "email": "reader@example.com", "contactNumber": "2"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	token := resetTokenOf(t, outbox.Messages()[0])
+
+	accept := `{"token": "` + token + `", "password": "%s"}`
+	w = postJSON(router, "/auth/invitations/accept", strings.Replace(accept, "%s", "readerpass", 1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	violations := decode(t, w.Body.Bytes())["violations"]
+	assert.Equal(t, []interface{}{"Password must contain an uppercase letter", "Password must contain a digit"}, violations)
+
+	w = postJSON(router, "/auth/invitations/accept", strings.Replace(accept, "%s", "Readerpass1", 1))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ := http.NewRequest("GET", "/owner/password-policy", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	policy := decode(t, w.Body.Bytes())["policy"].(map[string]interface{})
+	assert.Equal(t, float64(10), policy["min_length"])
+	assert.Equal(t, float64(3), policy["history_size"])
+	assert.Equal(t, true, policy["reject_breached"])
+}
+
+func TestUpdatePassword_RecentPasswordsAreRefused(t *testing.T) {
+	router := setupPasswordPolicy(t)
+
+	w := changePassword(router, "ownerpassword", "ownerpassword")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Password must differ from the last 3 passwords")
+
+	assert.Equal(t, http.StatusOK, changePassword(router, "ownerpassword", "secondpassword").Code)
+	assert.Equal(t, http.StatusOK, changePassword(router, "secondpassword", "thirdpassword").Code)
+	assert.Equal(t, http.StatusBadRequest, changePassword(router, "thirdpassword", "ownerpassword").Code)
+
+	// THREE CHANGES LATER THE FIRST PASSWORD IS FREE AGAIN
+	assert.Equal(t, http.StatusOK, changePassword(router, "thirdpassword", "fourthpassword").Code)
+	assert.Equal(t, http.StatusOK, changePassword(router, "fourthpassword", "ownerpassword").Code)
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// Same answer whether or not the email belongs to an account
+const forgotPasswordMessage = "If the email is registered, a password reset link has been sent"
+
+var errInvalidResetToken = errors.New("Invalid or expired reset token")
+
+// Page of the frontend that takes the token and the new password
+func passwordResetLink(token string) string {
+	base := os.Getenv("RESET_PASSWORD_URL")
+	if base == "" {
+		base = "http://localhost:3000/reset-password"
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// REQUESTING A PASSWORD RESET LINK BY EMAIL
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	// THE LINK IS MADE AND MAILED AFTER ANSWERING, SO A REGISTERED EMAIL
+	// TAKES NO LONGER TO ANSWER THAN AN UNKNOWN ONE
+	inBackground(func() {
+		if err := sendPasswordReset(user); err != nil {
+			log.Printf("Failed to send password reset mail: %v", err)
+		}
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// Work a handler leaves running after it has answered
+var backgroundWork sync.WaitGroup
+
+func inBackground(task func()) {
+	backgroundWork.Add(1)
+	go func() {
+		defer backgroundWork.Done()
+		task()
+	}()
+}
+
+// Replaces any unused reset link of the account with a new one and mails it
+func sendPasswordReset(user models.User) error {
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// ONLY THE NEWEST LINK WORKS
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		reset := models.PasswordReset{UserID: user.ID, TokenHash: hash, ExpiresAt: time.Now().Add(passwordResetTTL)}
+		return tx.Create(&reset).Error
+	}); err != nil {
+		return err
+	}
+
+	return mailer.Default.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your library password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %d minutes and works once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, int(passwordResetTTL.Minutes()), passwordResetLink(token)),
+	})
+}
+
+// SETTING A NEW PASSWORD WITH A RESET TOKEN
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reset models.PasswordReset
+	if err := config.DB.Where("token_hash = ?", utils.HashToken(input.Token)).First(&reset).Error; err != nil ||
+		reset.UsedAt != nil || !time.Now().Before(reset.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidResetToken.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, reset.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidResetToken.Error()})
+		return
+	}
+	if !acceptablePassword(c, user.LibID, &user, input.NewPassword) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Bcrypt failed to generate password!"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// SINGLE USE, EVEN WHEN TWO RESETS RACE
+		result := tx.Model(&models.PasswordReset{}).Where("reset_id = ? AND used_at IS NULL", reset.ResetID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		if err := rememberPassword(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", reset.UserID).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		// A LOCKED-OUT OWNER OF THE ACCOUNT CAN LOG IN WITH THE NEW PASSWORD
+		if err := clearAccountLockout(tx, reset.UserID); err != nil {
+			return err
+		}
+		// WHOEVER KNEW THE OLD PASSWORD IS LOGGED OUT
+		return revokeUserSessions(tx, reset.UserID)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func setupPasswordReset(t *testing.T) (*gin.Engine, *mailer.Memory) {
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Reader", Email: "reader@example.com", Password: "oldpassword", Contact_number: "1", Role: "Reader", LibID: 1},
+		},
+	})
+
+	outbox := &mailer.Memory{}
+	previous := mailer.Default
+	mailer.Default = outbox
+	t.Cleanup(func() { mailer.Default = previous })
+
+	router.POST("/auth/forgot-password", ForgotPassword)
+	router.POST("/auth/reset-password", ResetPassword)
+	return router, outbox
+}
+
+func postJSON(router *gin.Engine, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// ASKS FOR A RESET LINK AND WAITS FOR IT TO BE MAILED
+func forgotPassword(router *gin.Engine, email string) *httptest.ResponseRecorder {
+	w := postJSON(router, "/auth/forgot-password", `{"email": "`+email+`"}`)
+	backgroundWork.Wait()
+	return w
+}
+
+// TOKEN FROM THE LINK IN A RESET OR INVITATION MAIL
+func resetTokenOf(t *testing.T, msg mailer.Message) string {
+	start := strings.Index(msg.Body, "http")
+	end := start + strings.IndexAny(msg.Body[start:], " \n")
+	link, err := url.Parse(msg.Body[start:end])
+	assert.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func TestForgotPassword_SameAnswerForUnknownEmail(t *testing.T) {
+	router, outbox := setupPasswordReset(t)
+
+	known := forgotPassword(router, "reader@example.com")
+	unknown := forgotPassword(router, "nobody@example.com")
+
+	assert.Equal(t, http.StatusOK, known.Code)
+	assert.Equal(t, known.Code, unknown.Code)
+	assert.Equal(t, known.Body.String(), unknown.Body.String())
+
+	assert.Len(t, outbox.Messages(), 1)
+	assert.Equal(t, "reader@example.com", outbox.Messages()[0].To)
+}
+
+// HOLDS EVERY MAIL UNTIL RELEASED
+type blockedSender struct{ release chan struct{} }
+
+func (b blockedSender) Send(mailer.Message) error {
+	<-b.release
+	return nil
+}
+
+func TestForgotPassword_AnswersBeforeMailing(t *testing.T) {
+	router, _ := setupPasswordReset(t)
+	blocked := blockedSender{release: make(chan struct{})}
+	mailer.Default = blocked
+
+	// A SLOW MAIL SERVER WOULD OTHERWISE TELL REGISTERED EMAILS APART
+	w := postJSON(router, "/auth/forgot-password", `{"email": "reader@example.com"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	close(blocked.release)
+	backgroundWork.Wait()
+
+	var count int64
+	config.DB.Model(&models.PasswordReset{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestResetPassword_SingleUse(t *testing.T) {
+	router, outbox := setupPasswordReset(t)
+
+	forgotPassword(router, "reader@example.com")
+	token := resetTokenOf(t, outbox.Messages()[0])
+	assert.NotEmpty(t, token)
+
+	// ONLY THE HASH IS STORED
+	var reset models.PasswordReset
+	config.DB.First(&reset)
+	assert.NotEqual(t, token, reset.TokenHash)
+
+	w := postJSON(router, "/auth/reset-password", `{"token": "`+token+`", "new_password": "newpassword"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.User
+	config.DB.Where("email = ?", "reader@example.com").First(&user)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("newpassword")))
+
+	w = postJSON(router, "/auth/reset-password", `{"token": "`+token+`", "new_password": "another"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or expired reset token")
+}
+
+func TestResetPassword_ExpiredAndSupersededTokens(t *testing.T) {
+	router, outbox := setupPasswordReset(t)
+
+	forgotPassword(router, "reader@example.com")
+	forgotPassword(router, "reader@example.com")
+	first := resetTokenOf(t, outbox.Messages()[0])
+	second := resetTokenOf(t, outbox.Messages()[1])
+
+	// A NEWER LINK REPLACES THE OLDER ONE
+	w := postJSON(router, "/auth/reset-password", `{"token": "`+first+`", "new_password": "newpassword"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	config.DB.Model(&models.PasswordReset{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+	w = postJSON(router, "/auth/reset-password", `{"token": "`+second+`", "new_password": "newpassword"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestResetPassword_RevokesSessions(t *testing.T) {
+	router, outbox := setupPasswordReset(t)
+
+	var user models.User
+	config.DB.Where("email = ?", "reader@example.com").First(&user)
+	session := models.Session{UserID: user.ID, LibID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	config.DB.Create(&session)
+
+	forgotPassword(router, "reader@example.com")
+	token := resetTokenOf(t, outbox.Messages()[0])
+	w := postJSON(router, "/auth/reset-password", `{"token": "`+token+`", "new_password": "newpassword"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.DB.First(&session, session.SessionID)
+	assert.NotNil(t, session.RevokedAt)
+}
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MOST SPECIFIC POLICY FOR A BOOK CATEGORY AND READER TYPE:
+// CATEGORY+READER TYPE, THEN CATEGORY, THEN READER TYPE, THEN LIBRARY DEFAULT
+func resolvePolicy(tx *gorm.DB, libID uint, category, readerType string) models.CirculationPolicy {
+	var policies []models.CirculationPolicy
+	tx.Where("lib_id = ? AND category IN ? AND reader_type IN ?", libID, []string{category, ""}, []string{readerType, ""}).
+		Find(&policies)
+
+	best, bestScore := models.DefaultCirculationPolicy(libID), -1
+	for _, p := range policies {
+		score := 0
+		if p.Category != "" {
+			score += 2
+		}
+		if p.ReaderType != "" {
+			score += 1
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// POLICY GOVERNING A READER BORROWING A PARTICULAR BOOK
+func loanPolicy(tx *gorm.DB, libID uint, isbn string, readerID uint) models.CirculationPolicy {
+	var book models.Books
+	tx.Select("category").Where("isbn = ? AND lib_id = ?", isbn, libID).Take(&book)
+
+	var reader models.User
+	tx.Select("reader_type").Where("id = ?", readerID).Take(&reader)
+
+	return resolvePolicy(tx, libID, book.Category, reader.ReaderType)
+}
+
+type policyInput struct {
+	Category       *string `json:"category"`
+	ReaderType     *string `json:"reader_type"`
+	LoanPeriodDays *uint   `json:"loan_period_days" binding:"omitempty,min=1"`
+	MaxLoans       *uint   `json:"max_loans"`
+	MaxRenewals    *uint   `json:"max_renewals"`
+	FineDailyRate  *uint   `json:"fine_daily_rate"`
+	FineGraceDays  *uint   `json:"fine_grace_days"`
+	FineCap        *uint   `json:"fine_cap"`
+}
+
+func (input policyInput) apply(policy *models.CirculationPolicy) {
+	if input.LoanPeriodDays != nil {
+		policy.LoanPeriodDays = *input.LoanPeriodDays
+	}
+	if input.MaxLoans != nil {
+		policy.MaxLoans = *input.MaxLoans
+	}
+	if input.MaxRenewals != nil {
+		policy.MaxRenewals = *input.MaxRenewals
+	}
+	if input.FineDailyRate != nil {
+		policy.FineDailyRate = *input.FineDailyRate
+	}
+	if input.FineGraceDays != nil {
+		policy.FineGraceDays = *input.FineGraceDays
+	}
+	if input.FineCap != nil {
+		policy.FineCap = *input.FineCap
+	}
+}
+
+// LISTING CIRCULATION POLICIES OF THE LIBRARY
+func ListPolicies(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	var policies []models.CirculationPolicy
+	if err := config.DB.Where("lib_id = ?", libId).Order("category ASC, reader_type ASC").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// CREATING A POLICY, UNSET RULES ARE INHERITED FROM THE LIBRARY DEFAULT
+func CreatePolicy(c *gin.Context) {
+	var input policyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	policy := resolvePolicy(config.DB, libId.(uint), "", "")
+	policy.PolicyID = 0
+	policy.Category = ""
+	policy.ReaderType = ""
+	if input.Category != nil {
+		policy.Category = *input.Category
+	}
+	if input.ReaderType != nil {
+		policy.ReaderType = *input.ReaderType
+	}
+	input.apply(&policy)
+
+	var existing models.CirculationPolicy
+	if err := config.DB.Where("lib_id = ? AND category = ? AND reader_type = ?", policy.LibID, policy.Category, policy.ReaderType).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Policy already exists for this category and reader type"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&policy).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "policy.create", "policy", policy.PolicyID, nil, policy)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Policy created successfully", "policy": policy})
+}
+
+func findPolicy(c *gin.Context) (models.CirculationPolicy, bool) {
+	var policy models.CirculationPolicy
+	policyId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy ID"})
+		return policy, false
+	}
+
+	libId, _ := c.Get("libid")
+	if err := config.DB.Where("policy_id = ? AND lib_id = ?", policyId, libId).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return policy, false
+	}
+	return policy, true
+}
+
+// UPDATING THE RULES OF A POLICY
+func UpdatePolicy(c *gin.Context) {
+	var input policyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Category != nil || input.ReaderType != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category and reader type of a policy can not be changed"})
+		return
+	}
+
+	policy, ok := findPolicy(c)
+	if !ok {
+		return
+	}
+
+	before := policy
+	input.apply(&policy)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&policy).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "policy.update", "policy", policy.PolicyID, before, policy)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Policy updated successfully", "policy": policy})
+}
+
+// DELETING A CATEGORY OR READER TYPE OVERRIDE
+func DeletePolicy(c *gin.Context) {
+	policy, ok := findPolicy(c)
+	if !ok {
+		return
+	}
+
+	if policy.Category == "" && policy.ReaderType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The library default policy can not be deleted"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(c, tx, "policy.delete", "policy", policy.PolicyID, policy, nil); err != nil {
+			return err
+		}
+		return tx.Delete(&policy).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted successfully"})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePolicy_MostSpecificWins(t *testing.T) {
+	testutils.SetupTestDB()
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 14})
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, ReaderType: "Student", LoanPeriodDays: 7})
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, Category: "Reference", LoanPeriodDays: 2})
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, Category: "Reference", ReaderType: "Faculty", LoanPeriodDays: 5})
+
+	assert.Equal(t, uint(14), resolvePolicy(config.DB, 1, "Fiction", "Faculty").LoanPeriodDays)
+	assert.Equal(t, uint(7), resolvePolicy(config.DB, 1, "Fiction", "Student").LoanPeriodDays)
+	assert.Equal(t, uint(2), resolvePolicy(config.DB, 1, "Reference", "Student").LoanPeriodDays)
+	assert.Equal(t, uint(5), resolvePolicy(config.DB, 1, "Reference", "Faculty").LoanPeriodDays)
+
+	// LIBRARIES WITHOUT POLICIES FALL BACK TO THE BUILT-IN DEFAULT
+	assert.Equal(t, models.DefaultCirculationPolicy(2).LoanPeriodDays, resolvePolicy(config.DB, 2, "", "").LoanPeriodDays)
+}
+
+func TestCreatePolicy_InheritsDefault(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 21, MaxLoans: 3, MaxRenewals: 1, FineDailyRate: 10})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.POST("/policies", CreatePolicy)
+
+	payload := `{"category": "Reference", "loan_period_days": 3}`
+	req, _ := http.NewRequest("POST", "/policies", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Policy created successfully")
+
+	var policy models.CirculationPolicy
+	err := config.DB.Where("lib_id = ? AND category = ?", 1, "Reference").First(&policy).Error
+	assert.Nil(t, err)
+	assert.Equal(t, uint(3), policy.LoanPeriodDays)
+	assert.Equal(t, uint(3), policy.MaxLoans)
+	assert.Equal(t, uint(10), policy.FineDailyRate)
+
+	// SAME SCOPE CAN NOT BE CREATED TWICE
+	req, _ = http.NewRequest("POST", "/policies", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestDeletePolicy_DefaultProtected(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 14})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.DELETE("/policies/:id", DeletePolicy)
+
+	req, _ := http.NewRequest("DELETE", "/policies/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "default policy can not be deleted")
+}
+
+func TestProcessRequest_MaxLoansReached(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 14, MaxLoans: 1})
+	book := models.Books{
+		ISBN:             "9780306406157",
+		Title:            "Go Programming",
+		Authors:          "John Doe",
+		Publisher:        "Tech Press",
+		Version:          "1st",
+		LibID:            1,
+		Total_copies:     5,
+		Available_copies: 5,
+	}
+	config.DB.Create(&book)
+	config.DB.Create(&models.IssueRegistry{ISBN: "9781617294549", LibID: 1, ReaderID: 2, Status: "issued", IssueDate: time.Now()})
+	config.DB.Create(&models.RequestEvents{BookID: book.ISBN, ReaderID: 2, LibID: 1, RequestType: "issue", RequestDate: time.Now()})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
+	caller.POST("/requests/process", ProcessRequest)
+
+	payload := `{"action": "approve", "reqtype": "issue", "reqid": 1}`
+	req, _ := http.NewRequest("POST", "/requests/process", bytes.NewBuffer([]byte(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "maximum number of loans")
+}
+
+func TestUpdatePolicy_RenewalLimit(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	policy := models.DefaultCirculationPolicy(1)
+	config.DB.Create(&policy)
+	config.DB.Create(&models.CirculationPolicy{LibID: 2, MaxRenewals: 3})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{LibID: 1})
+	caller.PATCH("/policies/:id", UpdatePolicy)
+
+	req, _ := http.NewRequest("PATCH", "/policies/1", bytes.NewBuffer([]byte(`{"max_renewals": 0}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Policy updated successfully")
+
+	var updated models.CirculationPolicy
+	config.DB.First(&updated, policy.PolicyID)
+	assert.Equal(t, uint(0), updated.MaxRenewals)
+
+	// POLICIES OF OTHER LIBRARIES ARE OUT OF REACH
+	req, _ = http.NewRequest("PATCH", "/policies/2", bytes.NewBuffer([]byte(`{"max_renewals": 0}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
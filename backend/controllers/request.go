@@ -2,20 +2,42 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// RAISING ISSUE/RETURN REQUESTS
+var errRequestNotFound = errors.New("request not found")
+
+// A request that cannot be approved in the current state of the loan, book or request
+type requestConflict struct{ msg string }
+
+func (e requestConflict) Error() string { return e.msg }
+
+// STATUS CODE OF A FAILED APPROVAL, 500 FOR ANYTHING BUT A MISSING OR CONFLICTING REQUEST
+func approvalStatus(err error) int {
+	var conflict requestConflict
+	switch {
+	case errors.Is(err, errRequestNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// RAISING ISSUE/RETURN/RENEW REQUESTS
 func RaiseBookRequest(c *gin.Context) {
 	var input struct {
-		ISBN        uint   `binding:"required"`
+		ISBN        string `binding:"required"`
 		RequestType string `binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -23,34 +45,58 @@ func RaiseBookRequest(c *gin.Context) {
 		return
 	}
 
-	if !(input.RequestType == "issue" || input.RequestType == "return") {
+	if !(input.RequestType == "issue" || input.RequestType == "return" || input.RequestType == "renew") {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Request types can be issue OR return only!",
+			"error": "Request types can be issue, return OR renew only!",
 		})
 		return
 	}
 
-	var book models.Books
-	if err := config.DB.Where("isbn = ?", input.ISBN).First(&book).Error; err != nil || book.Available_copies <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book unavailable"})
+	isbn, err := utils.NormalizeISBN(input.ISBN)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ISBN"})
 		return
 	}
+	input.ISBN = isbn
 
 	floatId, _ := c.Get("id")
 	id := floatId.(uint)
 
 	libId, _ := c.Get("libid")
 
-	// CHECKING IF THE REQUEST EXISTS ALREADY
 	var bookReq models.RequestEvents
 	if input.RequestType == "issue" {
-		if err := config.DB.Where("libid = ? AND reader_Id= ? AND book_ID = ? ", libId, id, input.ISBN).Take(&bookReq).Error; err == nil {
+		var book models.Books
+		if err := config.DB.Where("isbn = ? AND lib_id = ?", input.ISBN, libId).First(&book).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Book unavailable"})
+			return
+		}
+
+		// CHECKING IF THE REQUEST EXISTS ALREADY
+		if err := config.DB.Where("lib_id = ? AND reader_id = ? AND book_id = ? AND status = ?", libId, id, input.ISBN, models.RequestPending).Take(&bookReq).Error; err == nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Duplicate request!",
 			})
 			return
 		}
 
+		// NO UNRESERVED COPY LEFT, JOINING THE HOLD QUEUE
+		if int64(book.Available_copies) <= reservedCopies(config.DB, book.ISBN, book.LibID) {
+			hold, position, err := joinHoldQueue(config.DB, book.ISBN, book.LibID, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"message":  "Book unavailable, added to hold queue",
+				"hold":     hold,
+				"position": position,
+			})
+			return
+		}
+
 		bookReq.BookID = input.ISBN
 		bookReq.ReaderID = id
 		bookReq.LibID = libId.(uint)
@@ -58,7 +104,7 @@ func RaiseBookRequest(c *gin.Context) {
 		bookReq.RequestDate = time.Now()
 
 		// CREATING BOOK REQUEST
-		if err := config.DB.Create(&bookReq).Error; err != nil {
+		if err := createRequest(config.DB, &bookReq, &id); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
@@ -68,6 +114,47 @@ func RaiseBookRequest(c *gin.Context) {
 		return
 	}
 
+	// BOOK RENEWAL REQUEST
+	if input.RequestType == "renew" {
+		var issueReg models.IssueRegistry
+		if err := config.DB.Where("isbn = ? AND reader_id = ? AND lib_id = ? AND status = ?", input.ISBN, id, libId, "issued").First(&issueReg).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "No active loan exists corresponding to this renew request",
+			})
+			return
+		}
+
+		policy := loanPolicy(config.DB, issueReg.LibID, issueReg.ISBN, issueReg.ReaderID)
+		if err := checkRenewal(config.DB, issueReg, policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := config.DB.Where("lib_id = ? AND reader_id = ? AND book_id = ? AND request_type = ? AND status = ?", libId, id, input.ISBN, "renew", models.RequestPending).Take(&bookReq).Error; err == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Duplicate request!",
+			})
+			return
+		}
+
+		bookReq.BookID = input.ISBN
+		bookReq.ReaderID = id
+		bookReq.LibID = libId.(uint)
+		bookReq.RequestType = input.RequestType
+		bookReq.RequestDate = time.Now()
+
+		if err := createRequest(config.DB, &bookReq, &id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Renew request raised successfully"})
+		return
+	}
+
 	// BOOK RETURN REQUEST
 	var issueReg models.IssueRegistry
 
@@ -84,7 +171,7 @@ func RaiseBookRequest(c *gin.Context) {
 	bookReq.RequestType = input.RequestType
 	bookReq.RequestDate = time.Now()
 
-	if err := config.DB.Create(&bookReq).Error; err != nil {
+	if err := createRequest(config.DB, &bookReq, &id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -97,10 +184,83 @@ func RaiseBookRequest(c *gin.Context) {
 
 }
 
+// Stores a new pending request along with the first entry of its history
+func createRequest(tx *gorm.DB, req *models.RequestEvents, actorID *uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		req.Status = models.RequestPending
+		if err := tx.Create(req).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RequestTransition{ReqID: req.ReqID, ToStatus: models.RequestPending, ActorID: actorID}).Error
+	})
+}
+
+// Moves a request to its next status and records the change. Staff approving
+// or rejecting become its approver. The update only applies while the request
+// is still in the status it was read with, so two settlements can not race
+func transitionRequest(tx *gorm.DB, req *models.RequestEvents, to string, actorID *uint, reason string) error {
+	if err := req.CanTransition(to); err != nil {
+		return requestConflict{err.Error()}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to, "processing_date": now}
+	staff := to == models.RequestApproved || to == models.RequestRejected
+	if staff {
+		updates["admin_id"] = actorID
+	}
+	if to == models.RequestRejected {
+		updates["rejection_reason"] = reason
+	}
+	result := tx.Model(&models.RequestEvents{}).Where("req_id = ? AND status = ?", req.ReqID, req.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return requestConflict{fmt.Sprintf("request is no longer %s", req.Status)}
+	}
+
+	from := req.Status
+	req.Status = to
+	req.ProcessingDate = &now
+	if staff {
+		req.AdminID = actorID
+	}
+	if to == models.RequestRejected {
+		req.RejectionReason = reason
+	}
+	return tx.Create(&models.RequestTransition{ReqID: req.ReqID, FromStatus: from, ToStatus: to, ActorID: actorID, Reason: reason}).Error
+}
+
+// Narrows a request query to the status asked for, "all" keeping every status
+func filterRequestStatus(c *gin.Context, query *gorm.DB, fallback string) (*gorm.DB, bool) {
+	status := c.DefaultQuery("status", fallback)
+	if status == "all" {
+		return query, true
+	}
+	for _, known := range models.RequestStatuses {
+		if status == known {
+			return query.Where("status = ?", status), true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown request status " + status})
+	return query, false
+}
+
+// LISTING REQUESTS OF THE LIBRARY, THE PENDING ONES UNLESS ANOTHER STATUS IS ASKED FOR
 func ListRequests(c *gin.Context) {
-	var requests []models.RequestEvents
+	libId, _ := c.Get("libid")
+
+	query, ok := filterRequestStatus(c, config.DB.Where("lib_id = ?", libId), models.RequestPending)
+	if !ok {
+		return
+	}
+	if readerId := c.Query("reader_id"); readerId != "" {
+		query = query.Where("reader_id = ?", readerId)
+	}
 
-	if err := config.DB.Find(&requests).Error; err != nil {
+	var requests []models.RequestEvents
+	if err := query.Order("req_id ASC").Find(&requests).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -111,62 +271,238 @@ func ListRequests(c *gin.Context) {
 	})
 }
 
-// HANDLING RETURN REQUEST
-func handleReturnRequest(c *gin.Context, returnapproverID, reqId uint) {
+// Request matching the query along with its history, in the order it happened
+func findRequestHistory(c *gin.Context, query *gorm.DB) {
 	var req models.RequestEvents
-	// FETCHING REQUEST DETAILS
-	if err := config.DB.First(&req, reqId).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	if err := query.Preload("Transitions", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("transition_id ASC")
+	}).First(&req).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"request": req})
+}
 
-	// UPDATING THE ISSUE REGISTRY
-	var retRegistry models.IssueRegistry
-	if err := config.DB.Where("isbn = ? AND reader_id = ? AND lib_id = ?", req.BookID, req.ReaderID, req.LibID).First(&retRegistry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+// GETTING A REQUEST OF THE LIBRARY AND ITS HISTORY
+func GetRequest(c *gin.Context) {
+	libId, _ := c.Get("libid")
+	findRequestHistory(c, config.DB.Where("req_id = ? AND lib_id = ?", c.Param("id"), libId))
+}
+
+// LISTING REQUESTS OF THE LOGGED IN READER, NEWEST FIRST
+func ListMyRequests(c *gin.Context) {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+
+	query, ok := filterRequestStatus(c, config.DB.Where("reader_id = ? AND lib_id = ?", id, libId), "all")
+	if !ok {
 		return
 	}
 
-	retRegistry.ReturnApproverID = &returnapproverID
-	now := time.Now()
-	retRegistry.ReturnDate = &now
-	retRegistry.Status = "returned"
+	var requests []models.RequestEvents
+	if err := query.Order("req_id DESC").Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
 
-	if err := config.DB.Save(&retRegistry).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+// GETTING A REQUEST OF THE LOGGED IN READER AND ITS HISTORY
+func GetMyRequest(c *gin.Context) {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+	findRequestHistory(c, config.DB.Where("req_id = ? AND reader_id = ? AND lib_id = ?", c.Param("id"), id, libId))
+}
+
+// CANCELLING A PENDING REQUEST OF THE LOGGED IN READER
+func CancelRequest(c *gin.Context) {
+	id, _ := c.Get("id")
+	libId, _ := c.Get("libid")
+	readerID := id.(uint)
+
+	var req models.RequestEvents
+	if err := config.DB.Where("req_id = ? AND reader_id = ? AND lib_id = ?", c.Param("id"), readerID, libId).First(&req).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return
+	}
+	if err := req.CanTransition(models.RequestCancelled); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := config.DB.Delete(&req).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// A REQUEST PROMOTED FROM A HOLD GIVES ITS COPY TO THE NEXT READER
+		var hold models.Hold
+		if tx.Where("req_id = ? AND status = ?", req.ReqID, "ready").First(&hold).Error == nil {
+			return releaseHold(tx, &hold, "cancelled", &readerID)
+		}
+		return transitionRequest(tx, &req, models.RequestCancelled, &readerID, "")
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "Request cancelled successfully"})
+}
 
-	// UPDATING BOOK COUNT
-	var book models.Books
-	if err := config.DB.Where("isbn = ? AND lib_id = ?", retRegistry.ISBN, retRegistry.LibID).First(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+// CHECKING WHETHER A LOAN CAN BE RENEWED
+func checkRenewal(tx *gorm.DB, issueReg models.IssueRegistry, policy models.CirculationPolicy) error {
+	// RENEWING AN OVERDUE LOAN WOULD WIPE THE FINE IT HAS ACCRUED
+	if time.Now().After(issueReg.ExpectedReturnDate) {
+		return requestConflict{"loan is overdue and cannot be renewed"}
+	}
+	if issueReg.RenewalCount >= policy.MaxRenewals {
+		return requestConflict{"renewal limit reached for this loan"}
+	}
+
+	var waiting int64
+	tx.Model(&models.Hold{}).Where("isbn = ? AND lib_id = ? AND status IN ?", issueReg.ISBN, issueReg.LibID, []string{"waiting", "ready"}).Count(&waiting)
+	if waiting > 0 {
+		return requestConflict{"book is on hold for another reader"}
+	}
+	return nil
+}
+
+// HANDLING RENEW REQUEST
+func handleRenewRequest(c *gin.Context, approverID, reqId uint) {
+	libId, _ := c.Get("libid")
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		var req models.RequestEvents
+		if tx.Where("req_id = ? AND request_type = ? AND lib_id = ?", reqId, "renew", libId).First(&req).Error != nil {
+			return errRequestNotFound
+		}
+
+		before := req
+		if err := transitionRequest(tx, &req, models.RequestApproved, &approverID, ""); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "request.approve", "request", req.ReqID, before, req); err != nil {
+			return err
+		}
+
+		var issueReg models.IssueRegistry
+		if tx.Where("isbn = ? AND reader_id = ? AND lib_id = ? AND status = ?", req.BookID, req.ReaderID, req.LibID, "issued").First(&issueReg).Error != nil {
+			return requestConflict{"no active loan for this request"}
+		}
+		policy := loanPolicy(tx, issueReg.LibID, issueReg.ISBN, issueReg.ReaderID)
+		if err := checkRenewal(tx, issueReg, policy); err != nil {
+			return err
+		}
+
+		// EXTENDING THE LOAN BY ANOTHER LOAN PERIOD FROM TODAY
+		loanBefore := issueReg
+		issueReg.ExpectedReturnDate = time.Now().AddDate(0, 0, int(policy.LoanPeriodDays))
+		issueReg.RenewalCount += 1
+		if err := tx.Save(&issueReg).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "loan.renew", "loan", issueReg.IssueID, loanBefore, issueReg)
+	})
+
+	if txErr != nil {
+		c.JSON(approvalStatus(txErr), gin.H{"error": txErr.Error()})
 		return
 	}
-	book.Available_copies += 1
-	if err := config.DB.Save(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Error while updating book available copies",
+	c.JSON(http.StatusOK, gin.H{"message": "Renew request approved successfully"})
+}
+
+// HANDLING RETURN REQUEST
+func handleReturnRequest(c *gin.Context, returnapproverID, reqId uint) {
+	libId, _ := c.Get("libid")
+	var fine uint
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		// FETCHING REQUEST DETAILS
+		var req models.RequestEvents
+		if tx.Where("req_id = ? AND request_type = ? AND lib_id = ?", reqId, "return", libId).First(&req).Error != nil {
+			return errRequestNotFound
+		}
+		if err := req.CanTransition(models.RequestApproved); err != nil {
+			return requestConflict{err.Error()}
+		}
+
+		// UPDATING THE ISSUE REGISTRY
+		var retRegistry models.IssueRegistry
+		if tx.Where("isbn = ? AND reader_id = ? AND lib_id = ? AND status = ?", req.BookID, req.ReaderID, req.LibID, "issued").First(&retRegistry).Error != nil {
+			return requestConflict{"no active loan for this request"}
+		}
+
+		before := retRegistry
+		retRegistry.ReturnApproverID = &returnapproverID
+		now := time.Now()
+		retRegistry.ReturnDate = &now
+		retRegistry.Status = "returned"
+		if err := tx.Save(&retRegistry).Error; err != nil {
+			return err
+		}
+
+		// CHARGING OVERDUE FINES
+		var err error
+		if fine, err = assessFine(tx, retRegistry); err != nil {
+			return err
+		}
+
+		reqBefore := req
+		if err := transitionRequest(tx, &req, models.RequestApproved, &returnapproverID, ""); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "request.approve", "request", req.ReqID, reqBefore, req); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "loan.return", "loan", retRegistry.IssueID, before, retRegistry); err != nil {
+			return err
+		}
+
+		// PUTTING THE COPY BACK ON THE SHELF, WHICH UPDATES THE BOOK COUNT
+		if err := checkinItem(tx, retRegistry); err != nil {
+			return errors.New("Error while updating book available copies")
+		}
+
+		// HANDING THE RETURNED COPY TO THE NEXT HOLD IN THE QUEUE
+		return promoteNextHold(tx, retRegistry.ISBN, retRegistry.LibID)
+	})
+
+	if txErr != nil {
+		c.JSON(approvalStatus(txErr), gin.H{
+			"error": txErr.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Return request processed successfully!",
+		"fine":    fine,
+	})
+}
+
+// REJECTING A PENDING REQUEST WITH AN OPTIONAL REASON, RELEASING ANY HOLD IT WAS PROMOTED FROM
+func rejectRequest(c *gin.Context, approverID, reqId uint, reqType, reason string) {
+	libId, _ := c.Get("libid")
+	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
+		var req models.RequestEvents
+		if tx.Where("req_id = ? AND request_type = ? AND lib_id = ?", reqId, reqType, libId).First(&req).Error != nil {
+			return errRequestNotFound
+		}
+
+		before := req
+		if err := transitionRequest(tx, &req, models.RequestRejected, &approverID, reason); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "request.reject", "request", req.ReqID, before, req); err != nil {
+			return err
+		}
+
+		var hold models.Hold
+		if tx.Where("req_id = ? AND status = ?", req.ReqID, "ready").First(&hold).Error == nil {
+			return releaseHold(tx, &hold, "cancelled", &approverID)
+		}
+		return nil
+	})
+
+	if txErr != nil {
+		c.JSON(approvalStatus(txErr), gin.H{"error": txErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Request processed succesfully! " + strings.ToUpper(reqType[:1]) + reqType[1:] + " req rejected!",
 	})
 }
 
@@ -175,6 +511,9 @@ func ProcessRequest(c *gin.Context) {
 		Action  string `binding:"required" json:"action"`
 		Reqtype string `binding:"required" json:"reqtype"`
 		ReqID   uint   `binding:"required" json:"reqid"`
+		Barcode string `json:"barcode"`
+		// Shown to the reader when the request is rejected
+		Reason string `json:"reason"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -185,49 +524,87 @@ func ProcessRequest(c *gin.Context) {
 	// GETTING ADMIN ID from JWT
 	id, _ := c.Get("id")
 	ApproverID := id.(uint)
+	libId, _ := c.Get("libid")
 
-	// HANDLING BOOK RETURNS
-	if input.Reqtype == "return" {
-		handleReturnRequest(c, ApproverID, input.ReqID)
+	input.Action = strings.ToLower(input.Action)
+	if !(input.Action == "approve" || input.Action == "reject") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Allowed actions are approve or reject",
+		})
 		return
 	}
-
-	if !(input.Action == "approve" || input.Action == "reject" || input.Action == "Approve" || input.Action == "Reject") {
+	if !(input.Reqtype == "issue" || input.Reqtype == "return" || input.Reqtype == "renew") {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Allowed actions are approve or reject",
+			"error": "Request types can be issue, return OR renew only!",
 		})
 		return
 	}
 
 	if input.Action == "reject" {
-		// REMOVE ENTRY FROM REQUESTS TABLE
-		// if err := config.DB.Model(&models.RequestEvents{}).Delete(input.ReqID).Error; err != nil {
-		if err := config.DB.Where("req_id = ?", input.ReqID).Delete(&models.RequestEvents{}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Request processed succesfully! Issue req rejected!",
-		})
+		rejectRequest(c, ApproverID, input.ReqID, input.Reqtype, strings.TrimSpace(input.Reason))
+		return
+	}
 
+	// HANDLING BOOK RETURNS
+	if input.Reqtype == "return" {
+		handleReturnRequest(c, ApproverID, input.ReqID)
+		return
+	}
+
+	// HANDLING LOAN RENEWALS
+	if input.Reqtype == "renew" {
+		handleRenewRequest(c, ApproverID, input.ReqID)
 		return
 	}
 
 	txErr := config.DB.Transaction(func(tx *gorm.DB) error {
 		var req models.RequestEvents
-		if tx.Where("req_id = ?", input.ReqID).First(&req).Error != nil {
-			return errors.New("request not found")
+		if tx.Where("req_id = ? AND request_type = ? AND lib_id = ?", input.ReqID, "issue", libId).First(&req).Error != nil {
+			return errRequestNotFound
+		}
+		if err := req.CanTransition(models.RequestApproved); err != nil {
+			return requestConflict{err.Error()}
 		}
 
 		var book models.Books
-		if tx.Where("isbn = ?", req.BookID).First(&book).Error != nil || book.Available_copies <= 0 {
-			return errors.New("no copies available")
+		if tx.Where("isbn = ? AND lib_id = ?", req.BookID, req.LibID).First(&book).Error != nil || book.Available_copies <= 0 {
+			return requestConflict{"no copies available"}
 		}
 
-		if tx.Delete(&req).Error != nil {
-			return errors.New("request not found")
+		// COPIES RESERVED FOR READY HOLDS CAN ONLY GO TO THOSE READERS
+		var hold models.Hold
+		fromHold := tx.Where("req_id = ? AND status = ?", req.ReqID, "ready").First(&hold).Error == nil
+		if fromHold {
+			hold.Status = "fulfilled"
+			if tx.Save(&hold).Error != nil {
+				return errors.New("failed to update hold")
+			}
+		} else if int64(book.Available_copies) <= reservedCopies(tx, book.ISBN, book.LibID) {
+			return requestConflict{"no copies available"}
+		}
+
+		// ENFORCING THE CONCURRENT LOAN LIMIT OF THE READER
+		policy := loanPolicy(tx, req.LibID, book.ISBN, req.ReaderID)
+		if policy.MaxLoans > 0 {
+			var activeLoans int64
+			tx.Model(&models.IssueRegistry{}).Where("reader_id = ? AND lib_id = ? AND status = ?", req.ReaderID, req.LibID, "issued").Count(&activeLoans)
+			if activeLoans >= int64(policy.MaxLoans) {
+				return requestConflict{"reader has reached the maximum number of loans"}
+			}
+		}
+
+		before := req
+		if err := transitionRequest(tx, &req, models.RequestApproved, &ApproverID, ""); err != nil {
+			return err
+		}
+		if err := recordAudit(c, tx, "request.approve", "request", req.ReqID, before, req); err != nil {
+			return err
+		}
+
+		// LENDING A SPECIFIC COPY
+		item, err := checkoutItem(tx, book.ISBN, book.LibID, input.Barcode)
+		if err != nil {
+			return err
 		}
 
 		// ISSUE REQUEST APPROVED, ADD THIS RECORD INTO ISSUE REGISTRY
@@ -239,22 +616,17 @@ func ProcessRequest(c *gin.Context) {
 			IssueApproverID:    ApproverID,
 			Status:             "issued",
 			IssueDate:          now,
-			ExpectedReturnDate: now.AddDate(0, 0, 14),
+			ExpectedReturnDate: now.AddDate(0, 0, int(policy.LoanPeriodDays)),
+			ItemID:             &item.ItemID,
 		}
 		if err := tx.Create(&issueReg).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			return err
 		}
-
-		book.Available_copies -= 1
-		tx.Save(&book)
-
-		return nil
+		return recordAudit(c, tx, "loan.issue", "loan", issueReg.IssueID, nil, issueReg)
 	})
 
 	if txErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": txErr.Error()})
+		c.JSON(approvalStatus(txErr), gin.H{"error": txErr.Error()})
 		return
 	}
 
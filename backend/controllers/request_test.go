@@ -24,14 +24,11 @@ func (c *CustomResponseRecorder) CloseNotify() <-chan bool {
 
 
 func TestRaiseBookRequest_Issue(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	book := models.Books{
-		ISBN:            123456,
+		ISBN:            "9780306406157",
 		Title:           "Go Programming",
 		Authors:         "John Doe",
 		Publisher:       "Tech Press",
@@ -43,16 +40,12 @@ func TestRaiseBookRequest_Issue(t *testing.T) {
 	config.DB.Create(&book)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("id", uint(2))     
-		c.Set("libid", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
 
-	router.POST("/requests/raise", RaiseBookRequest)
+	caller.POST("/requests/raise", RaiseBookRequest)
 
 	issuePayload := `{
-		"isbn": 123456,
+		"isbn": "9780306406157",
 		"requestType": "issue"
 	}`
 
@@ -68,14 +61,11 @@ func TestRaiseBookRequest_Issue(t *testing.T) {
 
 
 func TestRaiseBookRequest_Return(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	book := models.Books{
-		ISBN:            123456,
+		ISBN:            "9780306406157",
 		Title:           "Go Programming",
 		Authors:         "John Doe",
 		Publisher:       "Tech Press",
@@ -96,16 +86,12 @@ func TestRaiseBookRequest_Return(t *testing.T) {
 	config.DB.Create(&issueRegistry)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("id", uint(2)) 
-		c.Set("libid", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
 
-	router.POST("/requests/raise",  RaiseBookRequest)
+	caller.POST("/requests/raise",  RaiseBookRequest)
 
 	returnPayload := `{
-		"isbn": 123456,
+		"isbn": "9780306406157",
 		"requestType": "return"
 	}`
 
@@ -120,15 +106,12 @@ func TestRaiseBookRequest_Return(t *testing.T) {
 }
  
 func TestListRequests(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 	router.GET("/requests/list",  ListRequests)
 
 	
-	request1 := models.RequestEvents{BookID: 123456, ReaderID: 2, LibID: 1, RequestType: "issue", RequestDate: time.Now()}
-	request2 := models.RequestEvents{BookID: 123457, ReaderID: 3, LibID: 1, RequestType: "return", RequestDate: time.Now()}
+	request1 := models.RequestEvents{BookID: "9780306406157", ReaderID: 2, LibID: 1, RequestType: "issue", RequestDate: time.Now()}
+	request2 := models.RequestEvents{BookID: "9781492071266", ReaderID: 3, LibID: 1, RequestType: "return", RequestDate: time.Now()}
 	config.DB.Create(&request1)
 	config.DB.Create(&request2)
 
@@ -141,14 +124,11 @@ func TestListRequests(t *testing.T) {
 }
  
 func TestProcessRequest_ApproveIssue(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	book := models.Books{
-		ISBN:            123456,
+		ISBN:            "9780306406157",
 		Title:           "Go Programming",
 		Authors:         "John Doe",
 		Publisher:       "Tech Press",
@@ -168,12 +148,9 @@ func TestProcessRequest_ApproveIssue(t *testing.T) {
 	}
 	config.DB.Create(&request)
  
-	router.Use(func(c *gin.Context) {
-		c.Set("id", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
 
-	router.POST("/requests/process",  ProcessRequest)
+	caller.POST("/requests/process",  ProcessRequest)
 
 	approvePayload := `{
 		"action": "approve",
@@ -192,14 +169,11 @@ func TestProcessRequest_ApproveIssue(t *testing.T) {
 }
  
 func TestProcessRequest_Reject(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	testutils.SetupTestDB()
-
-	router := gin.Default()
+	router := testutils.SetupRouter(testutils.Seed{})
 
 	
 	request := models.RequestEvents{
-		BookID:      123456,
+		BookID:      "9780306406157",
 		ReaderID:    2,
 		LibID:       1,
 		RequestType: "issue",
@@ -208,12 +182,9 @@ func TestProcessRequest_Reject(t *testing.T) {
 	config.DB.Create(&request)
 
 	
-	router.Use(func(c *gin.Context) {
-		c.Set("id", uint(1)) 
-		c.Next()
-	})
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
 
-	router.POST("/requests/process", ProcessRequest)
+	caller.POST("/requests/process", ProcessRequest)
 
 	rejectPayload := `{
 		"action": "reject",
@@ -236,7 +207,7 @@ func TestHandleReturnRequest_Success(t *testing.T) {
 
     
     book := models.Books{
-        ISBN:             123456,
+        ISBN:             "9780306406157",
         Title:            "Go Programming",
         Authors:          "John Doe",
         Publisher:        "Tech Press",
@@ -270,6 +241,7 @@ func TestHandleReturnRequest_Success(t *testing.T) {
     
     c, _ := gin.CreateTestContext(httptest.NewRecorder())
     c.Set("id", uint(1)) 
+    c.Set("libid", uint(1))
     c.Params = []gin.Param{{Key: "reqId", Value: "1"}}
 
     
@@ -286,9 +258,12 @@ func TestHandleReturnRequest_Success(t *testing.T) {
     assert.Nil(t, err)
     assert.Equal(t, uint(5), updatedBook.Available_copies) 
 
-    var deletedRequest models.RequestEvents
-    err = config.DB.Where("req_id = ?", returnRequest.ReqID).First(&deletedRequest).Error
-    assert.NotNil(t, err) 
+    var processedRequest models.RequestEvents
+    err = config.DB.Where("req_id = ?", returnRequest.ReqID).First(&processedRequest).Error
+    assert.Nil(t, err)
+    assert.Equal(t, models.RequestApproved, processedRequest.Status)
+    assert.NotNil(t, processedRequest.ProcessingDate)
+    assert.Equal(t, uint(1), *processedRequest.AdminID)
 }
 
 func TestHandleReturnRequest_RequestNotFound(t *testing.T) {
@@ -301,13 +276,14 @@ func TestHandleReturnRequest_RequestNotFound(t *testing.T) {
 
 	
 	c.Set("id", uint(1)) 
+	c.Set("libid", uint(1))
 	c.Params = []gin.Param{{Key: "reqId", Value: "999"}} 
 
 	
 	handleReturnRequest(c, 1, 999)
 
 	
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusNotFound, w.Code)
 	assert.Contains(t, w.Body.String(), "error")
 }
 
@@ -318,7 +294,7 @@ func TestHandleReturnRequest_IssueRegistryNotFound(t *testing.T) {
 
 	
 	returnRequest := models.RequestEvents{
-		BookID:      123456,
+		BookID:      "9780306406157",
 		ReaderID:    2,
 		LibID:       1,
 		RequestType: "return",
@@ -330,11 +306,289 @@ func TestHandleReturnRequest_IssueRegistryNotFound(t *testing.T) {
 	w := &CustomResponseRecorder{ResponseRecorder: httptest.NewRecorder()}
 	c, _ := gin.CreateTestContext(w)
 	c.Set("id", uint(1)) 
+	c.Set("libid", uint(1))
 
 	
 	handleReturnRequest(c, 1, returnRequest.ReqID)
 
 	
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusConflict, w.Code)
 	assert.Contains(t, w.Body.String(), "error")
 }
+
+func TestRaiseBookRequest_Renew(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.IssueRegistry{
+		ISBN:               "9780306406157",
+		LibID:              1,
+		ReaderID:           2,
+		Status:             "issued",
+		IssueDate:          time.Now(),
+		ExpectedReturnDate: time.Now().AddDate(0, 0, 3),
+	})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
+	caller.POST("/requests/raise", RaiseBookRequest)
+
+	renewPayload := `{
+		"isbn": "9780306406157",
+		"requestType": "renew"
+	}`
+
+	req, _ := http.NewRequest("POST", "/requests/raise", bytes.NewBuffer([]byte(renewPayload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Renew request raised successfully")
+}
+
+func TestRaiseBookRequest_RenewRefusedWhenOnHold(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.IssueRegistry{
+		ISBN:               "9780306406157",
+		LibID:              1,
+		ReaderID:           2,
+		Status:             "issued",
+		IssueDate:          time.Now(),
+		ExpectedReturnDate: time.Now().AddDate(0, 0, 3),
+	})
+	config.DB.Create(&models.Hold{ISBN: "9780306406157", LibID: 1, ReaderID: 3, Status: "waiting"})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 2, LibID: 1})
+	caller.POST("/requests/raise", RaiseBookRequest)
+
+	renewPayload := `{
+		"isbn": "9780306406157",
+		"requestType": "renew"
+	}`
+
+	req, _ := http.NewRequest("POST", "/requests/raise", bytes.NewBuffer([]byte(renewPayload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "book is on hold for another reader")
+}
+
+func TestProcessRequest_ApproveRenew(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	config.DB.Create(&models.CirculationPolicy{LibID: 1, LoanPeriodDays: 21, MaxLoans: 5, MaxRenewals: 1})
+	issueRegistry := models.IssueRegistry{
+		ISBN:               "9780306406157",
+		LibID:              1,
+		ReaderID:           2,
+		Status:             "issued",
+		IssueDate:          time.Now().AddDate(0, 0, -13),
+		ExpectedReturnDate: time.Now().AddDate(0, 0, 1),
+	}
+	config.DB.Create(&issueRegistry)
+
+	renewRequest := models.RequestEvents{BookID: "9780306406157", ReaderID: 2, LibID: 1, RequestType: "renew", RequestDate: time.Now()}
+	config.DB.Create(&renewRequest)
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
+	caller.POST("/requests/process", ProcessRequest)
+
+	approvePayload := `{
+		"action": "approve",
+		"reqtype": "renew",
+		"reqid": 1
+	}`
+
+	req, _ := http.NewRequest("POST", "/requests/process", bytes.NewBuffer([]byte(approvePayload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Renew request approved successfully")
+
+	var renewed models.IssueRegistry
+	config.DB.First(&renewed, issueRegistry.IssueID)
+	assert.Equal(t, uint(1), renewed.RenewalCount)
+	assert.True(t, renewed.ExpectedReturnDate.After(time.Now().AddDate(0, 0, 20)))
+
+	// SECOND RENEWAL EXCEEDS THE LIBRARY LIMIT
+	secondRequest := models.RequestEvents{BookID: "9780306406157", ReaderID: 2, LibID: 1, RequestType: "renew", RequestDate: time.Now()}
+	config.DB.Create(&secondRequest)
+
+	secondPayload := `{
+		"action": "approve",
+		"reqtype": "renew",
+		"reqid": 2
+	}`
+
+	req, _ = http.NewRequest("POST", "/requests/process", bytes.NewBuffer([]byte(secondPayload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "renewal limit reached")
+}
+
+func TestProcessRequest_RenewRefusedWhenOverdue(t *testing.T) {
+	router := testutils.SetupRouter(testutils.Seed{})
+
+	overdue := models.IssueRegistry{ISBN: "9780306406157", LibID: 1, ReaderID: 2, Status: "issued", IssueDate: time.Now().AddDate(0, 0, -20), ExpectedReturnDate: time.Now().AddDate(0, 0, -6)}
+	config.DB.Create(&overdue)
+	config.DB.Create(&models.RequestEvents{BookID: "9780306406157", ReaderID: 2, LibID: 1, RequestType: "renew", RequestDate: time.Now()})
+
+	caller := testutils.AsCaller(router, "/", testutils.Caller{ID: 1, LibID: 1})
+	caller.POST("/requests/process", ProcessRequest)
+
+	// THE FINE ACCRUED SO FAR STAYS DUE, SO THE LOAN IS NOT EXTENDED
+	w := postJSON(router, "/requests/process", `{"action": "approve", "reqtype": "renew", "reqid": 1}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "overdue")
+
+	var loan models.IssueRegistry
+	config.DB.First(&loan, overdue.IssueID)
+	assert.Equal(t, uint(0), loan.RenewalCount)
+	assert.True(t, loan.ExpectedReturnDate.Before(time.Now()))
+
+	var request models.RequestEvents
+	config.DB.First(&request, 1)
+	assert.Equal(t, models.RequestPending, request.Status)
+
+	w = postJSON(router, "/requests/process", `{"action": "approve", "reqtype": "renew", "reqid": 99}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// ROUTER ACTING AS WHOEVER *actor NAMES, IN LIBRARY 1
+func setupRequestHistory(actor *uint) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{})
+	config.DB.Create(&models.Books{ISBN: "9780306406157", Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st", LibID: 1, Total_copies: 1, Available_copies: 1})
+
+	router.Use(func(c *gin.Context) {
+		c.Set("id", *actor)
+		c.Set("libid", uint(1))
+		c.Next()
+	})
+	router.POST("/requests/raise", RaiseBookRequest)
+	router.POST("/requests/process", ProcessRequest)
+	router.GET("/requests/all", ListRequests)
+	router.GET("/requests/:id", GetRequest)
+	router.GET("/my/requests", ListMyRequests)
+	router.GET("/my/requests/:id", GetMyRequest)
+	router.DELETE("/my/requests/:id", CancelRequest)
+	return router
+}
+
+func TestProcessRequest_RejectKeepsHistory(t *testing.T) {
+	actor := uint(2)
+	router := setupRequestHistory(&actor)
+
+	w := postJSON(router, "/requests/raise", `{"isbn": "9780306406157", "requestType": "issue"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	actor = 1
+	w = postJSON(router, "/requests/process", `{"action": "reject", "reqtype": "issue", "reqid": 1, "reason": "Reference copy only"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var rejected models.RequestEvents
+	assert.NoError(t, config.DB.Preload("Transitions").First(&rejected, 1).Error)
+	assert.Equal(t, models.RequestRejected, rejected.Status)
+	assert.Equal(t, "Reference copy only", rejected.RejectionReason)
+	assert.NotNil(t, rejected.ProcessingDate)
+	assert.Equal(t, uint(1), *rejected.AdminID)
+	assert.Len(t, rejected.Transitions, 2)
+
+	// A SETTLED REQUEST CAN NOT BE SETTLED AGAIN
+	w = postJSON(router, "/requests/process", `{"action": "approve", "reqtype": "issue", "reqid": 1}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "request is already rejected")
+	w = postJSON(router, "/requests/process", `{"action": "reject", "reqtype": "issue", "reqid": 1}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = postJSON(router, "/requests/process", `{"action": "reject", "reqtype": "renew", "reqid": 1}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// THE REJECTED REQUEST NO LONGER COUNTS AS A DUPLICATE
+	actor = 2
+	w = postJSON(router, "/requests/raise", `{"isbn": "9780306406157", "requestType": "issue"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/requests/raise", `{"isbn": "9780306406157", "requestType": "issue"}`)
+	assert.Contains(t, w.Body.String(), "Duplicate request!")
+}
+
+func TestRequestHistory(t *testing.T) {
+	actor := uint(2)
+	router := setupRequestHistory(&actor)
+
+	postJSON(router, "/requests/raise", `{"isbn": "9780306406157", "requestType": "issue"}`)
+	actor = 3
+	postJSON(router, "/requests/raise", `{"isbn": "9780306406157", "requestType": "issue"}`)
+
+	// READERS SEE AND CANCEL THEIR OWN REQUESTS ONLY
+	code, body := getJSON(router, "/my/requests")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body["requests"], 1)
+	assert.Equal(t, http.StatusNotFound, getRequest(router, "/my/requests/1").Code)
+	assert.Equal(t, http.StatusNotFound, deleteRequest(router, "/my/requests/1").Code)
+
+	w := deleteRequest(router, "/my/requests/2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusConflict, deleteRequest(router, "/my/requests/2").Code)
+
+	code, body = getJSON(router, "/my/requests/2")
+	assert.Equal(t, http.StatusOK, code)
+	request := body["request"].(map[string]interface{})
+	assert.Equal(t, models.RequestCancelled, request["status"])
+	transitions := request["transitions"].([]interface{})
+	assert.Len(t, transitions, 2)
+	last := transitions[1].(map[string]interface{})
+	assert.Equal(t, models.RequestPending, last["from_status"])
+	assert.Equal(t, models.RequestCancelled, last["to_status"])
+	assert.Equal(t, float64(3), last["actorID"])
+
+	// STAFF SEE THE PENDING QUEUE BY DEFAULT AND ANY STATUS ON ASKING
+	actor = 1
+	code, body = getJSON(router, "/requests/all")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body["requests"], 1)
+	code, body = getJSON(router, "/requests/all?status=cancelled")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body["requests"], 1)
+	code, body = getJSON(router, "/requests/all?status=all&reader_id=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body["requests"], 1)
+	code, _ = getJSON(router, "/requests/all?status=lost")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body = getJSON(router, "/requests/2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body["request"].(map[string]interface{})["transitions"], 2)
+	assert.Equal(t, http.StatusNotFound, getRequest(router, "/requests/9").Code)
+}
+
+func TestProcessRequest_OnlyRequestsOfTheLibrary(t *testing.T) {
+	actor := uint(1)
+	router := setupRequestHistory(&actor)
+	types := []string{"issue", "return", "renew"}
+	for _, reqType := range types {
+		config.DB.Create(&models.RequestEvents{BookID: "9780306406157", ReaderID: 2, LibID: 2, RequestType: reqType, RequestDate: time.Now()})
+	}
+
+	// STAFF OF LIBRARY 1 CAN NOT SETTLE THE REQUESTS OF LIBRARY 2 BY THEIR IDS
+	for i, reqType := range types {
+		reqID := string(rune('1' + i))
+		for _, action := range []string{"approve", "reject"} {
+			w := postJSON(router, "/requests/process", `{"action": "`+action+`", "reqtype": "`+reqType+`", "reqid": `+reqID+`}`)
+			assert.NotEqual(t, http.StatusOK, w.Code, action+" "+reqType)
+		}
+	}
+
+	var pending int64
+	config.DB.Model(&models.RequestEvents{}).Where("status = ?", models.RequestPending).Count(&pending)
+	assert.Equal(t, int64(3), pending)
+}
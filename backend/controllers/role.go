@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Whether the account behind the request holds a permission. RequirePermission
+// leaves the resolved set in the context; without it the built-in role decides
+func granted(c *gin.Context, p permissions.Permission) bool {
+	if set, ok := c.Get("permissions"); ok {
+		return set.(permissions.Set).Has(p)
+	}
+	role, _ := c.Get("role")
+	return permissions.ForRole(fmt.Sprint(role)).Has(p)
+}
+
+// Custom role as returned by the API, with its permissions
+func roleResponse(role models.Role) gin.H {
+	perms := permissions.Set{}
+	for _, g := range role.Grants {
+		perms[permissions.Permission(g.Permission)] = true
+	}
+	return gin.H{
+		"roleID":      role.RoleID,
+		"name":        role.Name,
+		"base_role":   role.BaseRole,
+		"permissions": perms.List(),
+	}
+}
+
+// Checks the permissions a custom role is to grant
+func validateGrants(perms []permissions.Permission) error {
+	for _, p := range perms {
+		if !permissions.Valid(p) {
+			return fmt.Errorf("Unknown permission %q", p)
+		}
+		if !permissions.Delegable(p) {
+			return fmt.Errorf("Permission %q is reserved to the owner", p)
+		}
+	}
+	return nil
+}
+
+// Replaces the permissions of a custom role
+func setGrants(tx *gorm.DB, roleID uint, perms []permissions.Permission) error {
+	if err := tx.Where("role_id = ?", roleID).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	seen := permissions.Set{}
+	for _, p := range perms {
+		if seen.Has(p) {
+			continue
+		}
+		seen[p] = true
+		if err := tx.Create(&models.RolePermission{RoleID: roleID, Permission: string(p)}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Custom role as stored, for the audit log
+func storedRole(tx *gorm.DB, roleID uint) gin.H {
+	var role models.Role
+	if err := tx.Preload("Grants").First(&role, roleID).Error; err != nil {
+		return nil
+	}
+	return roleResponse(role)
+}
+
+func findRole(c *gin.Context) (models.Role, bool) {
+	libId, _ := c.Get("libid")
+	var role models.Role
+	if err := config.DB.Preload("Grants").Where("role_id = ? AND lib_id = ?", c.Param("id"), libId).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return role, false
+	}
+	return role, true
+}
+
+// LISTING BUILT-IN AND CUSTOM ROLES OF THE LIBRARY
+func ListRoles(c *gin.Context) {
+	libId, _ := c.Get("libid")
+
+	var roles []models.Role
+	if err := config.DB.Preload("Grants").Where("lib_id = ?", libId).Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	builtIn := []gin.H{}
+	for _, name := range []string{permissions.Owner, permissions.Admin, permissions.Reader} {
+		builtIn = append(builtIn, gin.H{"name": name, "permissions": permissions.ForRole(name).List()})
+	}
+	custom := []gin.H{}
+	for _, role := range roles {
+		custom = append(custom, roleResponse(role))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"built_in": builtIn, "roles": custom, "permissions": permissions.All()})
+}
+
+// DEFINING A CUSTOM ROLE
+func CreateRole(c *gin.Context) {
+	var input struct {
+		Name        string                   `json:"name" binding:"required"`
+		BaseRole    string                   `json:"base_role" binding:"required,oneof=Admin Reader"`
+		Permissions []permissions.Permission `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if permissions.IsBuiltIn(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is taken by a built-in role"})
+		return
+	}
+	if err := validateGrants(input.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var existing int64
+	config.DB.Model(&models.Role{}).Where("lib_id = ? AND name = ?", libId, input.Name).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	role := models.Role{LibID: libId.(uint), Name: input.Name, BaseRole: input.BaseRole}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		if err := setGrants(tx, role.RoleID, input.Permissions); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "role.create", "role", role.RoleID, nil, storedRole(tx, role.RoleID))
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.Preload("Grants").First(&role, role.RoleID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Role created", "role": roleResponse(role)})
+}
+
+// RENAMING A CUSTOM ROLE OR CHANGING ITS PERMISSIONS
+func UpdateRole(c *gin.Context) {
+	var input struct {
+		Name        *string                   `json:"name"`
+		Permissions *[]permissions.Permission `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+	before := roleResponse(role)
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || permissions.IsBuiltIn(name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role name"})
+			return
+		}
+		var existing int64
+		config.DB.Model(&models.Role{}).Where("lib_id = ? AND name = ? AND role_id <> ?", role.LibID, name, role.RoleID).Count(&existing)
+		if existing > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+			return
+		}
+		role.Name = name
+	}
+	if input.Permissions != nil {
+		if err := validateGrants(*input.Permissions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// HOLDERS OF THE ROLE GET THE NEW PERMISSIONS ON THEIR NEXT REQUEST
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Update("name", role.Name).Error; err != nil {
+			return err
+		}
+		if input.Permissions != nil {
+			if err := setGrants(tx, role.RoleID, *input.Permissions); err != nil {
+				return err
+			}
+		}
+		return recordAudit(c, tx, "role.update", "role", role.RoleID, before, storedRole(tx, role.RoleID))
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.Preload("Grants").First(&role, role.RoleID)
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "role": roleResponse(role)})
+}
+
+// DELETING A CUSTOM ROLE, ITS HOLDERS FALL BACK TO THEIR BUILT-IN ROLE
+func DeleteRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(c, tx, "role.delete", "role", role.RoleID, roleResponse(role), nil); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("role_id = ?", role.RoleID).Update("role_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.RoleID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// GIVING A USER A CUSTOM ROLE, OR TAKING IT AWAY WITH A NULL role_id
+func AssignRole(c *gin.Context) {
+	var input struct {
+		RoleID *uint `json:"role_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	var user models.User
+	if err := config.DB.Where("id = ? AND lib_id = ?", c.Param("id"), libId).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if input.RoleID != nil {
+		var role models.Role
+		if err := config.DB.Where("role_id = ? AND lib_id = ?", *input.RoleID, libId).First(&role).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		// A CUSTOM ROLE ONLY ADJUSTS THE ACCOUNTS IT WAS DEFINED FOR
+		if role.BaseRole != user.Role {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not apply to this account"})
+			return
+		}
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return auditedUserUpdate(c, tx, "user.role_assign", user, func() error {
+			return tx.Model(&user).Update("role_id", input.RoleID).Error
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned", "role_id": input.RoleID})
+}
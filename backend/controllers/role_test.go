@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRoles(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}, {LibID: 2, Name: "Other Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@example.com", Contact_number: "1", Role: "Owner", LibID: 1},
+			{ID: 2, Name: "Reader", Email: "reader@example.com", Contact_number: "2", Role: "Reader", LibID: 1},
+			{ID: 3, Name: "Elsewhere", Email: "other@example.com", Contact_number: "3", Role: "Reader", LibID: 2},
+		},
+	})
+	owner := testutils.AsCaller(router, "/owner", testutils.Caller{ID: 1, LibID: 1, Role: "Owner"})
+	owner.GET("/roles", ListRoles)
+	owner.POST("/roles", CreateRole)
+	owner.PATCH("/roles/:id", UpdateRole)
+	owner.DELETE("/roles/:id", DeleteRole)
+	owner.PUT("/users/:id/custom-role", AssignRole)
+	return router
+}
+
+func putJSON(router *gin.Engine, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateRole_Validation(t *testing.T) {
+	router := setupRoles(t)
+
+	w := postJSON(router, "/owner/roles", `{"name": "Admin", "base_role": "Admin", "permissions": []}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/owner/roles", `{"name": "Helper", "base_role": "Owner", "permissions": []}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/owner/roles", `{"name": "Helper", "base_role": "Admin", "permissions": ["books:burn"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Unknown permission")
+
+	w = postJSON(router, "/owner/roles", `{"name": "Helper", "base_role": "Admin", "permissions": ["roles:manage"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reserved to the owner")
+
+	w = postJSON(router, "/owner/roles", `{"name": "Helper", "base_role": "Reader", "permissions": ["books:read", "books:read"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = postJSON(router, "/owner/roles", `{"name": "Helper", "base_role": "Reader", "permissions": []}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = patchJSON(router, "/owner/roles/1", `{"permissions": ["books:read", "holds:own"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	role := decode(t, w.Body.Bytes())["role"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"books:read", "holds:own"}, role["permissions"])
+}
+
+func TestAssignRole(t *testing.T) {
+	router := setupRoles(t)
+	config.DB.Create(&models.Role{RoleID: 1, LibID: 1, Name: "Desk", BaseRole: "Admin"})
+	config.DB.Create(&models.Role{RoleID: 2, LibID: 1, Name: "Restricted", BaseRole: "Reader"})
+	config.DB.Create(&models.Role{RoleID: 3, LibID: 2, Name: "Foreign", BaseRole: "Reader"})
+
+	// A ROLE ONLY FITS THE KIND OF ACCOUNT IT WAS MADE FOR, IN ITS OWN LIBRARY
+	assert.Equal(t, http.StatusBadRequest, putJSON(router, "/owner/users/2/custom-role", `{"role_id": 1}`).Code)
+	assert.Equal(t, http.StatusNotFound, putJSON(router, "/owner/users/2/custom-role", `{"role_id": 3}`).Code)
+	assert.Equal(t, http.StatusNotFound, putJSON(router, "/owner/users/3/custom-role", `{"role_id": 2}`).Code)
+
+	assert.Equal(t, http.StatusOK, putJSON(router, "/owner/users/2/custom-role", `{"role_id": 2}`).Code)
+	var user models.User
+	config.DB.First(&user, 2)
+	assert.Equal(t, uint(2), *user.RoleID)
+
+	// DELETING THE ROLE RETURNS ITS HOLDERS TO THEIR BUILT-IN ROLE
+	req, _ := http.NewRequest("DELETE", "/owner/roles/2", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	config.DB.First(&user, 2)
+	assert.Nil(t, user.RoleID)
+}
+
+func TestGranted_FallsBackToBuiltInRole(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("role", "Admin")
+	assert.True(t, granted(c, permissions.UsersManage))
+	assert.False(t, granted(c, permissions.StaffManage))
+
+	c.Set("permissions", permissions.NewSet(permissions.StaffManage))
+	assert.True(t, granted(c, permissions.StaffManage))
+	assert.False(t, granted(c, permissions.UsersManage))
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/middleware"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// The refresh cookie reaches the refresh endpoint and every logout route
+const refreshCookie = "refresh_token"
+
+var errRefreshTokenReused = errors.New("Refresh token reuse detected, please log in again")
+
+// Clients that keep no cookies, such as kiosks and scripts, send this header
+// with the value "bearer" to get their tokens in the response body instead
+const authModeHeader = "X-Auth-Mode"
+
+// Domain of the auth cookies; empty keeps them to the host that set them
+func cookieDomain() string {
+	return os.Getenv("COOKIE_DOMAIN")
+}
+
+func bearerMode(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader(authModeHeader), "bearer")
+}
+
+func setAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	// FOR SETTING SECURE SITE
+	prodMode := os.Getenv("PROD_MODE") == "true"
+	c.SetCookie("token", accessToken, int(utils.AccessTokenTTL.Seconds()), "/", cookieDomain(), prodMode, true)
+	c.SetCookie(refreshCookie, refreshToken, int(utils.RefreshTokenTTL.Seconds()), "/v1/", cookieDomain(), prodMode, true)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie("token", "", -1, "/", cookieDomain(), false, true)
+	c.SetCookie(refreshCookie, "", -1, "/v1/", cookieDomain(), false, true)
+}
+
+// Hands out the tokens of a session: as cookies to browsers, in the response
+// body to clients in bearer mode
+func sendTokens(c *gin.Context, accessToken, refreshToken string, response gin.H) {
+	if bearerMode(c) {
+		response["token_type"] = "Bearer"
+		response["access_token"] = accessToken
+		response["refresh_token"] = refreshToken
+		response["expires_in"] = int(utils.AccessTokenTTL.Seconds())
+	} else {
+		setAuthCookies(c, accessToken, refreshToken)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// A NEW REFRESH TOKEN OF THE SESSION, VALID UNTIL THE SESSION ENDS
+func issueRefreshToken(tx *gorm.DB, session models.Session) (string, error) {
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	refresh := models.RefreshToken{SessionID: session.SessionID, TokenHash: hash, ExpiresAt: session.ExpiresAt}
+	return token, tx.Create(&refresh).Error
+}
+
+// STARTING A SESSION: A NEW TOKEN FAMILY WITH ITS FIRST REFRESH TOKEN
+func startSession(user models.User) (accessToken, refreshToken string, err error) {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		session := models.Session{UserID: user.ID, LibID: user.LibID, ExpiresAt: time.Now().Add(utils.RefreshTokenTTL)}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		if refreshToken, err = issueRefreshToken(tx, session); err != nil {
+			return err
+		}
+		accessToken, err = utils.GenerateJWT(user.ID, user.LibID, user.Email, user.Role, session.SessionID)
+		return err
+	})
+	return accessToken, refreshToken, err
+}
+
+func revokeSession(db *gorm.DB, sessionID uint) error {
+	return db.Model(&models.Session{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Logs the user out everywhere
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// Session of the request, from the access token or else the refresh token
+func currentSessionID(c *gin.Context) (uint, bool) {
+	if token := middleware.AccessToken(c); token != "" {
+		if claims, err := utils.ParseJWT(token); err == nil {
+			return claims.SessionID, true
+		}
+	}
+	if token, err := c.Cookie(refreshCookie); err == nil && token != "" {
+		var stored models.RefreshToken
+		if err := config.DB.Where("token_hash = ?", utils.HashToken(token)).First(&stored).Error; err == nil {
+			return stored.SessionID, true
+		}
+	}
+	return 0, false
+}
+
+// REVOKING EVERY SESSION OF A USER OF THE LIBRARY
+func RevokeUserSessions(c *gin.Context) {
+	user, ok := findLibraryUser(c)
+	if !ok {
+		return
+	}
+	if !canManage(c, user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can revoke sessions of staff"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "user.sessions_revoke", "user", user.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
+
+// Refresh token from its cookie, or from the body for clients without cookies
+func refreshTokenOf(c *gin.Context) string {
+	if token, err := c.Cookie(refreshCookie); err == nil && token != "" {
+		return token
+	}
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	c.ShouldBindJSON(&input)
+	return input.RefreshToken
+}
+
+// ROTATING A REFRESH TOKEN FOR A NEW ACCESS TOKEN
+func Refresh(c *gin.Context) {
+	token := refreshTokenOf(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := config.DB.Preload("Session").Where("token_hash = ?", utils.HashToken(token)).First(&stored).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// A SPENT TOKEN COMING BACK MEANS IT LEAKED, SO THE WHOLE FAMILY IS REVOKED
+	if stored.UsedAt != nil {
+		revokeSession(config.DB, stored.SessionID)
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errRefreshTokenReused.Error()})
+		return
+	}
+	if !stored.Session.Active(time.Now()) {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+		return
+	}
+
+	// ROLE OR EMAIL MAY HAVE CHANGED SINCE LOGIN
+	var user models.User
+	if err := config.DB.First(&user, stored.Session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var refreshToken string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// ONLY ONE OF TWO CONCURRENT REFRESHES WITH THE SAME TOKEN WINS
+		result := tx.Model(&models.RefreshToken{}).Where("token_id = ? AND used_at IS NULL", stored.TokenID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		var err error
+		refreshToken, err = issueRefreshToken(tx, stored.Session)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		revokeSession(config.DB, stored.SessionID)
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	accessToken, err := utils.GenerateJWT(user.ID, user.LibID, user.Email, user.Role, stored.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sendTokens(c, accessToken, refreshToken, gin.H{"message": "Token refreshed"})
+}
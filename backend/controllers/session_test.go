@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSessionRouter(t *testing.T) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Users: []models.User{
+			{Name: "Reader", Email: "reader@example.com", Contact_number: "1", Role: "Reader", LibID: 1},
+		},
+	})
+	router.POST("/auth/login", Login)
+	router.POST("/auth/refresh", Refresh)
+	router.GET("/logout", Logout)
+	return router
+}
+
+// COOKIES SET BY A RESPONSE, BY NAME
+func cookiesOf(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func login(t *testing.T, router *gin.Engine) map[string]*http.Cookie {
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBufferString(`{"email": "reader@example.com", "password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return cookiesOf(w)
+}
+
+func refresh(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: refreshCookie, Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLogin_IssuesAccessAndRefreshTokens(t *testing.T) {
+	router := setupSessionRouter(t)
+
+	cookies := login(t, router)
+	assert.NotEmpty(t, cookies["token"].Value)
+	assert.Equal(t, int((15 * time.Minute).Seconds()), cookies["token"].MaxAge)
+	assert.NotEmpty(t, cookies[refreshCookie].Value)
+	assert.Equal(t, "/v1/", cookies[refreshCookie].Path)
+
+	// ONLY THE HASH OF THE REFRESH TOKEN IS STORED
+	var stored models.RefreshToken
+	config.DB.First(&stored)
+	assert.NotEqual(t, cookies[refreshCookie].Value, stored.TokenHash)
+	assert.Len(t, stored.TokenHash, 64)
+}
+
+func TestRefresh_RotatesToken(t *testing.T) {
+	router := setupSessionRouter(t)
+	first := login(t, router)[refreshCookie].Value
+
+	w := refresh(router, first)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rotated := cookiesOf(w)
+	assert.NotEmpty(t, rotated["token"].Value)
+	assert.NotEqual(t, first, rotated[refreshCookie].Value)
+
+	// THE ROTATED TOKEN KEEPS THE SESSION GOING
+	w = refresh(router, rotated[refreshCookie].Value)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var sessions int64
+	config.DB.Model(&models.Session{}).Count(&sessions)
+	assert.Equal(t, int64(1), sessions)
+}
+
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	router := setupSessionRouter(t)
+	first := login(t, router)[refreshCookie].Value
+
+	w := refresh(router, first)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rotated := cookiesOf(w)[refreshCookie].Value
+
+	// THE SPENT TOKEN IS REPLAYED
+	w = refresh(router, first)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "reuse detected")
+
+	// AND THE LEGITIMATE TOKEN OF THE SAME FAMILY DIES WITH IT
+	w = refresh(router, rotated)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session expired")
+
+	var session models.Session
+	config.DB.First(&session)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func TestRefresh_RejectsUnknownAndMissingTokens(t *testing.T) {
+	router := setupSessionRouter(t)
+
+	w := refresh(router, "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid refresh token")
+
+	req, _ := http.NewRequest("POST", "/auth/refresh", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Refresh token required")
+}
+
+func TestRefresh_ExpiredSession(t *testing.T) {
+	router := setupSessionRouter(t)
+	token := login(t, router)[refreshCookie].Value
+
+	config.DB.Model(&models.Session{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+
+	w := refresh(router, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session expired")
+}
+
+func TestLogout_RevokesSession(t *testing.T) {
+	router := setupSessionRouter(t)
+	token := login(t, router)[refreshCookie].Value
+
+	req, _ := http.NewRequest("GET", "/logout", nil)
+	req.AddCookie(&http.Cookie{Name: refreshCookie, Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, -1, cookiesOf(w)[refreshCookie].MaxAge)
+
+	w = refresh(router, token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/oidc"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Time a browser has at the identity provider before the login is dropped
+const ssoLoginTTL = 10 * time.Minute
+
+// Cookie tying a pending login to the browser that started it
+const ssoStateCookie = "sso_state"
+
+var errSSOLoginUnknown = errors.New("Login expired or already used, please start again")
+
+// Where the identity provider sends the browser back to, registered with it
+func ssoRedirectURI() string {
+	if uri := os.Getenv("SSO_REDIRECT_URL"); uri != "" {
+		return uri
+	}
+	return "http://localhost:8080/v1/auth/sso/callback"
+}
+
+// Page of the frontend the browser lands on once logged in
+func ssoLandingURL() string {
+	if uri := os.Getenv("SSO_LANDING_URL"); uri != "" {
+		return uri
+	}
+	return "http://localhost:3000/"
+}
+
+// Configuration of a library with single sign-on switched on
+func enabledSSOConfig(libID interface{}) (models.SSOConfig, bool) {
+	var cfg models.SSOConfig
+	if err := config.DB.Where("lib_id = ? AND enabled = ?", libID, true).First(&cfg).Error; err != nil {
+		return cfg, false
+	}
+	return cfg, true
+}
+
+func ssoConfigResponse(cfg models.SSOConfig) gin.H {
+	return gin.H{
+		"lib_id":            cfg.LibID,
+		"issuer":            cfg.Issuer,
+		"client_id":         cfg.ClientID,
+		"has_client_secret": cfg.ClientSecret != "",
+		"enabled":           cfg.Enabled,
+		"auto_provision":    cfg.AutoProvision,
+		"reader_type":       cfg.ReaderType,
+		"email_domain":      cfg.EmailDomain,
+		"login_url":         fmt.Sprintf("/v1/auth/sso/%d/login", cfg.LibID),
+		"redirect_uri":      ssoRedirectURI(),
+	}
+}
+
+// VIEWING THE SINGLE SIGN-ON SETTINGS OF THE LIBRARY
+func GetSSOConfig(c *gin.Context) {
+	libId, _ := c.Get("libid")
+	var cfg models.SSOConfig
+	if err := config.DB.Where("lib_id = ?", libId).First(&cfg).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sso": ssoConfigResponse(cfg)})
+}
+
+// CONFIGURING THE IDENTITY PROVIDER OF THE LIBRARY
+func UpdateSSOConfig(c *gin.Context) {
+	var input struct {
+		Issuer        string  `json:"issuer" binding:"required,url"`
+		ClientID      string  `json:"client_id" binding:"required"`
+		ClientSecret  *string `json:"client_secret"`
+		Enabled       bool    `json:"enabled"`
+		AutoProvision bool    `json:"auto_provision"`
+		ReaderType    string  `json:"reader_type"`
+		EmailDomain   string  `json:"email_domain"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	if err := oidc.CheckIssuer(input.Issuer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The issuer must be an https URL on a public host"})
+		return
+	}
+	// A TYPO IN THE ISSUER SHOULD SHOW NOW, NOT WHEN READERS TRY TO LOG IN. WHAT
+	// WENT WRONG STAYS IN THE LOG, IT WOULD DESCRIBE WHATEVER THE URL REACHED
+	if input.Enabled {
+		if _, err := oidc.Discover(c.Request.Context(), input.Issuer); err != nil {
+			log.Printf("SSO discovery failed for library %v: %v", libId, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identity provider could not be used, check the issuer URL"})
+			return
+		}
+	}
+
+	cfg := models.SSOConfig{LibID: libId.(uint)}
+	var before gin.H
+	if config.DB.Where("lib_id = ?", cfg.LibID).Take(&cfg).Error == nil {
+		before = ssoConfigResponse(cfg)
+	}
+	cfg.Issuer = strings.TrimSuffix(input.Issuer, "/")
+	cfg.ClientID = input.ClientID
+	if input.ClientSecret != nil {
+		cfg.ClientSecret = *input.ClientSecret
+	}
+	cfg.Enabled = input.Enabled
+	cfg.AutoProvision = input.AutoProvision
+	cfg.ReaderType = input.ReaderType
+	cfg.EmailDomain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(input.EmailDomain)), "@")
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&cfg).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "sso.update", "sso_config", cfg.LibID, before, ssoConfigResponse(cfg))
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Single sign-on updated", "sso": ssoConfigResponse(cfg)})
+}
+
+// STARTING A SINGLE SIGN-ON LOGIN: OFF TO THE IDENTITY PROVIDER
+func StartSSOLogin(c *gin.Context) {
+	cfg, ok := enabledSSOConfig(c.Param("libid"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled for this library"})
+		return
+	}
+	provider, err := oidc.Cached(c.Request.Context(), cfg.Issuer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	login := models.SSOLogin{
+		LibID:        cfg.LibID,
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ssoLoginTTL),
+	}
+	if err := config.DB.Create(&login).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// THE STATE IS ALSO KEPT BY THE BROWSER, SO A CALLBACK ONLY FINISHES THE
+	// LOGIN THIS BROWSER STARTED AND NOBODY CAN LOG IT INTO THEIR OWN ACCOUNT
+	setSSOStateCookie(c, state, int(ssoLoginTTL.Seconds()))
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(cfg.ClientID, ssoRedirectURI(), state, nonce, verifier))
+}
+
+// Lax, so the cookie comes along on the identity provider's redirect back
+func setSSOStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, maxAge, "/v1/auth/sso", cookieDomain(), os.Getenv("PROD_MODE") == "true", true)
+}
+
+// Takes the pending login of a state, so it can not be finished twice
+func takeSSOLogin(state string) (models.SSOLogin, error) {
+	var login models.SSOLogin
+	if err := config.DB.Where("state_hash = ?", utils.HashToken(state)).First(&login).Error; err != nil {
+		return login, errSSOLoginUnknown
+	}
+	result := config.DB.Where("sso_login_id = ?", login.SSOLoginID).Delete(&models.SSOLogin{})
+	if result.Error != nil || result.RowsAffected == 0 || !time.Now().Before(login.ExpiresAt) {
+		return login, errSSOLoginUnknown
+	}
+	return login, nil
+}
+
+// User of the library behind an identity, linking or creating one when the
+// library allows it. The status says how to answer when there is none
+func ssoUser(cfg models.SSOConfig, issuer string, claims *oidc.Claims) (models.User, int, error) {
+	var identity models.UserIdentity
+	if err := config.DB.Preload("User").Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error; err == nil {
+		if identity.User.LibID != cfg.LibID {
+			return identity.User, http.StatusForbidden, errors.New("This identity belongs to another library")
+		}
+		return identity.User, http.StatusOK, nil
+	}
+
+	// UNVERIFIED EMAILS COULD BE ANYONE'S, SO THEY NEITHER LINK NOR PROVISION
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return models.User{}, http.StatusForbidden, errors.New("The identity provider did not vouch for an email address")
+	}
+
+	link := func(tx *gorm.DB, user models.User) error {
+		return tx.Create(&models.UserIdentity{UserID: user.ID, Issuer: issuer, Subject: claims.Subject}).Error
+	}
+
+	var user models.User
+	if err := config.DB.Where("email = ?", email).First(&user).Error; err == nil {
+		if user.LibID != cfg.LibID {
+			return user, http.StatusConflict, errors.New("This email belongs to an account of another library")
+		}
+		if err := link(config.DB, user); err != nil {
+			return user, http.StatusInternalServerError, err
+		}
+		return user, http.StatusOK, nil
+	}
+
+	if !cfg.AutoProvision {
+		return user, http.StatusForbidden, errors.New("No account of this library matches your identity")
+	}
+	if cfg.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(email), "@"+cfg.EmailDomain) {
+		return user, http.StatusForbidden, errors.New("Accounts are only created for " + cfg.EmailDomain + " addresses")
+	}
+
+	// THE PASSWORD IS RANDOM AND NEVER SHOWN; A RESET CAN STILL SET ONE
+	secret, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = email
+	}
+	user = models.User{
+		Name:       name,
+		Email:      email,
+		Password:   string(hashedPassword),
+		Role:       permissions.Reader,
+		ReaderType: cfg.ReaderType,
+		LibID:      cfg.LibID,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return link(tx, user)
+	}); err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+	return user, http.StatusOK, nil
+}
+
+// FINISHING A SINGLE SIGN-ON LOGIN WHEN THE IDENTITY PROVIDER SENDS THE BROWSER BACK
+func FinishSSOLogin(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "The identity provider refused the login: " + reason})
+		return
+	}
+	state := c.Query("state")
+	browserState, _ := c.Cookie(ssoStateCookie)
+	setSSOStateCookie(c, "", -1)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not started from this browser, please start again"})
+		return
+	}
+	login, err := takeSSOLogin(state)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cfg, ok := enabledSSOConfig(login.LibID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled for this library"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider, err := oidc.Cached(ctx, cfg.Issuer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+	idToken, err := provider.Exchange(ctx, cfg.ClientID, cfg.ClientSecret, ssoRedirectURI(), c.Query("code"), login.CodeVerifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login could not be completed with the identity provider"})
+		return
+	}
+	claims, err := provider.Verify(ctx, idToken, cfg.ClientID, login.Nonce)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid identity token"})
+		return
+	}
+
+	user, status, err := ssoUser(cfg, provider.Issuer, claims)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+		return
+	}
+
+	// A SECOND FACTOR ASKED FOR BY THE LIBRARY IS STILL GIVEN AT v1/auth/login/2fa
+	landing, _ := url.Parse(ssoLandingURL())
+	mfaToken, enrol, err := secondFactorChallenge(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if mfaToken != "" {
+		// IN THE FRAGMENT, WHICH BROWSERS DO NOT SEND ON TO ANY SERVER
+		landing.Fragment = url.Values{"mfa_token": {mfaToken}, "enrollment_required": {fmt.Sprint(enrol)}}.Encode()
+		c.Redirect(http.StatusFound, landing.String())
+		return
+	}
+
+	accessToken, refreshToken, err := startSession(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setAuthCookies(c, accessToken, refreshToken)
+	c.Redirect(http.StatusFound, landing.String())
+}
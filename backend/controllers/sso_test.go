@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/oidc"
+	"github.com/prabhatKr-1/lib-man-sys/backend/oidc/oidctest"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSSO(t *testing.T) (*gin.Engine, *oidctest.Issuer) {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}, {LibID: 2, Name: "Other Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Owner", Email: "owner@campus.edu", Contact_number: "1", Role: "Owner", LibID: 1},
+			{ID: 2, Name: "Rita", Email: "rita@campus.edu", Contact_number: "2", Role: "Reader", LibID: 1},
+			{ID: 3, Name: "Else", Email: "else@campus.edu", Contact_number: "3", Role: "Reader", LibID: 2},
+		},
+	})
+	t.Setenv("SSO_LANDING_URL", "http://frontend.test/home")
+
+	issuer := oidctest.NewIssuer("library-app", "client-secret")
+	t.Cleanup(issuer.Close)
+	// THE TEST ISSUER LISTENS ON PLAIN HTTP ON THIS MACHINE
+	oidc.AllowInsecure = true
+	t.Cleanup(func() { oidc.AllowInsecure = false })
+
+	config.DB.Create(&models.SSOConfig{LibID: 1, Issuer: issuer.URL(), ClientID: "library-app", ClientSecret: "client-secret", Enabled: true})
+
+	router.GET("/v1/auth/sso/:libid/login", StartSSOLogin)
+	router.GET("/v1/auth/sso/callback", FinishSSOLogin)
+	owner := testutils.AsCaller(router, "/owner", testutils.Caller{ID: 1, LibID: 1, Role: "Owner"})
+	owner.GET("/sso", GetSSOConfig)
+	owner.PUT("/sso", UpdateSSOConfig)
+	return router, issuer
+}
+
+// RUNS THE BROWSER'S SIDE OF A LOGIN: TO THE ISSUER AND BACK TO THE CALLBACK
+func ssoLogin(t *testing.T, router *gin.Engine, issuer *oidctest.Issuer, user oidctest.User) (*httptest.ResponseRecorder, string) {
+	w, callback := ssoCallback(t, router, issuer, user)
+	return sendWithCookies(router, callback, w.Result().Cookies()), callback
+}
+
+// THE LOGIN STARTED BY THE BROWSER AND THE CALLBACK IT IS SENT BACK TO
+func ssoCallback(t *testing.T, router *gin.Engine, issuer *oidctest.Issuer, user oidctest.User) (*httptest.ResponseRecorder, string) {
+	w := getRequest(router, "/v1/auth/sso/1/login")
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	issuer.LogInAs(user)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return w, back.Path + "?" + back.RawQuery
+}
+
+func sendWithCookies(router *gin.Engine, url string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSSO_CallbackNeedsTheBrowserThatStarted(t *testing.T) {
+	router, issuer := setupSSO(t)
+	rita := oidctest.User{Subject: "sub-rita", Email: "rita@campus.edu", EmailVerified: true}
+
+	// A CALLBACK LINK PLANTED ON A VICTIM, WHOSE BROWSER NEVER STARTED THE LOGIN
+	_, callback := ssoCallback(t, router, issuer, rita)
+	w := getRequest(router, callback)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, cookiesOf(w)["token"])
+
+	// OR ONE WHOSE BROWSER STARTED A LOGIN OF ITS OWN
+	started, _ := ssoCallback(t, router, issuer, rita)
+	w = sendWithCookies(router, callback, started.Result().Cookies())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	state := started.Result().Cookies()[0]
+	assert.Equal(t, "sso_state", state.Name)
+	assert.True(t, state.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, state.SameSite)
+}
+
+func TestSSO_LinksExistingUserByVerifiedEmail(t *testing.T) {
+	router, issuer := setupSSO(t)
+
+	w, callback := ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-rita", Email: "rita@campus.edu", EmailVerified: true})
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "http://frontend.test/home", w.Header().Get("Location"))
+	assert.NotEmpty(t, cookiesOf(w))
+
+	var identity models.UserIdentity
+	assert.NoError(t, config.DB.Where("subject = ?", "sub-rita").First(&identity).Error)
+	assert.Equal(t, uint(2), identity.UserID)
+
+	// THE STATE IS SINGLE USE
+	assert.Equal(t, http.StatusBadRequest, getRequest(router, callback).Code)
+
+	// LATER LOGINS GO BY SUBJECT, WHATEVER EMAIL THE PROVIDER NOW HAS
+	w, _ = ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-rita", Email: "rita.new@campus.edu"})
+	assert.Equal(t, http.StatusFound, w.Code)
+	var count int64
+	config.DB.Model(&models.User{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestSSO_RefusesUnknownOrUnverified(t *testing.T) {
+	router, issuer := setupSSO(t)
+
+	w, _ := ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-x", Email: "rita@campus.edu", EmailVerified: false})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, _ = ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-y", Email: "new@campus.edu", EmailVerified: true})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "No account")
+
+	w, _ = ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-z", Email: "else@campus.edu", EmailVerified: true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, getRequest(router, "/v1/auth/sso/2/login").Code)
+	assert.Equal(t, http.StatusBadRequest, getRequest(router, "/v1/auth/sso/callback?code=x&state=forged").Code)
+}
+
+func TestSSO_ProvisionsReaders(t *testing.T) {
+	router, issuer := setupSSO(t)
+	config.DB.Model(&models.SSOConfig{}).Where("lib_id = ?", 1).
+		Updates(map[string]interface{}{"auto_provision": true, "reader_type": "student", "email_domain": "campus.edu"})
+
+	w, _ := ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-gmail", Email: "someone@gmail.com", EmailVerified: true})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, _ = ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-new", Email: "new@campus.edu", EmailVerified: true, Name: "New Student"})
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	var user models.User
+	assert.NoError(t, config.DB.Where("email = ?", "new@campus.edu").First(&user).Error)
+	assert.Equal(t, "Reader", user.Role)
+	assert.Equal(t, "student", user.ReaderType)
+	assert.Equal(t, "New Student", user.Name)
+	assert.Equal(t, uint(1), user.LibID)
+}
+
+func TestSSO_DeactivatedUser(t *testing.T) {
+	router, issuer := setupSSO(t)
+	config.DB.Create(&models.UserIdentity{UserID: 2, Issuer: issuer.URL(), Subject: "sub-rita"})
+	config.DB.Model(&models.User{}).Where("id = ?", 2).Update("deactivated_at", time.Now())
+
+	w, _ := ssoLogin(t, router, issuer, oidctest.User{Subject: "sub-rita"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Account deactivated")
+}
+
+func TestUpdateSSOConfig(t *testing.T) {
+	router, issuer := setupSSO(t)
+
+	w := putJSON(router, "/owner/sso", `{"issuer": "http://127.0.0.1:1", "client_id": "app", "enabled": true}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotContains(t, w.Body.String(), "127.0.0.1")
+
+	// ISSUERS THAT WOULD REACH INSIDE THE NETWORK ARE REFUSED BEFORE ANY FETCH
+	oidc.AllowInsecure = false
+	for _, internal := range []string{issuer.URL(), "https://169.254.169.254", "https://10.0.0.5"} {
+		w = putJSON(router, "/owner/sso", `{"issuer": "`+internal+`", "client_id": "app", "enabled": true}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "https URL on a public host")
+	}
+	oidc.AllowInsecure = true
+
+	w = putJSON(router, "/owner/sso", `{"issuer": "`+issuer.URL()+`/", "client_id": "app", "enabled": true, "email_domain": "@Campus.edu"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "client-secret")
+
+	var cfg models.SSOConfig
+	config.DB.First(&cfg, 1)
+	assert.Equal(t, issuer.URL(), cfg.Issuer)
+	assert.Equal(t, "client-secret", cfg.ClientSecret)
+	assert.Equal(t, "campus.edu", cfg.EmailDomain)
+
+	w = getRequest(router, "/owner/sso")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, decode(t, w.Body.Bytes())["sso"].(map[string]interface{})["has_client_secret"])
+}
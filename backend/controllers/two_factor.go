@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/middleware"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/totp"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+var (
+	errTwoFactorEnabled   = errors.New("Two-factor authentication is already enabled")
+	errInvalidMFAToken    = errors.New("Login challenge expired, please log in again")
+	errInvalidSecondCode  = errors.New("Invalid code")
+	errNoPendingEnrolment = errors.New("No pending two-factor enrolment")
+)
+
+// Name shown next to the account in authenticator apps
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Library Management System"
+}
+
+// Staff are accounts holding any permission a reader does not, whatever their role is called
+func isStaff(user models.User) bool {
+	granted, err := middleware.PermissionsOf(user.ID, user.Role)
+	if err != nil {
+		// PERMISSIONS THAT CAN NOT BE READ DO NOT LET THE ACCOUNT SKIP 2FA
+		return true
+	}
+	return granted.Exceeds(permissions.ForRole(permissions.Reader))
+}
+
+// A FRESH PENDING SECRET, UNLESS 2FA IS ALREADY ACTIVE
+func beginEnrolment(user models.User) (gin.H, error) {
+	var existing models.TwoFactor
+	if err := config.DB.Where("user_id = ?", user.ID).First(&existing).Error; err == nil && existing.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	enrolment := models.TwoFactor{UserID: user.ID, Secret: secret}
+	if err := config.DB.Save(&enrolment).Error; err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"message":          "Add the account to an authenticator app, then confirm it with a code",
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(secret, totpIssuer(), user.Email),
+	}, nil
+}
+
+// Codes are compared without dashes, spaces or case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// NEW RECOVERY CODES REPLACE ANY EARLIER ONES
+func issueRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(raw)
+		code = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(normalizeRecoveryCode(code))}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// CHECKING A TOTP CODE, OR A RECOVERY CODE ONCE 2FA IS ACTIVE. A MATCH IS USED UP
+func verifySecondFactor(tx *gorm.DB, enrolment *models.TwoFactor, code, recoveryCode string) (bool, error) {
+	if code = strings.TrimSpace(code); code != "" {
+		counter, ok := totp.Validate(enrolment.Secret, code, time.Now(), enrolment.LastCounter)
+		if !ok {
+			return false, nil
+		}
+		result := tx.Model(&models.TwoFactor{}).Where("user_id = ? AND last_counter < ?", enrolment.UserID, counter).
+			Update("last_counter", counter)
+		return result.RowsAffected == 1, result.Error
+	}
+	if recoveryCode != "" && enrolment.Enabled {
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", enrolment.UserID, utils.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		return result.RowsAffected == 1, result.Error
+	}
+	return false, nil
+}
+
+// SECOND LOGIN STEP FOR ACCOUNTS WITH 2FA, OR STAFF OF A LIBRARY THAT REQUIRES IT.
+// AN EMPTY TOKEN MEANS THE PASSWORD IS ENOUGH
+func secondFactorChallenge(user models.User) (token string, enrol bool, err error) {
+	var enrolment models.TwoFactor
+	enabled := config.DB.Where("user_id = ? AND enabled = ?", user.ID, true).First(&enrolment).Error == nil
+
+	required := false
+	if isStaff(user) {
+		var lib models.Library
+		if err := config.DB.First(&lib, user.LibID).Error; err == nil {
+			required = lib.Require2FA
+		}
+	}
+	if !enabled && !required {
+		return "", false, nil
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", false, err
+	}
+	challenge := models.MFAChallenge{UserID: user.ID, TokenHash: hash, ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	return token, !enabled, config.DB.Create(&challenge).Error
+}
+
+// Live challenge of an mfa_token with attempts left, and its user
+func challengeOf(token string) (models.MFAChallenge, models.User, error) {
+	var challenge models.MFAChallenge
+	if err := config.DB.Preload("User").Where("token_hash = ?", utils.HashToken(token)).First(&challenge).Error; err != nil {
+		return challenge, models.User{}, errInvalidMFAToken
+	}
+	if !time.Now().Before(challenge.ExpiresAt) || challenge.Attempts >= maxMFAAttempts {
+		return challenge, models.User{}, errInvalidMFAToken
+	}
+	return challenge, challenge.User, nil
+}
+
+// STARTING TOTP ENROLMENT OF THE LOGGED IN STAFF MEMBER
+func EnrollTwoFactor(c *gin.Context) {
+	id, _ := c.Get("id")
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := beginEnrolment(user)
+	if errors.Is(err, errTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Enables a pending enrolment once a code confirms it, returning recovery codes
+func confirmEnrolment(enrolment *models.TwoFactor, code string) ([]string, error) {
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, enrolment, code, "")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidSecondCode
+		}
+		if err := tx.Model(&models.TwoFactor{}).Where("user_id = ?", enrolment.UserID).Update("enabled", true).Error; err != nil {
+			return err
+		}
+		codes, err = issueRecoveryCodes(tx, enrolment.UserID)
+		return err
+	})
+	return codes, err
+}
+
+// CONFIRMING ENROLMENT WITH A FIRST CODE FROM THE AUTHENTICATOR APP
+func ConfirmTwoFactor(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := c.Get("id")
+	var enrolment models.TwoFactor
+	if err := config.DB.Where("user_id = ?", id).First(&enrolment).Error; err != nil || enrolment.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errNoPendingEnrolment.Error()})
+		return
+	}
+
+	codes, err := confirmEnrolment(&enrolment, input.Code)
+	if errors.Is(err, errInvalidSecondCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// TURNING 2FA OFF, WITH THE PASSWORD AND A CURRENT CODE
+func DisableTwoFactor(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := c.Get("id")
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong Password"})
+		return
+	}
+
+	var lib models.Library
+	if err := config.DB.First(&lib, user.LibID).Error; err == nil && lib.Require2FA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your library requires two-factor authentication"})
+		return
+	}
+
+	var enrolment models.TwoFactor
+	if err := config.DB.Where("user_id = ? AND enabled = ?", user.ID, true).First(&enrolment).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, &enrolment, input.Code, input.RecoveryCode)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidSecondCode
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&enrolment).Error
+	})
+	if errors.Is(err, errInvalidSecondCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// REPLACING THE RECOVERY CODES, WITH A CURRENT CODE
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := c.Get("id")
+	var enrolment models.TwoFactor
+	if err := config.DB.Where("user_id = ? AND enabled = ?", id, true).First(&enrolment).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, &enrolment, input.Code, "")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidSecondCode
+		}
+		codes, err = issueRecoveryCodes(tx, enrolment.UserID)
+		return err
+	})
+	if errors.Is(err, errInvalidSecondCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// REQUIRING 2FA FOR ALL STAFF OF THE LIBRARY
+func SetTwoFactorRequirement(c *gin.Context) {
+	var input struct {
+		Require2FA *bool `json:"require_2fa" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	libId, _ := c.Get("libid")
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var lib models.Library
+		if err := tx.First(&lib, libId).Error; err != nil {
+			return err
+		}
+		before := gin.H{"require_2fa": lib.Require2FA}
+		if err := tx.Model(&lib).Update("require_2fa", *input.Require2FA).Error; err != nil {
+			return err
+		}
+		return recordAudit(c, tx, "library.security_update", "library", lib.LibID, before, gin.H{"require_2fa": *input.Require2FA})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Library security settings updated", "require_2fa": *input.Require2FA})
+}
+
+// ENROLLING DURING LOGIN WHEN THE LIBRARY REQUIRES 2FA
+func EnrollTwoFactorAtLogin(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, user, err := challengeOf(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := beginEnrolment(user)
+	if errors.Is(err, errTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SECOND LOGIN STEP: A TOTP OR RECOVERY CODE FOR THE MFA TOKEN FROM LOGIN
+func LoginTwoFactor(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, user, err := challengeOf(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var enrolment models.TwoFactor
+	if err := config.DB.Where("user_id = ?", user.ID).First(&enrolment).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enrol an authenticator app first"})
+		return
+	}
+
+	// WRONG CODES COUNT AGAINST THE ACCOUNT LIKE WRONG PASSWORDS, SO FRESH
+	// CHALLENGES DO NOT GIVE ENDLESS GUESSES
+	keys := loginKeysOf(c, user.Email)
+	if wait := loginRetryAfter(config.DB, keys, time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": tooManyAttemptsMessage})
+		return
+	}
+
+	// EVERY TRY COUNTS AGAINST THE CHALLENGE, RIGHT OR WRONG
+	if err := config.DB.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A PENDING ENROLMENT IS CONFIRMED BY ITS FIRST CODE
+	var recoveryCodes []string
+	if enrolment.Enabled {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			ok, err := verifySecondFactor(tx, &enrolment, input.Code, input.RecoveryCode)
+			if err == nil && !ok {
+				err = errInvalidSecondCode
+			}
+			return err
+		})
+	} else {
+		recoveryCodes, err = confirmEnrolment(&enrolment, input.Code)
+	}
+	if errors.Is(err, errInvalidSecondCode) {
+		recordLoginFailure(config.DB, keys, &user.ID, time.Now())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.Delete(&challenge)
+	if err := clearAccountLockout(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	accessToken, refreshToken, err := startSession(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := gin.H{"message": "Login successful"}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+	sendTokens(c, accessToken, refreshToken, response)
+}
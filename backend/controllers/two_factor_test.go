@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/prabhatKr-1/lib-man-sys/backend/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func setupTwoFactor(t *testing.T, require2FA bool) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library", Require2FA: require2FA}},
+		Users: []models.User{
+			{ID: 1, Name: "Admin", Email: "admin@example.com", Contact_number: "1", Role: "Admin", LibID: 1},
+			{ID: 2, Name: "Reader", Email: "reader@example.com", Contact_number: "2", Role: "Reader", LibID: 1},
+		},
+	})
+	router.POST("/auth/login", Login)
+	router.POST("/auth/login/2fa", LoginTwoFactor)
+	router.POST("/auth/login/2fa/enroll", EnrollTwoFactorAtLogin)
+
+	staff := testutils.AsCaller(router, "/admin", testutils.Caller{ID: 1, LibID: 1})
+	staff.POST("/2fa/enroll", EnrollTwoFactor)
+	staff.POST("/2fa/verify", ConfirmTwoFactor)
+	staff.POST("/2fa/disable", DisableTwoFactor)
+	staff.POST("/2fa/recovery-codes", RegenerateRecoveryCodes)
+	staff.PATCH("/security", SetTwoFactorRequirement)
+	return router
+}
+
+func decode(t *testing.T, body []byte) map[string]interface{} {
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &out))
+	return out
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, at)
+	assert.NoError(t, err)
+	return code
+}
+
+func loginChallenge(t *testing.T, router *gin.Engine, email string) map[string]interface{} {
+	w := postJSON(router, "/auth/login", `{"email": "`+email+`", "password": "password123"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return decode(t, w.Body.Bytes())
+}
+
+// AN ENABLED ENROLMENT WITH A KNOWN SECRET AND ITS RECOVERY CODES
+func enableTwoFactor(t *testing.T, userID uint) []string {
+	config.DB.Create(&models.TwoFactor{UserID: userID, Secret: testTOTPSecret, Enabled: true})
+	codes, err := issueRecoveryCodes(config.DB, userID)
+	assert.NoError(t, err)
+	return codes
+}
+
+func TestTwoFactor_EnrolAndLogin(t *testing.T) {
+	router := setupTwoFactor(t, false)
+
+	w := postJSON(router, "/admin/2fa/enroll", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	enrolment := decode(t, w.Body.Bytes())
+	secret := enrolment["secret"].(string)
+	assert.Contains(t, enrolment["provisioning_uri"], "otpauth://totp/")
+	assert.Contains(t, enrolment["provisioning_uri"], "secret="+secret)
+
+	// UNTIL CONFIRMED, LOGIN STILL TAKES ONLY THE PASSWORD
+	assert.Nil(t, loginChallenge(t, router, "admin@example.com")["mfa_required"])
+
+	w = postJSON(router, "/admin/2fa/verify", `{"code": "000000"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	now := time.Now()
+	w = postJSON(router, "/admin/2fa/verify", `{"code": "`+codeAt(t, secret, now)+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decode(t, w.Body.Bytes())["recovery_codes"], recoveryCodeCount)
+
+	w = postJSON(router, "/admin/2fa/enroll", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	challenge := loginChallenge(t, router, "admin@example.com")
+	assert.Equal(t, true, challenge["mfa_required"])
+	assert.Equal(t, false, challenge["enrollment_required"])
+	mfaToken := challenge["mfa_token"].(string)
+
+	// THE CODE THAT CONFIRMED ENROLMENT CAN NOT BE REPLAYED
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, secret, now)+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, secret, now.Add(totp.Period))+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, cookiesOf(w)["token"].Value)
+
+	// THE CHALLENGE IS SPENT
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, secret, now.Add(totp.Period))+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTwoFactor_RecoveryCodeWorksOnce(t *testing.T) {
+	router := setupTwoFactor(t, false)
+	codes := enableTwoFactor(t, 1)
+
+	mfaToken := loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+	w := postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "recovery_code": "`+codes[0]+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mfaToken = loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "recovery_code": "`+codes[0]+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTwoFactor_ChallengeAttemptsAreLimited(t *testing.T) {
+	router := setupTwoFactor(t, false)
+	enableTwoFactor(t, 1)
+
+	mfaToken := loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+	for i := 0; i < maxMFAAttempts; i++ {
+		w := postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		waitOutLoginDelay()
+	}
+
+	w := postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, testTOTPSecret, time.Now())+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Login challenge expired")
+}
+
+// MOVES FAILED LOGINS BACK PAST THE LONGEST DELAY, KEEPING THEM IN THE WINDOW
+func waitOutLoginDelay() {
+	config.DB.Model(&models.LoginThrottle{}).Where("1 = 1").Update("last_failure_at", time.Now().Add(-2*maxThrottleDelay))
+}
+
+func TestTwoFactor_FailuresCountAgainstTheAccount(t *testing.T) {
+	router := setupTwoFactor(t, false)
+	enableTwoFactor(t, 1)
+
+	// THE RIGHT PASSWORD ALONE DOES NOT FORGET EARLIER FAILURES
+	mfaToken := loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+	postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+	loginChallenge(t, router, "admin@example.com")
+	var throttle models.LoginThrottle
+	assert.NoError(t, config.DB.Where("scope = ? AND key = ?", models.ThrottleAccount, "admin@example.com").First(&throttle).Error)
+	assert.Equal(t, 1, throttle.Failures)
+
+	// FRESH CHALLENGES DO NOT GIVE FRESH GUESSES
+	for i := 1; i < throttleRules[models.ThrottleAccount].lockoutAfter; i++ {
+		waitOutLoginDelay()
+		mfaToken = loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+		w := postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w := postJSON(router, "/auth/login", `{"email": "admin@example.com", "password": "password123"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// A COMPLETED LOGIN FORGETS THEM
+	config.DB.Where("1 = 1").Delete(&models.LoginThrottle{})
+	postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+	waitOutLoginDelay()
+	mfaToken = loginChallenge(t, router, "admin@example.com")["mfa_token"].(string)
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, testTOTPSecret, time.Now())+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var left int64
+	config.DB.Model(&models.LoginThrottle{}).Where("scope = ?", models.ThrottleAccount).Count(&left)
+	assert.Equal(t, int64(0), left)
+}
+
+func TestTwoFactor_LibraryRequiresIt(t *testing.T) {
+	router := setupTwoFactor(t, true)
+
+	// READERS ARE NOT AFFECTED
+	assert.Nil(t, loginChallenge(t, router, "reader@example.com")["mfa_required"])
+
+	challenge := loginChallenge(t, router, "admin@example.com")
+	assert.Equal(t, true, challenge["enrollment_required"])
+	mfaToken := challenge["mfa_token"].(string)
+
+	w := postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/auth/login/2fa/enroll", `{"mfa_token": "`+mfaToken+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	secret := decode(t, w.Body.Bytes())["secret"].(string)
+
+	w = postJSON(router, "/auth/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+codeAt(t, secret, time.Now())+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decode(t, w.Body.Bytes())["recovery_codes"], recoveryCodeCount)
+
+	w = postJSON(router, "/admin/2fa/disable", `{"password": "password123", "code": "`+codeAt(t, secret, time.Now().Add(totp.Period))+`"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestTwoFactor_RequiredForCustomStaffRoles(t *testing.T) {
+	router := setupTwoFactor(t, true)
+
+	// A READER-BASED ROLE THAT MAY ALSO EDIT THE CATALOGUE
+	role := models.Role{LibID: 1, Name: "Volunteer", BaseRole: "Reader", Grants: []models.RolePermission{
+		{Permission: string(permissions.BooksRead)}, {Permission: string(permissions.BooksWrite)},
+	}}
+	assert.NoError(t, config.DB.Create(&role).Error)
+	config.DB.Model(&models.User{}).Where("id = ?", 2).Update("role_id", role.RoleID)
+
+	assert.Equal(t, true, loginChallenge(t, router, "reader@example.com")["enrollment_required"])
+}
+
+func TestTwoFactor_DisableAndRequirement(t *testing.T) {
+	router := setupTwoFactor(t, false)
+	codes := enableTwoFactor(t, 1)
+
+	w := postJSON(router, "/admin/2fa/disable", `{"password": "wrong", "recovery_code": "`+codes[1]+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/admin/2fa/disable", `{"password": "password123", "recovery_code": "`+codes[1]+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, loginChallenge(t, router, "admin@example.com")["mfa_required"])
+
+	req, _ := http.NewRequest("PATCH", "/admin/security", bytes.NewBufferString(`{"require_2fa": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var lib models.Library
+	config.DB.First(&lib, 1)
+	assert.True(t, lib.Require2FA)
+	assert.Equal(t, true, loginChallenge(t, router, "admin@example.com")["enrollment_required"])
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// User as returned by the API, without the password hash
+func userResponse(u models.User) gin.H {
+	return gin.H{
+		"id":             u.ID,
+		"name":           u.Name,
+		"email":          u.Email,
+		"contact_number": u.Contact_number,
+		"role":           u.Role,
+		"role_id":        u.RoleID,
+		"reader_type":    u.ReaderType,
+		"lib_id":         u.LibID,
+		"active":         u.DeactivatedAt == nil,
+		"deactivated_at": u.DeactivatedAt,
+		"created_at":     u.CreatedAt,
+		"updated_at":     u.UpdatedAt,
+	}
+}
+
+// Readers need only the permission of the route; staff accounts also staff:manage
+func canManage(c *gin.Context, user models.User) bool {
+	return user.Role == permissions.Reader || granted(c, permissions.StaffManage)
+}
+
+// User of the route's :id in the caller's library, answering 404 when there is none
+func findLibraryUser(c *gin.Context) (models.User, bool) {
+	libId, _ := c.Get("libid")
+	var user models.User
+	if err := config.DB.Where("id = ? AND lib_id = ?", c.Param("id"), libId).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// LISTING USERS OF THE LIBRARY WITH FILTERS AND PAGINATION
+func ListUsers(c *gin.Context) {
+	var input struct {
+		Role       string `form:"role" binding:"omitempty,oneof=Owner Admin Reader"`
+		Status     string `form:"status" binding:"omitempty,oneof=active deactivated"`
+		ReaderType string `form:"reader_type"`
+		Query      string `form:"q"`
+		Page       int    `form:"page" binding:"omitempty,min=1"`
+		Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	}
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.Limit == 0 {
+		input.Limit = 20
+	}
+
+	libId, _ := c.Get("libid")
+	query := config.DB.Model(&models.User{}).Where("lib_id = ?", libId)
+	if input.Role != "" {
+		query = query.Where("role = ?", input.Role)
+	}
+	switch input.Status {
+	case "active":
+		query = query.Where("deactivated_at IS NULL")
+	case "deactivated":
+		query = query.Where("deactivated_at IS NOT NULL")
+	}
+	if input.ReaderType != "" {
+		query = query.Where("reader_type = ?", input.ReaderType)
+	}
+	if q := strings.TrimSpace(input.Query); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("name ASC, id ASC").Offset((input.Page - 1) * input.Limit).Limit(input.Limit).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		results = append(results, userResponse(u))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"users":       results,
+		"total":       total,
+		"page":        input.Page,
+		"limit":       input.Limit,
+		"total_pages": (total + int64(input.Limit) - 1) / int64(input.Limit),
+	})
+}
+
+// VIEWING A USER OF THE LIBRARY
+func GetUser(c *gin.Context) {
+	user, ok := findLibraryUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": userResponse(user)})
+}
+
+// Runs a change to a user and records it in the audit log, read back from tx
+func auditedUserUpdate(c *gin.Context, tx *gorm.DB, action string, user models.User, update func() error) error {
+	before := userResponse(user)
+	if err := update(); err != nil {
+		return err
+	}
+	var after models.User
+	if err := tx.First(&after, user.ID).Error; err != nil {
+		return err
+	}
+	return recordAudit(c, tx, action, "user", user.ID, before, userResponse(after))
+}
+
+// UPDATING THE CONTACT DETAILS OF A USER
+func UpdateUser(c *gin.Context) {
+	var input struct {
+		Name          *string `json:"name" binding:"omitempty,min=1"`
+		Email         *string `json:"email" binding:"omitempty,email"`
+		ContactNumber *string `json:"contact_number" binding:"omitempty,min=1"`
+		ReaderType    *string `json:"reader_type"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := findLibraryUser(c)
+	if !ok {
+		return
+	}
+	// STAFF MAY ALWAYS KEEP THEIR OWN DETAILS UP TO DATE. AN API KEY ACTS WITH
+	// ITS CREATOR'S ID BUT IS NOT THEM, SO IT NEEDS THE PERMISSION LIKE ANYONE ELSE
+	id, _ := c.Get("id")
+	_, viaKey := c.Get("api_key")
+	if (user.ID != id || viaKey) && !canManage(c, user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can update staff accounts"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		updates["name"] = strings.TrimSpace(*input.Name)
+	}
+	if input.Email != nil && *input.Email != user.Email {
+		var taken int64
+		config.DB.Model(&models.User{}).Where("email = ? AND id <> ?", *input.Email, user.ID).Count(&taken)
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+			return
+		}
+		updates["email"] = *input.Email
+	}
+	if input.ContactNumber != nil {
+		updates["contact_number"] = *input.ContactNumber
+	}
+	if input.ReaderType != nil {
+		if user.Role != permissions.Reader {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only readers have a reader type"})
+			return
+		}
+		updates["reader_type"] = *input.ReaderType
+	}
+
+	if len(updates) > 0 {
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return auditedUserUpdate(c, tx, "user.update", user, func() error {
+				return tx.Model(&user).Updates(updates).Error
+			})
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	config.DB.First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User updated", "user": userResponse(user)})
+}
+
+// CHANGING THE ROLE OF A USER, ONLY BETWEEN ADMIN AND READER
+func ChangeUserRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required,oneof=Admin Reader"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := findLibraryUser(c)
+	if !ok {
+		return
+	}
+	if user.Role == permissions.Owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The owner's role can not be changed"})
+		return
+	}
+	if user.Role == input.Role {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User already has this role"})
+		return
+	}
+
+	// A CUSTOM ROLE BELONGS TO THE OLD ROLE, AND SESSIONS CARRY IT TOO
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := auditedUserUpdate(c, tx, "user.role_change", user, func() error {
+			return tx.Model(&user).Updates(map[string]interface{}{"role": input.Role, "role_id": nil}).Error
+		}); err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed", "user": userResponse(user)})
+}
+
+// Checks shared by deactivation and reactivation, answering when refused
+func canSwitch(c *gin.Context, user models.User) bool {
+	id, _ := c.Get("id")
+	switch {
+	case user.ID == id:
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can not change the status of your own account"})
+	case user.Role == permissions.Owner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "The owner's account can not be deactivated"})
+	case !canManage(c, user):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change the status of staff accounts"})
+	default:
+		return true
+	}
+	return false
+}
+
+// DEACTIVATING A USER, ENDING EVERY SESSION AND PENDING LOGIN
+func DeactivateUser(c *gin.Context) {
+	user, ok := findLibraryUser(c)
+	if !ok || !canSwitch(c, user) {
+		return
+	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already deactivated"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := auditedUserUpdate(c, tx, "user.deactivate", user, func() error {
+			return tx.Model(&user).Update("deactivated_at", time.Now()).Error
+		}); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFAChallenge{}).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User deactivated", "user": userResponse(user)})
+}
+
+// REACTIVATING A USER
+func ReactivateUser(c *gin.Context) {
+	user, ok := findLibraryUser(c)
+	if !ok || !canSwitch(c, user) {
+		return
+	}
+	if user.DeactivatedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already active"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return auditedUserUpdate(c, tx, "user.reactivate", user, func() error {
+			return tx.Model(&user).Update("deactivated_at", nil).Error
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	config.DB.First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated", "user": userResponse(user)})
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// ROUTES AS THE ADMIN (ID 2) OR THE OWNER (ID 1) OF LIBRARY 1
+func setupUsers(t *testing.T, callerID uint, role string) *gin.Engine {
+	router := testutils.SetupRouter(testutils.Seed{
+		Libraries: []models.Library{{LibID: 1, Name: "Test Library"}, {LibID: 2, Name: "Other Library"}},
+		Users: []models.User{
+			{ID: 1, Name: "Olivia Owner", Email: "owner@example.com", Contact_number: "1", Role: "Owner", LibID: 1},
+			{ID: 2, Name: "Adam Admin", Email: "admin@example.com", Contact_number: "2", Role: "Admin", LibID: 1},
+			{ID: 3, Name: "Rita Reader", Email: "rita@example.com", Contact_number: "3", Role: "Reader", ReaderType: "student", LibID: 1},
+			{ID: 4, Name: "Ravi Reader", Email: "ravi@example.com", Contact_number: "4", Role: "Reader", ReaderType: "faculty", LibID: 1},
+			{ID: 5, Name: "Elsewhere", Email: "else@example.com", Contact_number: "5", Role: "Reader", LibID: 2},
+		},
+	})
+	router.POST("/auth/login", Login)
+	staff := testutils.AsCaller(router, "/staff", testutils.Caller{ID: callerID, LibID: 1, Role: role})
+	staff.GET("/users", ListUsers)
+	staff.GET("/users/:id", GetUser)
+	staff.PATCH("/users/:id", UpdateUser)
+	staff.PATCH("/users/:id/role", ChangeUserRole)
+	staff.POST("/users/:id/deactivate", DeactivateUser)
+	staff.POST("/users/:id/reactivate", ReactivateUser)
+	return router
+}
+
+func getRequest(router *gin.Engine, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func emailsOf(t *testing.T, w *httptest.ResponseRecorder) []string {
+	var emails []string
+	for _, u := range decode(t, w.Body.Bytes())["users"].([]interface{}) {
+		emails = append(emails, u.(map[string]interface{})["email"].(string))
+	}
+	return emails
+}
+
+func TestListUsers_FiltersAndPages(t *testing.T) {
+	router := setupUsers(t, 2, "Admin")
+
+	w := getRequest(router, "/staff/users")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"admin@example.com", "owner@example.com", "ravi@example.com", "rita@example.com"}, emailsOf(t, w))
+	assert.NotContains(t, w.Body.String(), "password")
+
+	assert.Equal(t, []string{"ravi@example.com", "rita@example.com"}, emailsOf(t, getRequest(router, "/staff/users?role=Reader")))
+	assert.Equal(t, []string{"rita@example.com"}, emailsOf(t, getRequest(router, "/staff/users?reader_type=student")))
+	assert.Equal(t, []string{"ravi@example.com"}, emailsOf(t, getRequest(router, "/staff/users?q=RAVI")))
+
+	w = getRequest(router, "/staff/users?limit=3&page=2")
+	assert.Equal(t, []string{"rita@example.com"}, emailsOf(t, w))
+	assert.Equal(t, float64(2), decode(t, w.Body.Bytes())["total_pages"])
+
+	config.DB.Model(&models.User{}).Where("id = ?", 3).Update("deactivated_at", time.Now())
+	assert.Equal(t, []string{"rita@example.com"}, emailsOf(t, getRequest(router, "/staff/users?status=deactivated")))
+
+	assert.Equal(t, http.StatusBadRequest, getRequest(router, "/staff/users?role=Janitor").Code)
+	assert.Equal(t, http.StatusNotFound, getRequest(router, "/staff/users/5").Code)
+	assert.Equal(t, http.StatusOK, getRequest(router, "/staff/users/3").Code)
+}
+
+func TestUpdateUser(t *testing.T) {
+	router := setupUsers(t, 2, "Admin")
+
+	w := patchJSON(router, "/staff/users/3", `{"contact_number": "555", "reader_type": "faculty"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rita models.User
+	config.DB.First(&rita, 3)
+	assert.Equal(t, "555", rita.Contact_number)
+	assert.Equal(t, "faculty", rita.ReaderType)
+
+	assert.Equal(t, http.StatusConflict, patchJSON(router, "/staff/users/3", `{"email": "ravi@example.com"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patchJSON(router, "/staff/users/3", `{"email": "not-an-email"}`).Code)
+
+	// ADMINS EDIT THEMSELVES AND READERS, NOT THE OWNER
+	assert.Equal(t, http.StatusOK, patchJSON(router, "/staff/users/2", `{"name": "Adam A."}`).Code)
+	assert.Equal(t, http.StatusForbidden, patchJSON(router, "/staff/users/1", `{"name": "Someone"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patchJSON(router, "/staff/users/2", `{"reader_type": "student"}`).Code)
+}
+
+func TestUpdateUser_APIKeyIsNotItsCreator(t *testing.T) {
+	setupUsers(t, 1, "Owner")
+	router := gin.New()
+	router.PATCH("/users/:id", func(c *gin.Context) {
+		c.Set("id", uint(1))
+		c.Set("libid", uint(1))
+		c.Set("role", "Owner")
+		c.Set("api_key", uint(1))
+		c.Set("permissions", permissions.NewSet(permissions.UsersManage))
+		c.Next()
+	}, UpdateUser)
+
+	// A KEY SCOPED TO READERS CAN NOT TAKE OVER THE OWNER BY CHANGING THEIR EMAIL
+	w := patchJSON(router, "/users/1", `{"email": "attacker@example.com"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var owner models.User
+	config.DB.First(&owner, 1)
+	assert.Equal(t, "owner@example.com", owner.Email)
+
+	assert.Equal(t, http.StatusForbidden, patchJSON(router, "/users/2", `{"name": "Someone"}`).Code)
+	assert.Equal(t, http.StatusOK, patchJSON(router, "/users/3", `{"contact_number": "555"}`).Code)
+}
+
+func TestChangeUserRole(t *testing.T) {
+	router := setupUsers(t, 1, "Owner")
+	session := models.Session{UserID: 3, LibID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	config.DB.Create(&session)
+
+	assert.Equal(t, http.StatusBadRequest, patchJSON(router, "/staff/users/3/role", `{"role": "Owner"}`).Code)
+	assert.Equal(t, http.StatusForbidden, patchJSON(router, "/staff/users/1/role", `{"role": "Admin"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patchJSON(router, "/staff/users/3/role", `{"role": "Reader"}`).Code)
+
+	w := patchJSON(router, "/staff/users/3/role", `{"role": "Admin"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rita models.User
+	config.DB.First(&rita, 3)
+	assert.Equal(t, "Admin", rita.Role)
+	config.DB.First(&session, session.SessionID)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func TestDeactivateUser(t *testing.T) {
+	router := setupUsers(t, 2, "Admin")
+	session := models.Session{UserID: 3, LibID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	config.DB.Create(&session)
+
+	assert.Equal(t, http.StatusForbidden, postJSON(router, "/staff/users/2/deactivate", "").Code)
+	assert.Equal(t, http.StatusForbidden, postJSON(router, "/staff/users/1/deactivate", "").Code)
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/users/3/deactivate", "").Code)
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/staff/users/3/deactivate", "").Code)
+	config.DB.First(&session, session.SessionID)
+	assert.NotNil(t, session.RevokedAt)
+
+	// A WRONG PASSWORD STILL GETS THE USUAL ANSWER
+	assert.Equal(t, http.StatusUnauthorized, loginAs(router, "rita@example.com", "wrong").Code)
+	w := loginAs(router, "rita@example.com", "password123")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Account deactivated")
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/staff/users/3/reactivate", "").Code)
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/staff/users/3/reactivate", "").Code)
+	assert.Equal(t, http.StatusOK, loginAs(router, "rita@example.com", "password123").Code)
+}
@@ -0,0 +1,383 @@
+// Package keyring keeps the asymmetric keys access tokens are signed with.
+// Keys are named by a kid, stored in the database so every instance of the
+// API shares them, and rotated on a schedule: a successor is published before
+// it starts signing, and a retired key keeps verifying for an overlap.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"gorm.io/gorm"
+)
+
+// Supported signing algorithms
+const (
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+)
+
+// Algorithms accepted on tokens, for jwt.WithValidMethods
+var Algorithms = []string{EdDSA, RS256}
+
+// A ring with a database re-reads it for an unknown kid at most this often
+const reloadInterval = time.Minute
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type Schedule struct {
+	// How long a key signs before its successor takes over
+	Lifetime time.Duration
+	// How long a successor is published before it signs, so verifiers that
+	// cache the key set have it by then
+	Prepublish time.Duration
+	// How long a retired key still verifies; at least the access token lifetime
+	Overlap time.Duration
+}
+
+type Key struct {
+	ID          string
+	Algorithm   string
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+	ExpiresAt   time.Time
+
+	private crypto.Signer
+}
+
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) Private() crypto.Signer {
+	return k.private
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Public half of the key as a JSON Web Key (RFC 7517)
+func (k *Key) JWK() map[string]string {
+	jwk := map[string]string{"kid": k.ID, "alg": k.Algorithm, "use": "sig"}
+	switch pub := k.Public().(type) {
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+type Ring struct {
+	algorithm string
+	schedule  Schedule
+	db        *gorm.DB
+	sealer    Sealer
+
+	mu       sync.RWMutex
+	keys     []*Key
+	loadedAt time.Time
+}
+
+// Ring kept in memory only, for tests and single-process tools. It makes
+// its first key when one is needed
+func NewEphemeral(algorithm string, schedule Schedule) *Ring {
+	return &Ring{algorithm: algorithm, schedule: schedule}
+}
+
+// Ring stored in the database with its private keys sealed, brought up to
+// date with the schedule
+func Open(db *gorm.DB, sealer Sealer, algorithm string, schedule Schedule) (*Ring, error) {
+	if algorithm != EdDSA && algorithm != RS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if schedule.Prepublish >= schedule.Lifetime {
+		return nil, errors.New("keys must be published for less than their lifetime")
+	}
+	if sealer == nil {
+		return nil, errors.New("a stored ring needs a key-encryption key")
+	}
+	ring := &Ring{algorithm: algorithm, schedule: schedule, db: db, sealer: sealer}
+	return ring, ring.Rotate(time.Now())
+}
+
+// Key to sign with now
+func (r *Ring) Signing(now time.Time) (*Key, error) {
+	if key := r.signing(now); key != nil {
+		return key, nil
+	}
+	// AN EPHEMERAL RING, OR A WORKER THAT HAS NOT CAUGHT UP YET
+	if err := r.Rotate(now); err != nil {
+		return nil, err
+	}
+	if key := r.signing(now); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("no signing key")
+}
+
+// The most recently activated key in its signing period
+func (r *Ring) signing(now time.Time) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var current *Key
+	for _, key := range r.keys {
+		if !now.Before(key.ActivatesAt) && now.Before(key.RetiresAt) {
+			if current == nil || key.ActivatesAt.After(current.ActivatesAt) {
+				current = key
+			}
+		}
+	}
+	return current
+}
+
+// Key a token names, while it may still verify
+func (r *Ring) Verifying(kid string, now time.Time) (*Key, error) {
+	if key := r.find(kid, now); key != nil {
+		return key, nil
+	}
+
+	// ANOTHER INSTANCE MAY HAVE ROTATED SINCE THE RING WAS READ
+	r.mu.RLock()
+	stale := r.db != nil && now.Sub(r.loadedAt) >= reloadInterval
+	r.mu.RUnlock()
+	if stale {
+		if err := r.load(now); err != nil {
+			return nil, err
+		}
+		if key := r.find(kid, now); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (r *Ring) find(kid string, now time.Time) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.ID == kid && now.Before(key.ExpiresAt) {
+			return key
+		}
+	}
+	return nil
+}
+
+// jwt.Keyfunc checking that the token's algorithm is the one of its key
+func (r *Ring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := r.Verifying(kid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %s is not for %s", kid, token.Method.Alg())
+	}
+	return key.Public(), nil
+}
+
+// Keys to publish: the signing one, its prepublished successor and those
+// retired keys that still verify
+func (r *Ring) Published(now time.Time) []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var keys []*Key
+	for _, key := range r.keys {
+		if now.Before(key.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivatesAt.Before(keys[j].ActivatesAt) })
+	return keys
+}
+
+// Brings the ring in line with the schedule: a key signing now, a successor
+// published ahead of the current key's retirement, and expired keys dropped.
+// Two instances rotating at once may both add a successor; the later one
+// signs and the other simply verifies nothing
+func (r *Ring) Rotate(now time.Time) error {
+	if err := r.load(now); err != nil {
+		return err
+	}
+
+	current := r.signing(now)
+	if current == nil {
+		if _, err := r.add(now, now); err != nil {
+			return err
+		}
+		current = r.signing(now)
+	}
+
+	if now.Add(r.schedule.Prepublish).After(current.RetiresAt) && !r.hasSuccessor(current) {
+		if _, err := r.add(now, current.RetiresAt); err != nil {
+			return err
+		}
+	}
+
+	if r.db != nil {
+		return r.db.Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error
+	}
+	return nil
+}
+
+func (r *Ring) hasSuccessor(current *Key) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.ActivatesAt.After(current.ActivatesAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a key signing from activatesAt, stored when the ring has a database
+func (r *Ring) add(now, activatesAt time.Time) (*Key, error) {
+	private, err := generate(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+	key := &Key{
+		ID:          base64.RawURLEncoding.EncodeToString(kid),
+		Algorithm:   r.algorithm,
+		ActivatesAt: activatesAt,
+		RetiresAt:   activatesAt.Add(r.schedule.Lifetime),
+		ExpiresAt:   activatesAt.Add(r.schedule.Lifetime + r.schedule.Overlap),
+		private:     private,
+	}
+
+	if r.db != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := r.sealer.Seal(der, []byte(key.ID))
+		if err != nil {
+			return nil, err
+		}
+		stored := models.SigningKey{
+			KID:         key.ID,
+			Algorithm:   key.Algorithm,
+			PrivateKey:  sealed,
+			SealedBy:    r.sealer.ID(),
+			ActivatesAt: key.ActivatesAt,
+			RetiresAt:   key.RetiresAt,
+			ExpiresAt:   key.ExpiresAt,
+		}
+		if err := r.db.Create(&stored).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	r.keys = append(r.keys, key)
+	r.mu.Unlock()
+	return key, nil
+}
+
+// Re-reads the keys from the database; an ephemeral ring only drops expired ones
+func (r *Ring) load(now time.Time) error {
+	if r.db == nil {
+		r.mu.Lock()
+		kept := r.keys[:0]
+		for _, key := range r.keys {
+			if now.Before(key.ExpiresAt) {
+				kept = append(kept, key)
+			}
+		}
+		r.keys = kept
+		r.mu.Unlock()
+		return nil
+	}
+
+	var stored []models.SigningKey
+	if err := r.db.Where("expires_at > ?", now).Find(&stored).Error; err != nil {
+		return err
+	}
+	keys := make([]*Key, 0, len(stored))
+	for _, s := range stored {
+		der, err := r.unseal(s)
+		if err != nil {
+			return err
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.KID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("signing key %s can not sign", s.KID)
+		}
+		keys = append(keys, &Key{
+			ID:          s.KID,
+			Algorithm:   s.Algorithm,
+			ActivatesAt: s.ActivatesAt,
+			RetiresAt:   s.RetiresAt,
+			ExpiresAt:   s.ExpiresAt,
+			private:     signer,
+		})
+	}
+
+	r.mu.Lock()
+	r.keys, r.loadedAt = keys, now
+	r.mu.Unlock()
+	return nil
+}
+
+// DER of a stored key
+func (r *Ring) unseal(s models.SigningKey) ([]byte, error) {
+	if s.SealedBy != r.sealer.ID() {
+		return nil, fmt.Errorf("signing key %s is sealed by %s, not by the configured key-encryption key", s.KID, s.SealedBy)
+	}
+	der, err := r.sealer.Open(s.PrivateKey, []byte(s.KID))
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", s.KID, err)
+	}
+	return der, nil
+}
+
+func generate(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// Rotates the ring in the background, also picking up keys other instances made
+func (r *Ring) StartRotationWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := r.Rotate(time.Now()); err != nil {
+				log.Printf("Failed to rotate signing keys: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,172 @@
+package keyring_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/keyring"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var schedule = keyring.Schedule{Lifetime: 10 * time.Hour, Prepublish: 2 * time.Hour, Overlap: time.Hour}
+
+func newSealer(t *testing.T) keyring.Sealer {
+	kek := make([]byte, 32)
+	rand.Read(kek)
+	sealer, err := keyring.NewAESSealer(kek)
+	assert.NoError(t, err)
+	return sealer
+}
+
+func sign(t *testing.T, key *keyring.Key, method jwt.SigningMethod) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "1"})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private())
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestRotation(t *testing.T) {
+	testutils.SetupTestDB()
+	ring, err := keyring.Open(config.DB, newSealer(t), keyring.EdDSA, schedule)
+	assert.NoError(t, err)
+
+	first, err := ring.Signing(time.Now())
+	assert.NoError(t, err)
+	start := first.ActivatesAt
+	assert.Len(t, ring.Published(start), 1)
+
+	// THE SUCCESSOR IS PUBLISHED BEFORE IT SIGNS
+	assert.NoError(t, ring.Rotate(start.Add(9*time.Hour)))
+	published := ring.Published(start.Add(9 * time.Hour))
+	assert.Len(t, published, 2)
+	second := published[1]
+	assert.True(t, start.Add(10*time.Hour).Equal(second.ActivatesAt))
+	current, _ := ring.Signing(start.Add(9 * time.Hour))
+	assert.Equal(t, first.ID, current.ID)
+
+	// ROTATING AGAIN DOES NOT ADD ANOTHER
+	assert.NoError(t, ring.Rotate(start.Add(9*time.Hour+time.Minute)))
+	assert.Len(t, ring.Published(start.Add(9*time.Hour)), 2)
+
+	// AFTER THE SWITCH THE OLD KEY STILL VERIFIES FOR THE OVERLAP
+	current, _ = ring.Signing(start.Add(10*time.Hour + time.Minute))
+	assert.Equal(t, second.ID, current.ID)
+	_, err = ring.Verifying(first.ID, start.Add(10*time.Hour+30*time.Minute))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ring.Rotate(start.Add(11*time.Hour+time.Minute)))
+	_, err = ring.Verifying(first.ID, start.Add(11*time.Hour+time.Minute))
+	assert.ErrorIs(t, err, keyring.ErrUnknownKey)
+	var count int64
+	config.DB.Model(&models.SigningKey{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestKeysAreShared(t *testing.T) {
+	testutils.SetupTestDB()
+	sealer := newSealer(t)
+	ring, err := keyring.Open(config.DB, sealer, keyring.RS256, schedule)
+	assert.NoError(t, err)
+	other, err := keyring.Open(config.DB, sealer, keyring.RS256, schedule)
+	assert.NoError(t, err)
+
+	key, _ := ring.Signing(time.Now())
+	shared, _ := other.Signing(time.Now())
+	assert.Equal(t, key.ID, shared.ID)
+
+	// A SUCCESSOR MADE BY ONE INSTANCE IS FOUND BY THE OTHER WHEN A TOKEN NAMES IT
+	later := key.ActivatesAt.Add(9 * time.Hour)
+	assert.NoError(t, ring.Rotate(later))
+	successor := ring.Published(later)[1]
+	found, err := other.Verifying(successor.ID, later)
+	assert.NoError(t, err)
+	assert.Equal(t, successor.JWK(), found.JWK())
+}
+
+func TestKeyfunc(t *testing.T) {
+	ring := keyring.NewEphemeral(keyring.RS256, schedule)
+	key, err := ring.Signing(time.Now())
+	assert.NoError(t, err)
+
+	jwk := key.JWK()
+	assert.Equal(t, "RSA", jwk["kty"])
+	assert.Equal(t, "AQAB", jwk["e"])
+	assert.Equal(t, key.ID, jwk["kid"])
+
+	_, err = jwt.Parse(sign(t, key, jwt.SigningMethodRS256), ring.Keyfunc)
+	assert.NoError(t, err)
+
+	// THE ALGORITHM IS THE KEY'S, NOT WHATEVER THE TOKEN HEADER CLAIMS
+	_, err = jwt.Parse(sign(t, key, jwt.SigningMethodRS384), ring.Keyfunc)
+	assert.Error(t, err)
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	hmac.Header["kid"] = key.ID
+	forged, _ := hmac.SignedString(key.Public().(*rsa.PublicKey).N.Bytes())
+	_, err = jwt.Parse(forged, ring.Keyfunc)
+	assert.Error(t, err)
+
+	unnamed, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "1"}).SignedString(key.Private())
+	_, err = jwt.Parse(unnamed, ring.Keyfunc)
+	assert.ErrorIs(t, err, keyring.ErrUnknownKey)
+}
+
+func TestOpen_RejectsBadSchedules(t *testing.T) {
+	testutils.SetupTestDB()
+	_, err := keyring.Open(config.DB, newSealer(t), "HS256", schedule)
+	assert.Error(t, err)
+	_, err = keyring.Open(config.DB, newSealer(t), keyring.EdDSA, keyring.Schedule{Lifetime: time.Hour, Prepublish: time.Hour})
+	assert.Error(t, err)
+	_, err = keyring.Open(config.DB, nil, keyring.EdDSA, schedule)
+	assert.Error(t, err)
+}
+
+func TestPrivateKeysAreSealed(t *testing.T) {
+	testutils.SetupTestDB()
+	sealer := newSealer(t)
+	ring, err := keyring.Open(config.DB, sealer, keyring.EdDSA, schedule)
+	assert.NoError(t, err)
+	key, _ := ring.Signing(time.Now())
+
+	var stored models.SigningKey
+	config.DB.Where(&models.SigningKey{KID: key.ID}).First(&stored)
+	assert.Equal(t, sealer.ID(), stored.SealedBy)
+	_, err = x509.ParsePKCS8PrivateKey(stored.PrivateKey)
+	assert.Error(t, err)
+
+	// ANOTHER KEY-ENCRYPTION KEY CAN NOT LOAD THE RING
+	_, err = keyring.Open(config.DB, newSealer(t), keyring.EdDSA, schedule)
+	assert.ErrorContains(t, err, "not by the configured key-encryption key")
+
+	// A SEALED KEY MOVED TO ANOTHER KID DOES NOT OPEN
+	config.DB.Model(&models.SigningKey{KID: key.ID}).Update("KID", "moved")
+	_, err = keyring.Open(config.DB, sealer, keyring.EdDSA, schedule)
+	assert.Error(t, err)
+}
+
+func TestSealerFromEnv(t *testing.T) {
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "")
+	_, err := keyring.SealerFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "c2hvcnQ=")
+	_, err = keyring.SealerFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=")
+	sealer, err := keyring.SealerFromEnv()
+	assert.NoError(t, err)
+	sealed, err := sealer.Seal([]byte("key"), []byte("kid"))
+	assert.NoError(t, err)
+	opened, err := sealer.Open(sealed, []byte("kid"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("key"), opened)
+}
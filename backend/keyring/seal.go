@@ -0,0 +1,78 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// Key-encryption key private keys are sealed with before they are stored. A
+// KMS client can stand in for the local key
+type Sealer interface {
+	// Names the key-encryption key, stored with every key it sealed
+	ID() string
+	// The kid is bound to the ciphertext, so sealed keys can not be swapped
+	Seal(plaintext, kid []byte) ([]byte, error)
+	Open(sealed, kid []byte) ([]byte, error)
+}
+
+// Sealer with a local 256-bit AES-GCM key
+type AESSealer struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func NewAESSealer(kek []byte) (*AESSealer, error) {
+	if len(kek) != 32 {
+		return nil, errors.New("the key-encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(kek)
+	return &AESSealer{id: "aes:" + hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// Sealer from JWT_KEY_ENCRYPTION_KEY, 32 random bytes in base64
+func SealerFromEnv() (Sealer, error) {
+	value := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if value == "" {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY is not set")
+	}
+	kek, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY is not base64")
+	}
+	return NewAESSealer(kek)
+}
+
+func (s *AESSealer) ID() string {
+	return s.id
+}
+
+// Random nonce followed by the ciphertext
+func (s *AESSealer) Seal(plaintext, kid []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, kid), nil
+}
+
+func (s *AESSealer) Open(sealed, kid []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, kid)
+}
@@ -0,0 +1,60 @@
+// Package mailer sends transactional email such as password reset links.
+package mailer
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(msg Message) error
+}
+
+// Sender used by the handlers, replaced in main and in tests
+var Default Sender = LogSender{}
+
+var ErrHeaderInjection = errors.New("mail header contains a line break")
+
+// SMTP sender when SMTP_HOST is set, otherwise mail is only logged
+func FromEnv() Sender {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogSender{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return SMTPSender{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// Writes mail to the log, for development without a mail server
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func checkHeaders(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return ErrHeaderInjection
+		}
+	}
+	return nil
+}
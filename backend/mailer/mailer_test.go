@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Accepts one message over SMTP and hands back its DATA
+func fakeSMTPServer(t *testing.T) (host, port string, received chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received = make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port, received
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	sender := SMTPSender{Host: host, Port: port, From: "library@example.com"}
+
+	err := sender.Send(Message{To: "reader@example.com", Subject: "Réinitialiser", Body: "Line one\nLine two"})
+	assert.NoError(t, err)
+
+	data := <-received
+	assert.Contains(t, data, "From: library@example.com\r\n")
+	assert.Contains(t, data, "To: reader@example.com\r\n")
+	assert.Contains(t, data, "Subject: =?utf-8?q?R=C3=A9initialiser?=\r\n")
+	assert.Contains(t, data, "\r\n\r\nLine one\r\nLine two")
+}
+
+func TestSMTPSender_RejectsHeaderInjection(t *testing.T) {
+	sender := SMTPSender{Host: "127.0.0.1", Port: "1", From: "library@example.com"}
+	err := sender.Send(Message{To: "reader@example.com\r\nBcc: victim@example.com", Subject: "Hi"})
+	assert.ErrorIs(t, err, ErrHeaderInjection)
+}
+
+func TestMemory(t *testing.T) {
+	memory := &Memory{}
+	assert.NoError(t, memory.Send(Message{To: "a@example.com", Subject: "First"}))
+	assert.NoError(t, memory.Send(Message{To: "b@example.com", Subject: "Second"}))
+
+	messages := memory.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "Second", messages[1].Subject)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	assert.IsType(t, LogSender{}, FromEnv())
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_FROM", "library@example.com")
+	sender, ok := FromEnv().(SMTPSender)
+	assert.True(t, ok)
+	assert.Equal(t, "587", sender.Port)
+	assert.Equal(t, "library@example.com", sender.From)
+}
@@ -1,26 +1,55 @@
 package main
 
 import (
+	"log"
+	"os"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/prabhatKr-1/lib-man-sys/backend/breach"
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/controllers"
+	"github.com/prabhatKr-1/lib-man-sys/backend/keyring"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
+	"github.com/prabhatKr-1/lib-man-sys/backend/oidc"
 	"github.com/prabhatKr-1/lib-man-sys/backend/routes"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 )
 
 func main() {
 	godotenv.Load()
 
 	config.ConnectDB()
+	mailer.Default = mailer.FromEnv()
+	breached, err := breach.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to open the breached password list: %v", err)
+	}
+	breach.Default = breached
+	// ONLY FOR AN IDENTITY PROVIDER RUNNING ON THE DEVELOPER'S OWN MACHINE
+	oidc.AllowInsecure = os.Getenv("SSO_ALLOW_INSECURE_ISSUERS") == "true"
+
+	sealer, err := keyring.SealerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load the signing key encryption key: %v", err)
+	}
+	keys, err := keyring.Open(config.DB, sealer, signingAlgorithm(), signingSchedule())
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	utils.Keys = keys
+	keys.StartRotationWorker(time.Hour)
+
+	controllers.StartHoldExpiryWorker(15 * time.Minute)
 
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"}, 
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Auth-Mode"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -29,3 +58,29 @@ func main() {
 
 	r.Run()
 }
+
+// Algorithm new signing keys use, EdDSA unless JWT_ALGORITHM says RS256
+func signingAlgorithm() string {
+	if algorithm := os.Getenv("JWT_ALGORITHM"); algorithm != "" {
+		return algorithm
+	}
+	return keyring.EdDSA
+}
+
+// Keys sign for JWT_KEY_LIFETIME (30 days by default), are published a day
+// ahead and verify until the last token they signed has expired
+func signingSchedule() keyring.Schedule {
+	lifetime := 30 * 24 * time.Hour
+	if value := os.Getenv("JWT_KEY_LIFETIME"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid JWT_KEY_LIFETIME: %v", err)
+		}
+		lifetime = parsed
+	}
+	return keyring.Schedule{
+		Lifetime:   lifetime,
+		Prepublish: min(24*time.Hour, lifetime/2),
+		Overlap:    utils.AccessTokenTTL + time.Hour,
+	}
+}
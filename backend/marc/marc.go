@@ -0,0 +1,254 @@
+// Package marc reads and writes bibliographic records as binary MARC21
+// (ISO 2709) and MARCXML.
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+
+	leaderLength      = 24
+	directoryEntryLen = 12
+)
+
+// Leader used for new records: new, language material, monograph, UTF-8
+const DefaultLeader = "00000nam a2200000 i 4500"
+
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+type Subfield struct {
+	Code  string
+	Value string
+}
+
+type DataField struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Subfields []Subfield
+}
+
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// First value of a subfield in the first field carrying it
+func (r Record) Subfield(tag, code string) string {
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, sf := range field.Subfields {
+			if sf.Code == code {
+				return sf.Value
+			}
+		}
+	}
+	return ""
+}
+
+// Values of a subfield across every field with the tag
+func (r Record) Subfields(tag, code string) []string {
+	var values []string
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, sf := range field.Subfields {
+			if sf.Code == code {
+				values = append(values, sf.Value)
+			}
+		}
+	}
+	return values
+}
+
+// Fields with the tag
+func (r Record) Fields(tag string) []DataField {
+	var fields []DataField
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func indicator(ind string) byte {
+	if ind == "" {
+		return ' '
+	}
+	return ind[0]
+}
+
+// Encodes the record as binary MARC21, computing the directory, base address
+// and record length
+func (r Record) MarshalBinary() ([]byte, error) {
+	var directory, data bytes.Buffer
+
+	addField := func(tag string, body []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("marc: invalid tag %q", tag)
+		}
+		body = append(body, fieldTerminator)
+		if len(body) > 9999 {
+			return fmt.Errorf("marc: field %s is too long", tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(body), data.Len())
+		data.Write(body)
+		return nil
+	}
+
+	for _, field := range r.ControlFields {
+		if err := addField(field.Tag, []byte(field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range r.DataFields {
+		body := []byte{indicator(field.Ind1), indicator(field.Ind2)}
+		for _, sf := range field.Subfields {
+			body = append(body, subfieldDelimiter)
+			body = append(body, sf.Code...)
+			body = append(body, sf.Value...)
+		}
+		if err := addField(field.Tag, body); err != nil {
+			return nil, err
+		}
+	}
+	directory.WriteByte(fieldTerminator)
+
+	baseAddress := leaderLength + directory.Len()
+	recordLength := baseAddress + data.Len() + 1
+	if recordLength > 99999 {
+		return nil, errors.New("marc: record is too long")
+	}
+
+	leader := r.Leader
+	if len(leader) != leaderLength {
+		leader = DefaultLeader
+	}
+	out := make([]byte, 0, recordLength)
+	out = append(out, fmt.Sprintf("%05d", recordLength)...)
+	out = append(out, leader[5:12]...)
+	out = append(out, fmt.Sprintf("%05d", baseAddress)...)
+	out = append(out, leader[17:20]...)
+	out = append(out, "4500"...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, data.Bytes()...)
+	out = append(out, recordTerminator)
+	return out, nil
+}
+
+// Decodes a single binary MARC21 record
+func (r *Record) UnmarshalBinary(raw []byte) error {
+	if len(raw) < leaderLength+1 {
+		return errors.New("marc: record is too short")
+	}
+
+	baseAddress, ok := parseDigits(raw[12:17])
+	if !ok || baseAddress <= leaderLength || baseAddress > len(raw) {
+		return errors.New("marc: invalid base address")
+	}
+
+	*r = Record{Leader: string(raw[:leaderLength])}
+	directory := raw[leaderLength : baseAddress-1]
+	if len(directory)%directoryEntryLen != 0 {
+		return errors.New("marc: invalid directory")
+	}
+
+	for i := 0; i < len(directory); i += directoryEntryLen {
+		entry := directory[i : i+directoryEntryLen]
+		tag := string(entry[:3])
+		length, ok1 := parseDigits(entry[3:7])
+		start, ok2 := parseDigits(entry[7:12])
+		// THE FIELD MUST END BEFORE THE RECORD TERMINATOR
+		if !ok1 || !ok2 || length < 1 || baseAddress+start+length > len(raw)-1 {
+			return fmt.Errorf("marc: invalid directory entry for tag %s", tag)
+		}
+		body := raw[baseAddress+start : baseAddress+start+length-1]
+
+		if strings.HasPrefix(tag, "00") {
+			r.ControlFields = append(r.ControlFields, ControlField{Tag: tag, Value: string(body)})
+			continue
+		}
+
+		field := DataField{Tag: tag, Ind1: " ", Ind2: " "}
+		if len(body) >= 2 {
+			field.Ind1, field.Ind2 = string(body[0]), string(body[1])
+			body = body[2:]
+		}
+		for _, chunk := range bytes.Split(body, []byte{subfieldDelimiter}) {
+			if len(chunk) == 0 {
+				continue
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: string(chunk[0]), Value: string(chunk[1:])})
+		}
+		r.DataFields = append(r.DataFields, field)
+	}
+	return nil
+}
+
+// Parses a fixed-width field of ASCII digits, rejecting signs and spaces
+func parseDigits(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, len(b) > 0
+}
+
+// Reads consecutive binary MARC21 records until EOF
+func ReadBinary(r io.Reader) ([]Record, error) {
+	reader := bufio.NewReader(r)
+	var records []Record
+	for {
+		raw, err := reader.ReadBytes(recordTerminator)
+		if len(bytes.TrimSpace(raw)) > 0 {
+			if raw[len(raw)-1] != recordTerminator {
+				return records, fmt.Errorf("marc: record %d is truncated", len(records)+1)
+			}
+			var record Record
+			if err := record.UnmarshalBinary(raw); err != nil {
+				return records, fmt.Errorf("record %d: %v", len(records)+1, err)
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+	}
+}
+
+// Writes records as consecutive binary MARC21 records
+func WriteBinary(w io.Writer, records []Record) error {
+	for _, record := range records {
+		raw, err := record.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
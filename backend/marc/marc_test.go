@@ -0,0 +1,91 @@
+package marc
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleRecord() Record {
+	return Record{
+		Leader:        DefaultLeader,
+		ControlFields: []ControlField{{Tag: "001", Value: "9780306406157"}},
+		DataFields: []DataField{
+			{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "9780306406157"}}},
+			{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "Doe, John"}}},
+			{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []Subfield{{Code: "a", Value: "Go Programming :"}, {Code: "b", Value: "a primer"}}},
+			{Tag: "700", Ind1: "1", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "Roe, Jane"}}},
+			{Tag: "700", Ind1: "1", Ind2: " ", Subfields: []Subfield{{Code: "a", Value: "Müller, Anna"}}},
+		},
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteBinary(&buf, []Record{sampleRecord(), sampleRecord()})
+	assert.NoError(t, err)
+
+	raw := buf.Bytes()
+	assert.Equal(t, byte(recordTerminator), raw[len(raw)-1])
+	// RECORD LENGTH IN THE LEADER COUNTS BYTES, NOT CHARACTERS
+	length, _ := strconv.Atoi(string(raw[:5]))
+	assert.Equal(t, len(raw)/2, length)
+
+	records, err := ReadBinary(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "9780306406157", records[0].ControlFields[0].Value)
+	assert.Equal(t, "a primer", records[0].Subfield("245", "b"))
+	assert.Equal(t, []string{"Roe, Jane", "Müller, Anna"}, records[1].Subfields("700", "a"))
+	assert.Equal(t, "1", records[0].Fields("245")[0].Ind1)
+}
+
+func TestReadBinary_Truncated(t *testing.T) {
+	raw, err := sampleRecord().MarshalBinary()
+	assert.NoError(t, err)
+
+	_, err = ReadBinary(bytes.NewReader(raw[:len(raw)-10]))
+	assert.Error(t, err)
+}
+
+func TestUnmarshalBinary_MalformedDirectoryEntry(t *testing.T) {
+	raw, err := sampleRecord().MarshalBinary()
+	assert.NoError(t, err)
+
+	// NEGATIVE, SIGNED, NON-DIGIT, EMPTY AND OVERRUNNING FIELDS
+	for _, entry := range []string{"245-10000050", "2450010-0050", "245+01000050", "2450010 0050", "245000000000", "245999900000"} {
+		corrupt := append([]byte(nil), raw...)
+		copy(corrupt[leaderLength:], entry)
+		var record Record
+		assert.Error(t, record.UnmarshalBinary(corrupt), entry)
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteXML(&buf, []Record{sampleRecord()})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+	assert.Contains(t, buf.String(), `<datafield tag="245" ind1="1" ind2="0">`)
+
+	records, err := ReadXML(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, sampleRecord(), records[0])
+}
+
+func TestReadXML_SingleRecord(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>00000nam a2200000 i 4500</leader>
+  <datafield tag="245" ind1="0" ind2="0"><subfield code="a">Single</subfield></datafield>
+</record>`
+
+	records, err := ReadXML(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "Single", records[0].Subfield("245", "a"))
+}
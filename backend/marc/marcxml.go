@@ -0,0 +1,113 @@
+package marc
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"collection"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Records []xmlRecord `xml:"record"`
+}
+
+func toXML(r Record) xmlRecord {
+	out := xmlRecord{Leader: r.Leader}
+	if len(out.Leader) != leaderLength {
+		out.Leader = DefaultLeader
+	}
+	for _, field := range r.ControlFields {
+		out.ControlFields = append(out.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range r.DataFields {
+		df := xmlDataField{Tag: field.Tag, Ind1: string(indicator(field.Ind1)), Ind2: string(indicator(field.Ind2))}
+		for _, sf := range field.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: sf.Code, Value: sf.Value})
+		}
+		out.DataFields = append(out.DataFields, df)
+	}
+	return out
+}
+
+func fromXML(r xmlRecord) Record {
+	out := Record{Leader: r.Leader}
+	for _, field := range r.ControlFields {
+		out.ControlFields = append(out.ControlFields, ControlField{Tag: field.Tag, Value: field.Value})
+	}
+	for _, field := range r.DataFields {
+		df := DataField{Tag: field.Tag, Ind1: field.Ind1, Ind2: field.Ind2}
+		for _, sf := range field.Subfields {
+			df.Subfields = append(df.Subfields, Subfield{Code: sf.Code, Value: sf.Value})
+		}
+		out.DataFields = append(out.DataFields, df)
+	}
+	return out
+}
+
+// Reads a MARCXML collection, or a single record element
+func ReadXML(r io.Reader) ([]Record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection xmlCollection
+	if err := xml.Unmarshal(data, &collection); err == nil {
+		records := make([]Record, 0, len(collection.Records))
+		for _, record := range collection.Records {
+			records = append(records, fromXML(record))
+		}
+		return records, nil
+	}
+
+	var single xmlRecord
+	if err := xml.Unmarshal(data, &single); err != nil {
+		return nil, err
+	}
+	return []Record{fromXML(single)}, nil
+}
+
+// Writes records as a MARCXML collection
+func WriteXML(w io.Writer, records []Record) error {
+	collection := xmlCollection{Xmlns: Namespace}
+	for _, record := range records {
+		collection.Records = append(collection.Records, toXML(record))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(collection); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
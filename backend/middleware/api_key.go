@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+)
+
+// last_used_at is written at most this often, not on every request
+const lastUsedGranularity = time.Minute
+
+// Access token of the request: the cookie of browsers, or the Authorization
+// header of other clients
+func AccessToken(c *gin.Context) string {
+	if token, err := c.Cookie("token"); err == nil && token != "" {
+		return token
+	}
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Live API key with its scopes and the owner it acts for
+func ValidateAPIKey(token string) (models.APIKey, error) {
+	var key models.APIKey
+	if err := config.DB.Preload("Scopes").Preload("Creator").
+		Where("token_hash = ?", utils.HashToken(token)).First(&key).Error; err != nil {
+		return key, utils.ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return key, utils.ErrInvalidAPIKey
+	}
+	if key.Creator.DeactivatedAt != nil {
+		return key, utils.ErrAccountDeactivated
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedGranularity {
+		config.DB.Model(&key).UpdateColumn("last_used_at", now)
+	}
+	return key, nil
+}
+
+// Scopes of a key as a permission set
+func scopesOf(key models.APIKey) permissions.Set {
+	set := permissions.Set{}
+	for _, s := range key.Scopes {
+		set[permissions.Permission(s.Permission)] = true
+	}
+	return set
+}
@@ -1,27 +1,70 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 )
 
-// Auth Middleware with injectable JWT validator
+// Auth Middleware with injectable JWT validator. Roles, when given, limit the
+// kinds of account let through; without them any account is, and routes
+// decide with RequirePermission
 func AuthMiddleware(jwtValidator utils.JWTValidatorFunc, roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString, err := c.Cookie("token")
-		if err != nil || tokenString == "" {
+		tokenString := AccessToken(c)
+		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
 
+		// 🔹 API keys act for the owner who created them, within their scopes
+		if strings.HasPrefix(tokenString, utils.APIKeyPrefix) {
+			key, err := ValidateAPIKey(tokenString)
+			if errors.Is(err, utils.ErrAccountDeactivated) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account deactivated"})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			if len(roles) > 0 && !contains(roles, key.Creator.Role) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+				return
+			}
+			c.Set("api_key", key.KeyID)
+			c.Set("scopes", scopesOf(key))
+			c.Set("id", key.Creator.ID)
+			c.Set("libid", key.LibID)
+			c.Set("email", key.Creator.Email)
+			c.Set("role", key.Creator.Role)
+			c.Next()
+			return
+		}
+
 		id, LibID, email, role, err := jwtValidator(tokenString)
+		if errors.Is(err, jwt.ErrTokenExpired) { // 🔹 Tells the client to use its refresh token
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			return
+		}
+		if errors.Is(err, utils.ErrSessionRevoked) { // 🔹 Logged out or revoked, a refresh will not help
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			return
+		}
+		if errors.Is(err, utils.ErrAccountDeactivated) { // 🔹 Switched off by staff
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Account deactivated"})
+			return
+		}
 		if err != nil { // 🔹 Return 401 if token validation fails
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		if !contains(roles, role) { // 🔹 Return 403 if role authorization fails
+		if len(roles) > 0 && !contains(roles, role) { // 🔹 Return 403 if role authorization fails
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 			return
 		}
@@ -42,3 +85,13 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+// Route guard for what only a logged-in person may do, such as changing their
+// password; API keys are refused
+func SessionOnly(c *gin.Context) {
+	if _, ok := c.Get("api_key"); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not available to API keys"})
+		return
+	}
+	c.Next()
+}
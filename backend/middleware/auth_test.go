@@ -4,8 +4,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prabhatKr-1/lib-man-sys/backend/keyring"
 	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -137,3 +140,105 @@ func TestAuthMiddleware_CaseSensitiveRole(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, w.Code) 
 	assert.Contains(t, w.Body.String(), "Forbidden")
 }
+
+func TestAuthMiddleware_ExpiredToken(t *testing.T) {
+	router := setupRouterWithMiddleware(utils.ValidateJWT, "Admin")
+
+	key, err := utils.Keys.Signing(time.Now())
+	assert.NoError(t, err)
+	expired, _ := utils.SignJWT(key, utils.Claims{
+		UserID:    1,
+		LibID:     1,
+		Email:     "admin@example.com",
+		Role:      "Admin",
+		SessionID: 7,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "lib-man-sys",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: expired})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Token expired")
+}
+
+func TestAuthMiddleware_FreshAccessToken(t *testing.T) {
+	router := setupRouterWithMiddleware(utils.ValidateJWT, "Admin")
+
+	token, err := utils.GenerateJWT(1, 1, "admin@example.com", "Admin", 7)
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "admin@example.com")
+}
+
+func TestAuthMiddleware_WrongSignature(t *testing.T) {
+	router := setupRouterWithMiddleware(utils.ValidateJWT, "Admin")
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": "admin@example.com",
+		"role":  "Admin",
+		"id":    1,
+		"libid": 1,
+		"exp":   time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte("another-secret"))
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: forged})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// AN EXPIRED TOKEN WITH A BAD SIGNATURE IS NOT WORTH REFRESHING
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid token")
+}
+
+func TestAuthMiddleware_AlgorithmConfusion(t *testing.T) {
+	router := setupRouterWithMiddleware(utils.ValidateJWT, "Admin")
+	key, err := utils.Keys.Signing(time.Now())
+	assert.NoError(t, err)
+	claims := jwt.MapClaims{
+		"email": "admin@example.com",
+		"role":  "Admin",
+		"id":    1,
+		"libid": 1,
+		"sid":   7,
+		"iss":   "lib-man-sys",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+
+	// THE PUBLIC KEY IS NO SECRET, SO AN HMAC MADE WITH IT PROVES NOTHING
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = key.ID
+	forged, _ := hmac.SignedString([]byte(key.JWK()["x"]))
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = key.ID
+	none, _ := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	// A KEY OF OUR OWN ALGORITHM THAT THE RING NEVER ISSUED
+	other, _ := keyring.NewEphemeral(keyring.EdDSA, keyring.Schedule{Lifetime: time.Hour}).Signing(time.Now())
+	stranger := jwt.NewWithClaims(other.Method(), claims)
+	stranger.Header["kid"] = key.ID
+	foreign, _ := stranger.SignedString(other.Private())
+
+	for _, token := range []string{forged, none, foreign} {
+		req, _ := http.NewRequest("GET", "/protected", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid token")
+	}
+}
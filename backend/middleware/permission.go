@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+)
+
+// Permissions of an account: those of its custom role when it has one,
+// otherwise those of its built-in role
+func PermissionsOf(userID uint, role string) (permissions.Set, error) {
+	var user models.User
+	if err := config.DB.Select("id", "role_id").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.RoleID == nil {
+		return permissions.ForRole(role), nil
+	}
+
+	var grants []models.RolePermission
+	if err := config.DB.Where("role_id = ?", *user.RoleID).Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	set := permissions.Set{}
+	for _, g := range grants {
+		set[permissions.Permission(g.Permission)] = true
+	}
+	return set, nil
+}
+
+// Route guard placed after AuthMiddleware. Every listed permission is needed,
+// and requests made with an API key are held to its scopes as well; the
+// resolved set is left in the context as "permissions" for the handler
+func RequirePermission(perms ...permissions.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := c.Get("id")
+		role, _ := c.Get("role")
+		userID, ok := id.(uint)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		granted, err := PermissionsOf(userID, fmt.Sprint(role))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		// AN API KEY NEVER HOLDS MORE THAN THE OWNER WHO CREATED IT
+		if scopes, ok := c.Get("scopes"); ok {
+			granted = granted.Intersect(scopes.(permissions.Set))
+		}
+		for _, p := range perms {
+			if !granted.Has(p) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "missing_permission": p})
+				return
+			}
+		}
+
+		c.Set("permissions", granted)
+		c.Next()
+	}
+}
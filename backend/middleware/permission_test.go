@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestAs(userID uint, role string, perm permissions.Permission) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/protected", func(c *gin.Context) {
+		c.Set("id", userID)
+		c.Set("role", role)
+		c.Next()
+	}, RequirePermission(perm), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
+	})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequirePermission_BuiltInRole(t *testing.T) {
+	testutils.SetupTestDB()
+	config.DB.Create(&models.User{ID: 1, Name: "Admin", Email: "admin@example.com", Password: "x", Contact_number: "1", Role: "Admin", LibID: 1})
+
+	assert.Equal(t, http.StatusOK, requestAs(1, "Admin", permissions.BooksWrite).Code)
+	w := requestAs(1, "Admin", permissions.StaffManage)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "staff:manage")
+
+	assert.Equal(t, http.StatusUnauthorized, requestAs(99, "Admin", permissions.BooksRead).Code)
+}
+
+func TestRequirePermission_CustomRole(t *testing.T) {
+	testutils.SetupTestDB()
+	config.DB.Create(&models.Role{RoleID: 1, LibID: 1, Name: "Cataloguer", BaseRole: "Admin"})
+	config.DB.Create(&models.RolePermission{RoleID: 1, Permission: string(permissions.BooksWrite)})
+	roleID := uint(1)
+	config.DB.Create(&models.User{ID: 1, Name: "Admin", Email: "admin@example.com", Password: "x", Contact_number: "1", Role: "Admin", LibID: 1, RoleID: &roleID})
+
+	// THE CUSTOM ROLE REPLACES WHAT THE BUILT-IN ROLE WOULD ALLOW
+	assert.Equal(t, http.StatusOK, requestAs(1, "Admin", permissions.BooksWrite).Code)
+	assert.Equal(t, http.StatusForbidden, requestAs(1, "Admin", permissions.BooksRead).Code)
+}
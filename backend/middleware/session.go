@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"math"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+)
+
+// JWT validator that also requires the session of the token to be live, so
+// logout and revocations take effect before the access token expires
+func ValidateSession(tokenString string) (uint, uint, string, string, error) {
+	claims, err := utils.ParseJWT(tokenString)
+	if err != nil {
+		return math.MaxUint64, math.MaxUint64, "", "", err
+	}
+
+	var session models.Session
+	if err := config.DB.Preload("User").First(&session, claims.SessionID).Error; err != nil {
+		return math.MaxUint64, math.MaxUint64, "", "", utils.ErrSessionRevoked
+	}
+	if !session.Active(time.Now()) {
+		return math.MaxUint64, math.MaxUint64, "", "", utils.ErrSessionRevoked
+	}
+
+	// A ROLE CHANGE ENDS EVERY SESSION STARTED UNDER THE OLD ROLE
+	user := session.User
+	if user.ID != claims.UserID || user.Role != claims.Role {
+		config.DB.Model(&session).Update("revoked_at", time.Now())
+		return math.MaxUint64, math.MaxUint64, "", "", utils.ErrSessionRevoked
+	}
+
+	if user.DeactivatedAt != nil {
+		return math.MaxUint64, math.MaxUint64, "", "", utils.ErrAccountDeactivated
+	}
+
+	return user.ID, user.LibID, user.Email, user.Role, nil
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
+	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSession(t *testing.T) (models.User, models.Session, string) {
+	testutils.SetupTestDB()
+
+	user := models.User{Name: "Admin", Email: "admin@example.com", Password: "x", Contact_number: "1", Role: "Admin", LibID: 1}
+	config.DB.Create(&user)
+	session := models.Session{UserID: user.ID, LibID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	config.DB.Create(&session)
+
+	token, err := utils.GenerateJWT(user.ID, user.LibID, user.Email, user.Role, session.SessionID)
+	assert.NoError(t, err)
+	return user, session, token
+}
+
+func requestWith(token string) *httptest.ResponseRecorder {
+	router := setupRouterWithMiddleware(ValidateSession, "Admin")
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestValidateSession_ActiveSession(t *testing.T) {
+	_, _, token := setupSession(t)
+
+	w := requestWith(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "admin@example.com")
+}
+
+func TestValidateSession_RevokedSession(t *testing.T) {
+	_, session, token := setupSession(t)
+	config.DB.Model(&session).Update("revoked_at", time.Now())
+
+	w := requestWith(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session revoked")
+}
+
+func TestValidateSession_RoleChange(t *testing.T) {
+	user, session, token := setupSession(t)
+	config.DB.Model(&user).Update("role", "Reader")
+
+	w := requestWith(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session revoked")
+
+	// THE SESSION STAYS REVOKED IF THE ROLE IS CHANGED BACK
+	config.DB.First(&session, session.SessionID)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func TestValidateSession_UnknownSession(t *testing.T) {
+	user, _, _ := setupSession(t)
+	token, _ := utils.GenerateJWT(user.ID, user.LibID, user.Email, user.Role, 999)
+
+	w := requestWith(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session revoked")
+}
+
+func TestValidateSession_DeactivatedUser(t *testing.T) {
+	user, _, token := setupSession(t)
+	config.DB.Model(&user).Update("deactivated_at", time.Now())
+
+	w := requestWith(token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Account deactivated")
+}
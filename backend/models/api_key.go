@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Key a library owner hands to a kiosk or an integration script. It acts for
+// the owner who created it, limited to its scopes; only the SHA-256 hash of
+// the key is stored, Prefix is kept so owners can tell keys apart
+type APIKey struct {
+	KeyID      uint       `gorm:"primaryKey" json:"keyID"`
+	LibID      uint       `gorm:"not null;index" json:"lib_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;size:16" json:"prefix"`
+	TokenHash  string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	CreatedBy  uint       `gorm:"not null" json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Scopes  []APIKeyScope `gorm:"foreignKey:KeyID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Creator User          `gorm:"foreignKey:CreatedBy;references:ID" json:"-"`
+}
+
+type APIKeyScope struct {
+	KeyID      uint   `gorm:"primaryKey;autoIncrement:false" json:"keyID"`
+	Permission string `gorm:"primaryKey;size:64" json:"permission"`
+}
+
+// Whether the key may still be used
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
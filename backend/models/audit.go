@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The audit log is append-only
+var ErrAuditImmutable = errors.New("audit entries can not be changed")
+
+// A change made by staff, written in the same transaction as the change
+type AuditEntry struct {
+	AuditID    uint   `gorm:"primaryKey" json:"audit_id"`
+	LibID      uint   `gorm:"not null;index" json:"lib_id"`
+	ActorID    uint   `gorm:"not null;index" json:"actor_id"`
+	ActorEmail string `gorm:"not null" json:"actor_email"`
+	ActorRole  string `gorm:"not null" json:"actor_role"`
+	// Set when the actor acted through one of their API keys
+	APIKeyID   *uint  `json:"api_key_id"`
+	Action     string `gorm:"not null;index" json:"action"`
+	EntityType string `gorm:"not null;index:idx_audit_entity" json:"entity_type"`
+	EntityID   string `gorm:"not null;index:idx_audit_entity" json:"entity_id"`
+	// Fields the action changed, as they were and as they became. A creation
+	// has no Before and a deletion no After
+	Before    map[string]interface{} `gorm:"type:text;serializer:json" json:"before"`
+	After     map[string]interface{} `gorm:"type:text;serializer:json" json:"after"`
+	Method    string                 `gorm:"not null" json:"method"`
+	Path      string                 `gorm:"not null" json:"path"`
+	IPAddress string                 `json:"ip_address"`
+	UserAgent string                 `json:"user_agent"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (AuditEntry) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditImmutable
+}
+
+func (AuditEntry) BeforeDelete(*gorm.DB) error {
+	return ErrAuditImmutable
+}
@@ -1,9 +1,14 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Books struct {
-	ISBN             uint   `gorm:"primaryKey"`
+	ISBN             string `gorm:"primaryKey;size:13"`
 	LibID            uint   `gorm:"primaryKey;autoIncrement:false"`
 	Title            string `gorm:"not null" binding:"required" json:"title"`
 	Authors          string `gorm:"not null" binding:"required" json:"authors"`
@@ -11,9 +16,34 @@ type Books struct {
 	Version          string `gorm:"not null" binding:"required" json:"version"`
 	Total_copies     uint   `gorm:"not null" binding:"required,min=1" json:"total_copies"`
 	Available_copies uint   `gorm:"not null" json:"available_copies"`
+	Category         string `gorm:"not null;default:''" json:"category"`
+	Description      string `gorm:"not null;default:''" json:"description"`
+	Language         string `gorm:"not null;default:''" json:"language"`
+	PublicationYear  uint   `gorm:"not null;default:0" json:"publication_year"`
+
+	// Subject headings, stored as BookSubject rows
+	Subjects []string `gorm:"-" json:"subjects"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	Library Library `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
+
+// Language codes are compared case-insensitively, so they are kept lower case
+func (b *Books) BeforeSave(tx *gorm.DB) error {
+	b.Language = strings.ToLower(strings.TrimSpace(b.Language))
+	return nil
+}
+
+// Every new title gets one item per copy so the counters start out in sync,
+// and its subject headings
+func (b *Books) AfterCreate(tx *gorm.DB) error {
+	if err := CreateItemsForCounters(tx, *b); err != nil {
+		return err
+	}
+	if len(b.Subjects) == 0 {
+		return nil
+	}
+	return SetBookSubjects(tx, b.ISBN, b.LibID, b.Subjects)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A physical copy of a book. Books.Total_copies and Books.Available_copies
+// are derived from the status of these rows
+type BookItem struct {
+	ItemID        uint   `gorm:"primaryKey" json:"itemID"`
+	Barcode       string `gorm:"not null;uniqueIndex:idx_item_barcode" json:"barcode"`
+	ISBN          string `gorm:"not null;size:13;index:idx_item_book" json:"isbn"`
+	LibID         uint   `gorm:"not null;uniqueIndex:idx_item_barcode;index:idx_item_book" json:"lib_id"`
+	ShelfLocation string `json:"shelf_location"`
+	Condition     string `gorm:"not null;default:'good';check:condition IN ('new','good','fair','poor','damaged')" json:"condition"`
+	Status        string `gorm:"not null;default:'available';check:status IN ('available','on_loan','damaged','lost','withdrawn')" json:"status"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Book Books `gorm:"foreignKey:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Barcode given to the n-th generated copy of a book
+func ItemBarcode(isbn string, n int64) string {
+	return fmt.Sprintf("%s-%04d", isbn, n)
+}
+
+// Materialises one item per copy for a book that has none yet, marking the
+// copies that are not available as on loan
+func CreateItemsForCounters(tx *gorm.DB, book Books) error {
+	var count int64
+	if err := tx.Model(&BookItem{}).Where("isbn = ? AND lib_id = ?", book.ISBN, book.LibID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || book.Total_copies == 0 {
+		return nil
+	}
+
+	items := make([]BookItem, 0, book.Total_copies)
+	for n := uint(0); n < book.Total_copies; n++ {
+		status := "available"
+		if n >= book.Available_copies {
+			status = "on_loan"
+		}
+		items = append(items, BookItem{
+			Barcode:   ItemBarcode(book.ISBN, int64(n)+1),
+			ISBN:      book.ISBN,
+			LibID:     book.LibID,
+			Condition: "good",
+			Status:    status,
+		})
+	}
+	return tx.Create(&items).Error
+}
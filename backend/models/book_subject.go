@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// A subject heading or tag of a book, used for faceted browsing
+type BookSubject struct {
+	SubjectID uint   `gorm:"primaryKey" json:"subjectID"`
+	ISBN      string `gorm:"not null;size:13;uniqueIndex:idx_book_subject" json:"isbn"`
+	LibID     uint   `gorm:"not null;uniqueIndex:idx_book_subject;index:idx_subject_facet" json:"lib_id"`
+	Subject   string `gorm:"not null;uniqueIndex:idx_book_subject;index:idx_subject_facet" json:"subject"`
+
+	Book Books `gorm:"foreignKey:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Replaces the subject headings of a book, ignoring blanks and duplicates
+func SetBookSubjects(tx *gorm.DB, isbn string, libID uint, subjects []string) error {
+	if err := tx.Where("isbn = ? AND lib_id = ?", isbn, libID).Delete(&BookSubject{}).Error; err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	rows := make([]BookSubject, 0, len(subjects))
+	for _, subject := range subjects {
+		subject = strings.TrimSpace(subject)
+		if subject == "" || seen[strings.ToLower(subject)] {
+			continue
+		}
+		seen[strings.ToLower(subject)] = true
+		rows = append(rows, BookSubject{ISBN: isbn, LibID: libID, Subject: subject})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
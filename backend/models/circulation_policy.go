@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// An empty Category or ReaderType matches every book category or reader type,
+// so the row with both empty is the library-wide default
+type CirculationPolicy struct {
+	PolicyID       uint   `gorm:"primaryKey" json:"policyID"`
+	LibID          uint   `gorm:"not null;uniqueIndex:idx_policy_scope" json:"lib_id"`
+	Category       string `gorm:"not null;default:'';uniqueIndex:idx_policy_scope" json:"category"`
+	ReaderType     string `gorm:"not null;default:'';uniqueIndex:idx_policy_scope" json:"reader_type"`
+	LoanPeriodDays uint   `gorm:"not null;default:14" json:"loan_period_days"`
+	MaxLoans       uint   `gorm:"not null;default:0" json:"max_loans"`
+	MaxRenewals    uint   `gorm:"not null" json:"max_renewals"`
+	FineDailyRate  uint   `gorm:"not null;default:0" json:"fine_daily_rate"`
+	FineGraceDays  uint   `gorm:"not null;default:0" json:"fine_grace_days"`
+	FineCap        uint   `gorm:"not null;default:0" json:"fine_cap"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rules used for a library that has no policy configured
+func DefaultCirculationPolicy(libID uint) CirculationPolicy {
+	return CirculationPolicy{
+		LibID:          libID,
+		LoanPeriodDays: 14,
+		MaxLoans:       5,
+		MaxRenewals:    2,
+	}
+}
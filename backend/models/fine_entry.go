@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Amounts are stored in the smallest currency unit
+type FineEntry struct {
+	EntryID      uint   `gorm:"primaryKey" json:"entryID"`
+	LibID        uint   `gorm:"not null;index" json:"lib_id"`
+	ReaderID     uint   `gorm:"not null;index" json:"readerID"`
+	IssueID      *uint  `json:"issueID"`
+	EntryType    string `gorm:"not null;check:entry_type IN ('charge','payment','waiver')" json:"entry_type"`
+	Amount       uint   `gorm:"not null" json:"amount"`
+	Reason       string `json:"reason"`
+	RecordedByID *uint  `json:"recordedByID"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	Reader     User           `gorm:"foreignKey:ReaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Issue      *IssueRegistry `gorm:"foreignKey:IssueID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	RecordedBy *User          `gorm:"foreignKey:RecordedByID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+}
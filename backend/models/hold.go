@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type Hold struct {
+	HoldID         uint       `gorm:"primaryKey" json:"holdID"`
+	ISBN           string     `gorm:"not null;size:13;index:idx_hold_queue" json:"isbn"`
+	LibID          uint       `gorm:"not null;index:idx_hold_queue" json:"lib_id"`
+	ReaderID       uint       `gorm:"not null" json:"readerID"`
+	Status         string     `gorm:"not null;default:'waiting';check:status IN ('waiting','ready','fulfilled','cancelled','expired')" json:"status"`
+	ReqID          *uint      `json:"reqID"`
+	PickupDeadline *time.Time `json:"pickup_deadline"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Book   Books `gorm:"foreignKey:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Reader User  `gorm:"foreignKey:ReaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Invitation to join a library. The invitee chooses their own password when
+// accepting; the token is stored only as its SHA-256 hash
+type Invitation struct {
+	InviteID      uint       `gorm:"primaryKey" json:"inviteID"`
+	LibID         uint       `gorm:"not null;index" json:"lib_id"`
+	Name          string     `gorm:"not null" json:"name"`
+	Email         string     `gorm:"not null;index" json:"email"`
+	ContactNumber string     `gorm:"not null" json:"contact_number"`
+	Role          string     `gorm:"not null;check:role IN ('Admin','Reader')" json:"role"`
+	ReaderType    string     `gorm:"not null;default:''" json:"reader_type"`
+	InvitedBy     uint       `gorm:"not null" json:"invited_by"`
+	TokenHash     string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt    *time.Time `json:"accepted_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Whether the invitation can still be accepted
+func (i Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -4,7 +4,7 @@ import "time"
 
 type IssueRegistry struct {
 	IssueID         uint `gorm:"primaryKey" json:"issueID"`
-	ISBN            uint `gorm:"not null" binding:"required" json:"isbn"`
+	ISBN            string `gorm:"not null;size:13" binding:"required" json:"isbn"`
 	LibID           uint `gorm:"not null"`
 	ReaderID        uint `gorm:"not null" binding:"required" json:"readerID"`
 	IssueApproverID uint `gorm:"not null" binding:"required" json:"issueapproverID"`
@@ -13,11 +13,14 @@ type IssueRegistry struct {
 	ExpectedReturnDate time.Time  `gorm:"not null" binding:"required" json:"expected_return_date"`
 	ReturnDate         *time.Time `json:"return_date"`
 	ReturnApproverID   *uint      `json:"returnapproverID"`
+	RenewalCount       uint       `gorm:"not null;default:0" json:"renewal_count"`
+	ItemID             *uint      `json:"itemID"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	Book           Books `gorm:"foreignKey:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Item           *BookItem `gorm:"foreignKey:ItemID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
 	Reader         User  `gorm:"foreignKey:ReaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	IssueApprover  User  `gorm:"foreignKey:IssueApproverID;constraint:OnUpdate:CASCADE,OnDelete:NO ACTION;"`
 	ReturnApprover *User `gorm:"foreignKey:ReturnApproverID;constraint:OnUpdate:CASCADE,OnDelete:NO ACTION;"`
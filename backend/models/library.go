@@ -6,8 +6,12 @@ type Library struct {
 	LibID uint   `gorm:"primaryKey"  json:"id"`
 	Name  string `binding:"required" gorm:"unique;not null" json:"lib_name"`
 
+	// Owner and Admin accounts must log in with a TOTP code
+	Require2FA bool `gorm:"column:require_2fa;not null;default:false" json:"require_2fa"`
+
 	CreatedAt time.Time `json:"created_at"`
 
-	Users []User  `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Books []Books `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-}
\ No newline at end of file
+	Users    []User              `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Books    []Books             `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Policies []CirculationPolicy `gorm:"foreignKey:LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
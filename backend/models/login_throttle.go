@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Scopes failed logins are counted under
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// Failed logins against one email or from one client IP. Unknown emails are
+// counted too, so a locked-out answer says nothing about who is registered
+type LoginThrottle struct {
+	ThrottleID    uint       `gorm:"primaryKey" json:"throttleID"`
+	Scope         string     `gorm:"not null;size:16;uniqueIndex:idx_login_throttle_key" json:"scope"`
+	Key           string     `gorm:"not null;uniqueIndex:idx_login_throttle_key" json:"key"`
+	UserID        *uint      `gorm:"index" json:"userID"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"time"
+	"unicode"
+)
+
+// Longest password bcrypt can hash, it refuses anything past 72 bytes
+const MaxPasswordBytes = 72
+
+// Rules new passwords of a library's accounts must follow
+type PasswordPolicy struct {
+	LibID         uint `gorm:"primaryKey;autoIncrement:false" json:"lib_id"`
+	MinLength     int  `gorm:"not null" json:"min_length"`
+	RequireUpper  bool `gorm:"not null;default:false" json:"require_upper"`
+	RequireLower  bool `gorm:"not null;default:false" json:"require_lower"`
+	RequireDigit  bool `gorm:"not null;default:false" json:"require_digit"`
+	RequireSymbol bool `gorm:"not null;default:false" json:"require_symbol"`
+	// Recent passwords, the current one included, that can not be chosen again
+	HistorySize    int  `gorm:"not null" json:"history_size"`
+	RejectBreached bool `gorm:"not null" json:"reject_breached"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rules used for a library that has not configured its own
+func DefaultPasswordPolicy(libID uint) PasswordPolicy {
+	return PasswordPolicy{
+		LibID:          libID,
+		MinLength:      8,
+		HistorySize:    3,
+		RejectBreached: true,
+	}
+}
+
+// Rules the password breaks, in the order they are listed in the policy
+func (p PasswordPolicy) Violations(password string) []string {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var violations []string
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > MaxPasswordBytes {
+		violations = append(violations, fmt.Sprintf("Password must be at most %d bytes long", MaxPasswordBytes))
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "Password must contain a symbol")
+	}
+	return violations
+}
+
+// Hash of a password an account used before
+type PasswordHistory struct {
+	HistoryID    uint   `gorm:"primaryKey" json:"historyID"`
+	UserID       uint   `gorm:"not null;index" json:"userID"`
+	PasswordHash string `gorm:"not null" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// A one-time password reset token, stored only as its SHA-256 hash
+type PasswordReset struct {
+	ResetID   uint       `gorm:"primaryKey" json:"resetID"`
+	UserID    uint       `gorm:"not null;index" json:"userID"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -1,21 +1,69 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// Lifecycle of a request. Every request starts pending and is settled once,
+// after which it is kept as history
+const (
+	RequestPending   = "pending"
+	RequestApproved  = "approved"
+	RequestRejected  = "rejected"
+	RequestCancelled = "cancelled"
+	RequestExpired   = "expired"
+)
+
+var RequestStatuses = []string{RequestPending, RequestApproved, RequestRejected, RequestCancelled, RequestExpired}
+
+// Statuses each status may move to
+var requestTransitions = map[string][]string{
+	RequestPending: {RequestApproved, RequestRejected, RequestCancelled, RequestExpired},
+}
 
 type RequestEvents struct {
-	ReqID          uint      `gorm:"primaryKey"  json:"reqID"`
-	BookID         uint      `gorm:"not null" binding:"required" json:"bookID"`
-	ReaderID       uint      `gorm:"not null" binding:"required" json:"readerID"`
-	RequestDate    time.Time `gorm:"not null"`
-	ProcessingDate *time.Time
-	AdminID        *uint
-	LibID          uint   `gorm:"not null"`
-	RequestType    string `gorm:"default:'issue';check:request_type IN ('issue','return')"`
+	ReqID           uint      `gorm:"primaryKey"  json:"reqID"`
+	BookID          string    `gorm:"not null;size:13" binding:"required" json:"bookID"`
+	ReaderID        uint      `gorm:"not null" binding:"required" json:"readerID"`
+	RequestDate     time.Time `gorm:"not null"`
+	ProcessingDate  *time.Time
+	AdminID         *uint
+	LibID           uint   `gorm:"not null"`
+	RequestType     string `gorm:"default:'issue';check:request_type IN ('issue','return','renew')"`
+	Status          string `gorm:"not null;default:'pending';index;check:status IN ('pending','approved','rejected','cancelled','expired')" json:"status"`
+	RejectionReason string `json:"rejection_reason"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
-	Book     Books `gorm:"foreignKey:BookID,LibID;references:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	Reader   User  `gorm:"foreignKey:ReaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	Approver *User `gorm:"foreignKey:AdminID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Book        Books               `gorm:"foreignKey:BookID,LibID;references:ISBN,LibID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reader      User                `gorm:"foreignKey:ReaderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Approver    *User               `gorm:"foreignKey:AdminID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Transitions []RequestTransition `gorm:"foreignKey:ReqID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"transitions,omitempty"`
+}
+
+// Checks that the request may move to the given status
+func (r RequestEvents) CanTransition(to string) error {
+	for _, allowed := range requestTransitions[r.Status] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("request is already %s", r.Status)
+}
+
+// A status change of a request. The creation of the request is recorded with
+// no FromStatus, and changes made by the system, like expiries, with no actor
+type RequestTransition struct {
+	TransitionID uint   `gorm:"primaryKey" json:"transitionID"`
+	ReqID        uint   `gorm:"not null;index" json:"reqID"`
+	FromStatus   string `gorm:"not null;default:''" json:"from_status"`
+	ToStatus     string `gorm:"not null" json:"to_status"`
+	ActorID      *uint  `json:"actorID"`
+	Reason       string `json:"reason"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	Actor *User `gorm:"foreignKey:ActorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
 }
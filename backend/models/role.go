@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Role an owner defines for their library. It replaces the permissions of the
+// Admin or Reader accounts holding it, so it may narrow or widen what they can
+// do, short of what is kept for the owner; BaseRole says which of the two it is for
+type Role struct {
+	RoleID   uint   `gorm:"primaryKey" json:"roleID"`
+	LibID    uint   `gorm:"not null;uniqueIndex:idx_role_name" json:"lib_id"`
+	Name     string `gorm:"not null;uniqueIndex:idx_role_name" json:"name"`
+	BaseRole string `gorm:"not null;check:base_role IN ('Admin','Reader')" json:"base_role"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Grants []RolePermission `gorm:"foreignKey:RoleID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+type RolePermission struct {
+	RoleID     uint   `gorm:"primaryKey;autoIncrement:false" json:"roleID"`
+	Permission string `gorm:"primaryKey;size:64" json:"permission"`
+}
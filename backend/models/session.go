@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// A login and every refresh token rotated from it. Revoking the session
+// revokes the whole token family
+type Session struct {
+	SessionID uint       `gorm:"primaryKey" json:"sessionID"`
+	UserID    uint       `gorm:"not null;index" json:"userID"`
+	LibID     uint       `gorm:"not null" json:"lib_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// A refresh token is only stored as its SHA-256 hash and can be used once
+type RefreshToken struct {
+	TokenID   uint       `gorm:"primaryKey" json:"tokenID"`
+	SessionID uint       `gorm:"not null;index" json:"sessionID"`
+	TokenHash string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	Session Session `gorm:"foreignKey:SessionID;references:SessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Key the API signs access tokens with. A key is published from its creation,
+// signs from ActivatesAt until RetiresAt, and still verifies tokens until
+// ExpiresAt, so tokens signed just before a rotation stay valid
+type SigningKey struct {
+	KID         string    `gorm:"primaryKey;size:32" json:"kid"`
+	Algorithm   string    `gorm:"not null;check:algorithm IN ('EdDSA','RS256')" json:"alg"`
+	PrivateKey  []byte    `gorm:"not null" json:"-"`         // PKCS #8, DER encoded, then sealed
+	SealedBy    string    `gorm:"size:64;not null" json:"-"` // Key-encryption key the private key is sealed with
+	ActivatesAt time.Time `gorm:"not null" json:"activates_at"`
+	RetiresAt   time.Time `gorm:"not null" json:"retires_at"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// OpenID Connect identity provider a library lets its accounts log in with
+type SSOConfig struct {
+	LibID        uint   `gorm:"primaryKey;autoIncrement:false" json:"lib_id"`
+	Issuer       string `gorm:"not null" json:"issuer"`
+	ClientID     string `gorm:"not null" json:"client_id"`
+	ClientSecret string `gorm:"not null;default:''" json:"-"`
+	Enabled      bool   `gorm:"not null;default:false" json:"enabled"`
+	// Unknown identities get a Reader account of this type instead of a refusal
+	AutoProvision bool   `gorm:"not null;default:false" json:"auto_provision"`
+	ReaderType    string `gorm:"not null;default:''" json:"reader_type"`
+	// When set, only verified emails of this domain may be provisioned
+	EmailDomain string `gorm:"not null;default:''" json:"email_domain"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Account of an identity provider linked to a user, by the provider's
+// stable subject rather than an email that may change
+type UserIdentity struct {
+	IdentityID uint   `gorm:"primaryKey" json:"identityID"`
+	UserID     uint   `gorm:"not null;index" json:"user_id"`
+	Issuer     string `gorm:"not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject    string `gorm:"not null;uniqueIndex:idx_identity_subject" json:"subject"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Login started at the identity provider and not finished yet. The state
+// sent along is stored as its hash; the nonce and PKCE verifier are needed
+// again when the browser comes back
+type SSOLogin struct {
+	SSOLoginID   uint      `gorm:"primaryKey" json:"ssoLoginID"`
+	LibID        uint      `gorm:"not null" json:"lib_id"`
+	StateHash    string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Nonce        string    `gorm:"not null" json:"-"`
+	CodeVerifier string    `gorm:"not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
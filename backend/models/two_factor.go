@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// TOTP enrolment of a staff account. The secret is pending until the first
+// code from the authenticator app confirms it
+type TwoFactor struct {
+	UserID      uint   `gorm:"primaryKey;autoIncrement:false" json:"userID"`
+	Secret      string `gorm:"not null" json:"-"`
+	Enabled     bool   `gorm:"not null;default:false" json:"enabled"`
+	LastCounter int64  `gorm:"not null;default:0" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Single-use code for when the authenticator is lost, stored as its hash
+type RecoveryCode struct {
+	CodeID   uint       `gorm:"primaryKey" json:"codeID"`
+	UserID   uint       `gorm:"not null;index" json:"userID"`
+	CodeHash string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Login that passed the password check and waits for its second factor
+type MFAChallenge struct {
+	ChallengeID uint      `gorm:"primaryKey" json:"challengeID"`
+	UserID      uint      `gorm:"not null;index" json:"userID"`
+	TokenHash   string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
+	Attempts    int       `gorm:"not null;default:0" json:"attempts"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
@@ -10,7 +10,14 @@ type User struct {
 	Contact_number string `gorm:"not null" binding:"required" json:"contact_number"`
 	LibID          uint   `gorm:"not null" json:"lib_id"`
 	Role           string `gorm:"not null;check:role IN ('Owner','Admin','Reader')"`
+	ReaderType     string `gorm:"not null;default:''" json:"reader_type"`
+	// Custom role of the library, replacing the permissions of Role
+	RoleID *uint `gorm:"index" json:"role_id"`
+	// Set while the account is switched off; it can not log in or use a session
+	DeactivatedAt *time.Time `json:"deactivated_at"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	CustomRole *Role `gorm:"foreignKey:RoleID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
 }
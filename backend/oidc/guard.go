@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// Issuers are set by library owners, and anyone can sign up as one, so calls
+// to an issuer only go out over https to public addresses: an issuer URL can
+// not be used to reach the network the API runs in. Tests and local
+// development against an issuer on this machine switch the check off
+var AllowInsecure = false
+
+var ErrIssuerNotAllowed = errors.New("issuer must be an https URL on a public host")
+
+// Carrier-grade NAT space, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// Checks an issuer URL before it is saved. Host names are checked again for
+// every connection, once resolved, so they can not be pointed inside later
+func CheckIssuer(issuer string) error {
+	if AllowInsecure {
+		return nil
+	}
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return ErrIssuerNotAllowed
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !publicIP(ip) {
+		return ErrIssuerNotAllowed
+	}
+	if u.Hostname() == "localhost" {
+		return ErrIssuerNotAllowed
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// Refuses connections to addresses that are not public, whatever name or
+// redirect led there
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	if AllowInsecure {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return ErrIssuerNotAllowed
+	}
+	return nil
+}
+
+// Refuses plain http, including endpoints named by a discovery document and
+// redirects
+type httpsOnly struct {
+	base http.RoundTripper
+}
+
+func (t httpsOnly) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !AllowInsecure && req.URL.Scheme != "https" {
+		return nil, ErrIssuerNotAllowed
+	}
+	return t.base.RoundTrip(req)
+}
+
+func guardedTransport() http.RoundTripper {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: dialPublicOnly}
+	return httpsOnly{base: &http.Transport{
+		// NO PROXY, IT WOULD BE THE ADDRESS CHECKED INSTEAD OF THE ISSUER
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}}
+}
@@ -0,0 +1,131 @@
+// Package permissions names what an account may do and which permissions the
+// built-in roles carry. Custom roles of a library grant a chosen subset.
+package permissions
+
+import "sort"
+
+// Built-in roles
+const (
+	Owner  = "Owner"
+	Admin  = "Admin"
+	Reader = "Reader"
+)
+
+type Permission string
+
+const (
+	BooksRead       Permission = "books:read"
+	BooksWrite      Permission = "books:write"
+	BooksExport     Permission = "books:export"
+	RequestsCreate  Permission = "requests:create"
+	RequestsRead    Permission = "requests:read"
+	RequestsApprove Permission = "requests:approve"
+	HoldsRead       Permission = "holds:read"
+	HoldsOwn        Permission = "holds:own"
+	FinesRead       Permission = "fines:read"
+	FinesManage     Permission = "fines:manage"
+	FinesOwn        Permission = "fines:own"
+	UsersCreate     Permission = "users:create"
+	UsersManage     Permission = "users:manage"
+	PoliciesManage  Permission = "policies:manage"
+
+	// Kept by the owner, never granted through a custom role
+	StaffManage    Permission = "staff:manage"
+	RolesManage    Permission = "roles:manage"
+	SettingsManage Permission = "library:settings"
+	APIKeysManage  Permission = "api-keys:manage"
+	AuditRead      Permission = "audit:read"
+)
+
+var all = []Permission{
+	BooksRead, BooksWrite, BooksExport,
+	RequestsCreate, RequestsRead, RequestsApprove,
+	HoldsRead, HoldsOwn,
+	FinesRead, FinesManage, FinesOwn,
+	UsersCreate, UsersManage,
+	PoliciesManage,
+	StaffManage, RolesManage, SettingsManage, APIKeysManage, AuditRead,
+}
+
+var ownerOnly = NewSet(StaffManage, RolesManage, SettingsManage, APIKeysManage, AuditRead)
+
+var builtIn = map[string]Set{
+	Owner: NewSet(all...),
+	Admin: NewSet(
+		BooksRead, BooksWrite, BooksExport,
+		RequestsRead, RequestsApprove,
+		HoldsRead,
+		FinesRead, FinesManage,
+		UsersCreate, UsersManage,
+	),
+	Reader: NewSet(BooksRead, RequestsCreate, HoldsOwn, FinesOwn),
+}
+
+type Set map[Permission]bool
+
+func NewSet(perms ...Permission) Set {
+	set := Set{}
+	for _, p := range perms {
+		set[p] = true
+	}
+	return set
+}
+
+func (s Set) Has(p Permission) bool {
+	return s[p]
+}
+
+// Permissions held by both sets
+func (s Set) Intersect(other Set) Set {
+	set := Set{}
+	for p := range s {
+		if other.Has(p) {
+			set[p] = true
+		}
+	}
+	return set
+}
+
+// Whether the set holds any permission the other does not
+func (s Set) Exceeds(other Set) bool {
+	for p := range s {
+		if !other.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions in a stable order, for responses
+func (s Set) List() []Permission {
+	list := make([]Permission, 0, len(s))
+	for p := range s {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// Every permission there is
+func All() []Permission {
+	return append([]Permission(nil), all...)
+}
+
+func Valid(p Permission) bool {
+	return builtIn[Owner].Has(p)
+}
+
+// Whether an owner may hand the permission to a custom role
+func Delegable(p Permission) bool {
+	return Valid(p) && !ownerOnly.Has(p)
+}
+
+// Permissions of a built-in role; empty for anything else
+func ForRole(role string) Set {
+	return builtIn[role]
+}
+
+func IsBuiltIn(role string) bool {
+	_, ok := builtIn[role]
+	return ok
+}
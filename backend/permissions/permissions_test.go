@@ -0,0 +1,36 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltInRoles(t *testing.T) {
+	for _, p := range All() {
+		assert.True(t, ForRole(Owner).Has(p), p)
+	}
+
+	assert.True(t, ForRole(Admin).Has(BooksWrite))
+	assert.False(t, ForRole(Admin).Has(StaffManage))
+	assert.False(t, ForRole(Admin).Has(RequestsCreate))
+
+	assert.True(t, ForRole(Reader).Has(RequestsCreate))
+	assert.False(t, ForRole(Reader).Has(BooksWrite))
+
+	assert.False(t, ForRole("Cataloguer").Has(BooksRead))
+	assert.False(t, IsBuiltIn("Cataloguer"))
+}
+
+func TestDelegable(t *testing.T) {
+	assert.True(t, Delegable(BooksWrite))
+	assert.False(t, Delegable(RolesManage))
+	assert.False(t, Delegable("books:burn"))
+	assert.False(t, Valid("books:burn"))
+}
+
+func TestSetList(t *testing.T) {
+	set := NewSet(UsersCreate, BooksWrite, BooksRead)
+	assert.Equal(t, []Permission{BooksRead, BooksWrite, UsersCreate}, set.List())
+	assert.Equal(t, []Permission{BooksRead}, set.Intersect(NewSet(BooksRead, FinesRead)).List())
+}
@@ -2,11 +2,16 @@ package routes
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prabhatKr-1/lib-man-sys/backend/mailer"
 	"github.com/prabhatKr-1/lib-man-sys/backend/testutils"
 	"github.com/stretchr/testify/assert"
 )
@@ -45,3 +50,255 @@ func TestAuthRoutes(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+// COOKIES OF A RESPONSE, TO SEND WITH THE NEXT REQUESTS
+func authCookies(w *httptest.ResponseRecorder) []*http.Cookie {
+	var cookies []*http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			cookies = append(cookies, cookie)
+		}
+	}
+	return cookies
+}
+
+func send(router *gin.Engine, method, url, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func signupAndLogin(t *testing.T, router *gin.Engine) []*http.Cookie {
+	w := send(router, "POST", "/v1/auth/signup", `{"name":"Owner","email":"owner@example.com","password":"ownerpassword","contactNumber":"1","libraryName":"Test Library"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(router, "POST", "/v1/auth/login", `{"email":"owner@example.com","password":"ownerpassword"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return authCookies(w)
+}
+
+// INVITES AN ACCOUNT, ACCEPTS THE MAILED INVITATION AND LOGS IN WITH IT
+func inviteAndLogin(t *testing.T, router *gin.Engine, path, email, password string, cookies []*http.Cookie) []*http.Cookie {
+	outbox := &mailer.Memory{}
+	previous := mailer.Default
+	mailer.Default = outbox
+	defer func() { mailer.Default = previous }()
+
+	w := send(router, "POST", path, `{"name":"Invitee","email":"`+email+`","contactNumber":"2"}`, cookies)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := outbox.Messages()[0].Body
+	start := strings.Index(body, "http")
+	link, _ := url.Parse(strings.Fields(body[start:])[0])
+
+	w = send(router, "POST", "/v1/auth/invitations/accept", `{"token":"`+link.Query().Get("token")+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(router, "POST", "/v1/auth/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return authCookies(w)
+}
+
+func TestLogout_RevokesAccessToken(t *testing.T) {
+	router := setupTestRouter()
+	cookies := signupAndLogin(t, router)
+
+	w := send(router, "GET", "/v1/owner/policies", "", cookies)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(router, "GET", "/v1/owner/logout", "", cookies)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// THE ACCESS TOKEN HAS NOT EXPIRED BUT ITS SESSION HAS ENDED
+	w = send(router, "GET", "/v1/owner/policies", "", cookies)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session revoked")
+}
+
+func TestUpdatePassword_RevokesOtherSessions(t *testing.T) {
+	router := setupTestRouter()
+	other := signupAndLogin(t, router)
+	w := send(router, "POST", "/v1/auth/login", `{"email":"owner@example.com","password":"ownerpassword"}`, nil)
+	current := authCookies(w)
+
+	w = send(router, "POST", "/v1/owner/password", `{"OldPassword":"ownerpassword","NewPassword":"newpassword"}`, current)
+	assert.Equal(t, http.StatusOK, w.Code)
+	renewed := authCookies(w)
+
+	w = send(router, "GET", "/v1/owner/policies", "", other)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// THE DEVICE THAT CHANGED THE PASSWORD STAYS LOGGED IN
+	w = send(router, "GET", "/v1/owner/policies", "", renewed)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	router := setupTestRouter()
+	owner := signupAndLogin(t, router)
+
+	reader := inviteAndLogin(t, router, "/v1/admin/create-reader", "reader@example.com", "readerpassword", owner)
+
+	w := send(router, "GET", "/v1/reader/holds", "", reader)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(router, "DELETE", "/v1/admin/users/2/sessions", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(router, "GET", "/v1/reader/holds", "", reader)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = send(router, "POST", "/v1/auth/refresh", "", reader)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = send(router, "DELETE", "/v1/admin/users/99/sessions", "", owner)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCustomRoles(t *testing.T) {
+	router := setupTestRouter()
+	owner := signupAndLogin(t, router)
+
+	admin := inviteAndLogin(t, router, "/v1/owner/create-admin", "admin@example.com", "adminpassword", owner)
+
+	w := send(router, "GET", "/v1/admin/requests/all", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(router, "POST", "/v1/owner/roles", `{"name":"Cataloguer","base_role":"Admin","permissions":["books:read","books:write"]}`, owner)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = send(router, "PUT", "/v1/owner/users/2/custom-role", `{"role_id":1}`, owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// THE NEW PERMISSIONS APPLY TO THE SESSION ALREADY OPEN
+	w = send(router, "GET", "/v1/admin/requests/all", "", admin)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "requests:read")
+	w = send(router, "GET", "/v1/admin/books/search", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// ROLES ARE MANAGED BY THE OWNER ONLY
+	w = send(router, "POST", "/v1/owner/roles", `{"name":"Other","base_role":"Admin","permissions":[]}`, admin)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = send(router, "DELETE", "/v1/owner/roles/1", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(router, "GET", "/v1/admin/requests/all", "", admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBearerClients(t *testing.T) {
+	router := setupTestRouter()
+	owner := signupAndLogin(t, router)
+
+	req, _ := http.NewRequest("POST", "/v1/auth/login", bytes.NewBufferString(`{"email":"owner@example.com","password":"ownerpassword"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Mode", "bearer")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	var tokens map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+
+	bearer := func(method, url, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, bearer("GET", "/v1/owner/roles", tokens["access_token"].(string)).Code)
+
+	// AN API KEY REACHES ITS SCOPES ONLY, AND NEVER THE ACCOUNT ITSELF
+	w = send(router, "POST", "/v1/owner/api-keys", `{"name":"Kiosk","scopes":["books:read"]}`, owner)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	key := created["key"].(string)
+
+	assert.Equal(t, http.StatusOK, bearer("GET", "/v1/admin/books/search", key).Code)
+	assert.Equal(t, http.StatusForbidden, bearer("GET", "/v1/admin/requests/all", key).Code)
+	assert.Equal(t, http.StatusForbidden, bearer("GET", "/v1/owner/api-keys", key).Code)
+	assert.Equal(t, http.StatusForbidden, bearer("GET", "/v1/owner/logout", key).Code)
+
+	w = send(router, "DELETE", "/v1/owner/api-keys/1", "", owner)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, bearer("GET", "/v1/admin/books/search", key).Code)
+}
+
+func TestJWKS(t *testing.T) {
+	router := setupTestRouter()
+	cookies := signupAndLogin(t, router)
+
+	var access string
+	for _, cookie := range cookies {
+		if cookie.Name == "token" {
+			access = cookie.Value
+		}
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(access, jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	w := send(router, "GET", "/.well-known/jwks.json", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Cache-Control"))
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+
+	// THE KEY THE TOKEN NAMES IS PUBLISHED, WITHOUT ITS PRIVATE HALF
+	var found map[string]string
+	for _, key := range set.Keys {
+		if key["kid"] == token.Header["kid"] {
+			found = key
+		}
+	}
+	assert.NotNil(t, found)
+	assert.Equal(t, token.Method.Alg(), found["alg"])
+	assert.Empty(t, found["d"])
+}
+
+func TestCustomRoles_WidenAcrossRouteGroups(t *testing.T) {
+	router := setupTestRouter()
+	owner := signupAndLogin(t, router)
+	admin := inviteAndLogin(t, router, "/v1/owner/create-admin", "admin@example.com", "adminpassword", owner)
+	reader := inviteAndLogin(t, router, "/v1/admin/create-reader", "reader@example.com", "readerpassword", owner)
+
+	assert.Equal(t, http.StatusForbidden, send(router, "GET", "/v1/owner/policies", "", admin).Code)
+	assert.Equal(t, http.StatusForbidden, send(router, "GET", "/v1/admin/requests/all", "", reader).Code)
+
+	// A DELEGATED PERMISSION REACHES ITS ROUTE WHATEVER THE PREFIX
+	w := send(router, "POST", "/v1/owner/roles", `{"name":"Circulation lead","base_role":"Admin","permissions":["policies:manage","requests:read"]}`, owner)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = send(router, "POST", "/v1/owner/roles", `{"name":"Student helper","base_role":"Reader","permissions":["books:read","requests:read"]}`, owner)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, send(router, "PUT", "/v1/owner/users/2/custom-role", `{"role_id":1}`, owner).Code)
+	assert.Equal(t, http.StatusOK, send(router, "PUT", "/v1/owner/users/3/custom-role", `{"role_id":2}`, owner).Code)
+
+	assert.Equal(t, http.StatusOK, send(router, "GET", "/v1/owner/policies", "", admin).Code)
+	assert.Equal(t, http.StatusOK, send(router, "GET", "/v1/admin/requests/all", "", reader).Code)
+
+	// WHAT IS KEPT FOR THE OWNER STAYS WITH THE OWNER
+	assert.Equal(t, http.StatusForbidden, send(router, "GET", "/v1/owner/roles", "", admin).Code)
+	assert.Equal(t, http.StatusForbidden, send(router, "GET", "/v1/admin/books/search", "", admin).Code)
+}
+
+func TestAPIKeys_CanNotUseSelfServiceRoutes(t *testing.T) {
+	router := setupTestRouter()
+	owner := signupAndLogin(t, router)
+
+	w := send(router, "POST", "/v1/owner/api-keys", `{"name":"Kiosk","scopes":["books:read"]}`, owner)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	for _, path := range []string{"/v1/reader/password", "/v1/admin/password", "/v1/owner/password"} {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(`{"OldPassword":"x","NewPassword":"y"}`))
+		req.Header.Set("Authorization", "Bearer "+created["key"].(string))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+	}
+}
@@ -50,41 +50,120 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prabhatKr-1/lib-man-sys/backend/controllers"
 	"github.com/prabhatKr-1/lib-man-sys/backend/middleware"
-	"github.com/prabhatKr-1/lib-man-sys/backend/utils"
+	"github.com/prabhatKr-1/lib-man-sys/backend/permissions"
 )
 
+// Shorthand for the permission guard of a route
+var can = middleware.RequirePermission
+
+// Guard of routes acting on the logged-in person's own account, which API keys may not use
+var sessionOnly = middleware.SessionOnly
+
 func SetupRoutes(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
+
 	auth := r.Group("v1/auth/")
 	{
 		auth.POST("/signup", controllers.Signup)
 		auth.POST("/login", controllers.Login)
+		auth.POST("/login/2fa", controllers.LoginTwoFactor)
+		auth.POST("/login/2fa/enroll", controllers.EnrollTwoFactorAtLogin)
+		auth.POST("/refresh", controllers.Refresh)
+		auth.POST("/forgot-password", controllers.ForgotPassword)
+		auth.POST("/reset-password", controllers.ResetPassword)
+		auth.POST("/invitations/accept", controllers.AcceptInvitation)
+		auth.GET("/sso/:libid/login", controllers.StartSSOLogin)
+		auth.GET("/sso/callback", controllers.FinishSSOLogin)
 	}
 
-	owner := r.Group("v1/owner/").Use(middleware.AuthMiddleware(utils.ValidateJWT, "Owner"))
+	// EVERY ROUTE BELOW NEEDS A LOGIN OR AN API KEY. WHAT IT ALLOWS IS DECIDED BY
+	// THE PERMISSION THE ROUTE ASKS FOR, NOT BY THE KIND OF ACCOUNT, SO A CUSTOM
+	// ROLE REACHES EVERY ROUTE ITS PERMISSIONS COVER; THE PREFIXES ONLY GROUP THEM
+	authenticated := r.Group("v1/", middleware.AuthMiddleware(middleware.ValidateSession))
+
+	owner := authenticated.Group("owner/")
 	{
-		owner.POST("/password", controllers.UpdatePassword)
-		owner.POST("/create-admin", controllers.CreateAdminUser)
-		owner.GET("/logout", controllers.Logout)
+		owner.POST("/password", sessionOnly, controllers.UpdatePassword)
+		owner.POST("/2fa/enroll", sessionOnly, controllers.EnrollTwoFactor)
+		owner.POST("/2fa/verify", sessionOnly, controllers.ConfirmTwoFactor)
+		owner.POST("/2fa/disable", sessionOnly, controllers.DisableTwoFactor)
+		owner.POST("/2fa/recovery-codes", sessionOnly, controllers.RegenerateRecoveryCodes)
+		owner.PATCH("/security", can(permissions.SettingsManage), controllers.SetTwoFactorRequirement)
+		owner.GET("/password-policy", can(permissions.SettingsManage), controllers.GetPasswordPolicy)
+		owner.PATCH("/password-policy", can(permissions.SettingsManage), controllers.UpdatePasswordPolicy)
+		owner.GET("/sso", can(permissions.SettingsManage), controllers.GetSSOConfig)
+		owner.PUT("/sso", can(permissions.SettingsManage), controllers.UpdateSSOConfig)
+		owner.POST("/create-admin", can(permissions.StaffManage), controllers.CreateAdminUser)
+		owner.GET("/roles", can(permissions.RolesManage), controllers.ListRoles)
+		owner.POST("/roles", can(permissions.RolesManage), controllers.CreateRole)
+		owner.PATCH("/roles/:id", can(permissions.RolesManage), controllers.UpdateRole)
+		owner.DELETE("/roles/:id", can(permissions.RolesManage), controllers.DeleteRole)
+		owner.PATCH("/users/:id/role", can(permissions.StaffManage), controllers.ChangeUserRole)
+		owner.PUT("/users/:id/custom-role", can(permissions.RolesManage), controllers.AssignRole)
+		owner.GET("/api-keys", can(permissions.APIKeysManage), controllers.ListAPIKeys)
+		owner.POST("/api-keys", can(permissions.APIKeysManage), controllers.CreateAPIKey)
+		owner.DELETE("/api-keys/:id", can(permissions.APIKeysManage), controllers.RevokeAPIKey)
+		owner.GET("/audit", can(permissions.AuditRead), controllers.ListAuditLog)
+		owner.GET("/audit/export", can(permissions.AuditRead), controllers.ExportAuditLog)
+		owner.GET("/policies", can(permissions.PoliciesManage), controllers.ListPolicies)
+		owner.POST("/policies", can(permissions.PoliciesManage), controllers.CreatePolicy)
+		owner.PATCH("/policies/:id", can(permissions.PoliciesManage), controllers.UpdatePolicy)
+		owner.DELETE("/policies/:id", can(permissions.PoliciesManage), controllers.DeletePolicy)
+		owner.GET("/logout", sessionOnly, controllers.Logout)
 	}
 
-	admin := r.Group("v1/admin/").Use(middleware.AuthMiddleware(utils.ValidateJWT, "Admin", "Owner"))
+	admin := authenticated.Group("admin/")
 	{
-		admin.POST("/password", controllers.UpdatePassword)
-		admin.POST("/create-reader", controllers.CreateReaderUser)
-		admin.GET("/books/search", controllers.SearchBook)
-		admin.POST("/books/add", controllers.AddBook)
-		admin.PATCH("/books/:isbn", controllers.UpdateBook)
-		admin.DELETE("/books/:isbn", controllers.DeleteBook)
-		admin.GET("/requests/all", controllers.ListRequests)
-		admin.POST("/requests/process", controllers.ProcessRequest)
-		admin.GET("/logout", controllers.Logout)
+		admin.POST("/password", sessionOnly, controllers.UpdatePassword)
+		admin.POST("/2fa/enroll", sessionOnly, controllers.EnrollTwoFactor)
+		admin.POST("/2fa/verify", sessionOnly, controllers.ConfirmTwoFactor)
+		admin.POST("/2fa/disable", sessionOnly, controllers.DisableTwoFactor)
+		admin.POST("/2fa/recovery-codes", sessionOnly, controllers.RegenerateRecoveryCodes)
+		admin.POST("/create-reader", can(permissions.UsersCreate), controllers.CreateReaderUser)
+		admin.GET("/invitations", can(permissions.UsersCreate), controllers.ListInvitations)
+		admin.POST("/invitations/:id/resend", can(permissions.UsersCreate), controllers.ResendInvitation)
+		admin.DELETE("/invitations/:id", can(permissions.UsersCreate), controllers.RevokeInvitation)
+		admin.GET("/users", can(permissions.UsersManage), controllers.ListUsers)
+		admin.GET("/users/:id", can(permissions.UsersManage), controllers.GetUser)
+		admin.PATCH("/users/:id", can(permissions.UsersManage), controllers.UpdateUser)
+		admin.POST("/users/:id/deactivate", can(permissions.UsersManage), controllers.DeactivateUser)
+		admin.POST("/users/:id/reactivate", can(permissions.UsersManage), controllers.ReactivateUser)
+		admin.DELETE("/users/:id/sessions", can(permissions.UsersManage), controllers.RevokeUserSessions)
+		admin.GET("/lockouts", can(permissions.UsersManage), controllers.ListLockouts)
+		admin.DELETE("/users/:id/lockout", can(permissions.UsersManage), controllers.ClearLockout)
+		admin.GET("/books/search", can(permissions.BooksRead), controllers.SearchBook)
+		admin.GET("/books/facets", can(permissions.BooksRead), controllers.BookFacets)
+		admin.POST("/books/add", can(permissions.BooksWrite), controllers.AddBook)
+		admin.POST("/books/import", can(permissions.BooksWrite), controllers.ImportBooks)
+		admin.POST("/books/import/marc", can(permissions.BooksWrite), controllers.ImportBooksMARC)
+		admin.GET("/books/export", can(permissions.BooksExport), controllers.ExportBooksMARC)
+		admin.PATCH("/books/:isbn", can(permissions.BooksWrite), controllers.UpdateBook)
+		admin.DELETE("/books/:isbn", can(permissions.BooksWrite), controllers.DeleteBook)
+		admin.GET("/books/:isbn/items", can(permissions.BooksRead), controllers.ListItems)
+		admin.POST("/books/:isbn/items", can(permissions.BooksWrite), controllers.AddItem)
+		admin.PATCH("/items/:id", can(permissions.BooksWrite), controllers.UpdateItem)
+		admin.GET("/requests/all", can(permissions.RequestsRead), controllers.ListRequests)
+		admin.GET("/requests/:id", can(permissions.RequestsRead), controllers.GetRequest)
+		admin.POST("/requests/process", can(permissions.RequestsApprove), controllers.ProcessRequest)
+		admin.GET("/holds", can(permissions.HoldsRead), controllers.ListHolds)
+		admin.GET("/fines/:readerId", can(permissions.FinesRead), controllers.ListReaderFines)
+		admin.POST("/fines/payments", can(permissions.FinesManage), controllers.RecordFinePayment)
+		admin.POST("/fines/waivers", can(permissions.FinesManage), controllers.WaiveFine)
+		admin.GET("/logout", sessionOnly, controllers.Logout)
 	}
 
-	reader := r.Group("v1/reader/").Use(middleware.AuthMiddleware(utils.ValidateJWT, "Reader"))
+	reader := authenticated.Group("reader/")
 	{
-		reader.POST("/password", controllers.UpdatePassword)
-		reader.GET("/books/search", controllers.SearchBook)
-		reader.POST("/books/requests", controllers.RaiseBookRequest)
-		reader.GET("/logout", controllers.Logout)
+		reader.POST("/password", sessionOnly, controllers.UpdatePassword)
+		reader.GET("/books/search", can(permissions.BooksRead), controllers.SearchBook)
+		reader.GET("/books/facets", can(permissions.BooksRead), controllers.BookFacets)
+		reader.POST("/books/requests", can(permissions.RequestsCreate), controllers.RaiseBookRequest)
+		reader.GET("/requests", can(permissions.RequestsCreate), controllers.ListMyRequests)
+		reader.GET("/requests/:id", can(permissions.RequestsCreate), controllers.GetMyRequest)
+		reader.DELETE("/requests/:id", can(permissions.RequestsCreate), controllers.CancelRequest)
+		reader.GET("/holds", can(permissions.HoldsOwn), controllers.ListMyHolds)
+		reader.DELETE("/holds/:id", can(permissions.HoldsOwn), controllers.CancelHold)
+		reader.GET("/fines", can(permissions.FinesOwn), controllers.ListMyFines)
+		reader.GET("/logout", sessionOnly, controllers.Logout)
 	}
 }
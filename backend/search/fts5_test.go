@@ -0,0 +1,17 @@
+//go:build sqlite_fts5
+
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The other tests cover FTS4 by default and FTS5 when built with this tag:
+//
+//	go test -tags sqlite_fts5 ./...
+func TestSQLiteUsesFTS5(t *testing.T) {
+	db := setupIndex(t)
+	assert.True(t, isFTS5(db))
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Title ranks above authors, authors above publisher and description. The
+// simple configuration keeps names and non-English titles unstemmed
+const postgresVector = `setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(authors, '')), 'B') ||
+	setweight(to_tsvector('simple', coalesce(publisher, '')), 'C') ||
+	setweight(to_tsvector('simple', coalesce(description, '')), 'D')`
+
+const postgresHighlight = `StartSel="` + startMatch + `", StopSel="` + stopMatch + `"`
+
+// books_vocab counts the books of a library each indexed word appears in. A
+// trigger on books keeps it current, so typo correction reads a small table
+// instead of running ts_stat over the whole catalogue on every search
+var postgresVocabulary = []string{
+	`CREATE OR REPLACE FUNCTION books_vocab_sync() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			UPDATE books_vocab SET book_count = book_count - 1
+				WHERE lib_id = OLD.lib_id AND word = ANY (tsvector_to_array(OLD.search_vector));
+			DELETE FROM books_vocab WHERE lib_id = OLD.lib_id AND book_count <= 0;
+		END IF;
+		IF TG_OP <> 'DELETE' THEN
+			INSERT INTO books_vocab (lib_id, word, book_count)
+				SELECT NEW.lib_id, word, 1 FROM unnest(tsvector_to_array(NEW.search_vector)) AS word
+				ON CONFLICT (lib_id, word) DO UPDATE SET book_count = books_vocab.book_count + 1;
+		END IF;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	"DROP TRIGGER IF EXISTS books_vocab_sync ON books",
+	"CREATE TRIGGER books_vocab_sync AFTER INSERT OR DELETE OR UPDATE OF lib_id, title, authors, publisher, description " +
+		"ON books FOR EACH ROW EXECUTE FUNCTION books_vocab_sync()",
+}
+
+type postgresEngine struct{}
+
+func (postgresEngine) Migrate(db *gorm.DB) error {
+	if err := db.Exec("ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (" + postgresVector + ") STORED").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector)").Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		backfill := !tx.Migrator().HasTable("books_vocab")
+		if err := tx.Exec("CREATE TABLE IF NOT EXISTS books_vocab (lib_id bigint NOT NULL, word text NOT NULL, " +
+			"book_count integer NOT NULL, PRIMARY KEY (lib_id, word))").Error; err != nil {
+			return err
+		}
+		// KEEPS WRITES OUT UNTIL THE TRIGGER COUNTS THEM
+		if err := tx.Exec("LOCK TABLE books IN SHARE MODE").Error; err != nil {
+			return err
+		}
+		for _, statement := range postgresVocabulary {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		if !backfill {
+			return nil
+		}
+		// BOOKS THAT EXISTED BEFORE THE VOCABULARY
+		return tx.Exec("INSERT INTO books_vocab (lib_id, word, book_count) " +
+			"SELECT lib_id, word, count(*) FROM books, unnest(tsvector_to_array(search_vector)) AS word GROUP BY lib_id, word").Error
+	})
+}
+
+func (postgresEngine) Vocabulary(db *gorm.DB, libID uint) ([]string, error) {
+	var words []string
+	err := db.Raw("SELECT word FROM books_vocab WHERE lib_id = ?", libID).Scan(&words).Error
+	return words, err
+}
+
+// Terms joined as "(go:* | og:*) & programming:*"
+func tsquery(q Query) string {
+	groups := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		alternatives := make([]string, 0, len(term))
+		for _, word := range term {
+			alternatives = append(alternatives, word+":*")
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " | ")+")")
+	}
+	return strings.Join(groups, " & ")
+}
+
+func (postgresEngine) Match(query *gorm.DB, q Query) *gorm.DB {
+	return query.Where("books.search_vector @@ to_tsquery('simple', ?)", tsquery(q))
+}
+
+func (postgresEngine) Rank(q Query) clause.Expression {
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                "ts_rank(books.search_vector, to_tsquery('simple', ?)) DESC",
+		Vars:               []interface{}{tsquery(q)},
+		WithoutParentheses: true,
+	}}
+}
+
+func (postgresEngine) Highlight(db *gorm.DB, libID uint, isbns []string, q Query) (map[string]Highlight, error) {
+	var rows []struct {
+		ISBN string
+		Highlight
+	}
+	err := db.Raw(`
+		SELECT isbn,
+			ts_headline('simple', title, query, ?) AS title,
+			ts_headline('simple', authors, query, ?) AS authors,
+			ts_headline('simple', coalesce(nullif(description, ''), publisher), query, ?) AS snippet
+		FROM books, to_tsquery('simple', ?) query
+		WHERE lib_id = ? AND isbn IN ?`,
+		postgresHighlight+", HighlightAll=true", postgresHighlight+", HighlightAll=true",
+		postgresHighlight+", MaxWords=20, MinWords=8", tsquery(q), libID, isbns).Scan(&rows).Error
+
+	highlights := make(map[string]Highlight, len(rows))
+	for _, row := range rows {
+		highlights[row.ISBN] = row.Highlight.marked()
+	}
+	return highlights, err
+}
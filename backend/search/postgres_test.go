@@ -0,0 +1,95 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Index in a throwaway schema of the Postgres database named by
+// SEARCH_TEST_DATABASE_URL; the tests are skipped without one
+func setupPostgresIndex(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("SEARCH_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("SEARCH_TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// ONE CONNECTION, SO EVERY STATEMENT SEES THE SEARCH PATH
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get database handle: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("search_test_%d", time.Now().UnixNano())
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		sqlDB.Close()
+	})
+	db.Exec("SET search_path TO " + schema)
+
+	if err := db.AutoMigrate(&models.Books{}, &models.BookItem{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	// A BOOK FROM BEFORE THE VOCABULARY EXISTED IS BACKFILLED
+	db.Create(&models.Books{ISBN: "9780306406157", LibID: 1, Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st"})
+	if err := For(db).Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate search index: %v", err)
+	}
+	if err := For(db).Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate search index again: %v", err)
+	}
+
+	db.Create(&models.Books{ISBN: "9781617294549", LibID: 1, Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", Description: "Systems programming explained through Rust"})
+	db.Create(&models.Books{ISBN: "9781718500853", LibID: 2, Title: "Haskell Programming", Authors: "Chris Allen", Publisher: "Lorepub", Version: "1st"})
+	return db
+}
+
+func bookCount(db *gorm.DB, libID uint, word string) int {
+	var count int
+	db.Raw("SELECT coalesce(sum(book_count), 0) FROM books_vocab WHERE lib_id = ? AND word = ?", libID, word).Scan(&count)
+	return count
+}
+
+func TestPostgresVocabulary_KeptPerLibrary(t *testing.T) {
+	db := setupPostgresIndex(t)
+
+	words, err := For(db).Vocabulary(db, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, words, "go")
+	assert.Contains(t, words, "rust")
+	assert.NotContains(t, words, "haskell")
+	assert.Equal(t, 2, bookCount(db, 1, "programming"))
+	assert.Equal(t, 1, bookCount(db, 2, "programming"))
+	assert.Equal(t, []string{"9781617294549"}, matching(t, db, "Rsut"))
+
+	// A WORD STAYS UNTIL THE LAST BOOK WITH IT GOES
+	db.Where("isbn = ?", "9780306406157").Delete(&models.Books{})
+	assert.Equal(t, 0, bookCount(db, 1, "go"))
+	assert.Equal(t, 1, bookCount(db, 1, "programming"))
+
+	// EDITED TEXT TRADES ITS OLD WORDS FOR THE NEW ONES
+	db.Model(&models.Books{}).Where("isbn = ?", "9781617294549").Update("title", "Rust Atomics")
+	assert.Equal(t, 0, bookCount(db, 1, "action"))
+	assert.Equal(t, 1, bookCount(db, 1, "atomics"))
+
+	// A BOOK MOVED TO ANOTHER LIBRARY TAKES ITS WORDS WITH IT
+	db.Model(&models.Books{}).Where("isbn = ?", "9781617294549").Update("lib_id", 2)
+	words, err = For(db).Vocabulary(db, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, words)
+	assert.Equal(t, 2, bookCount(db, 2, "programming"))
+	assert.Equal(t, 1, bookCount(db, 2, "rust"))
+}
@@ -0,0 +1,180 @@
+// Package search provides full-text search over the book catalogue, backed by
+// a tsvector column on Postgres and an FTS table on SQLite.
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Typo alternatives tried for a term that matches nothing in the index
+const maxAlternatives = 5
+
+// A parsed search. Every term must match; a term matches when the indexed
+// text has a word starting with it or with one of its typo alternatives
+type Query struct {
+	Terms [][]string
+}
+
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0
+}
+
+// Highlighted fields of a hit. The text is HTML-escaped and only the
+// matches are wrapped in <mark></mark>, so it can be shown as markup
+type Highlight struct {
+	Title   string `json:"title"`
+	Authors string `json:"authors"`
+	Snippet string `json:"snippet"`
+}
+
+// Control characters the engines put around matches in place of tags, so the
+// book's own text can be escaped before the tags are added
+const (
+	startMatch = "\x01"
+	stopMatch  = "\x02"
+)
+
+var matchTags = strings.NewReplacer(startMatch, "<mark>", stopMatch, "</mark>")
+
+func markMatches(text string) string {
+	return matchTags.Replace(html.EscapeString(text))
+}
+
+func (h Highlight) marked() Highlight {
+	return Highlight{Title: markMatches(h.Title), Authors: markMatches(h.Authors), Snippet: markMatches(h.Snippet)}
+}
+
+type Engine interface {
+	// Creates the index and whatever keeps it in sync with the books table
+	Migrate(db *gorm.DB) error
+	// Distinct indexed words, used to correct typos
+	Vocabulary(db *gorm.DB, libID uint) ([]string, error)
+	// Restricts a query on the books table to matching rows
+	Match(query *gorm.DB, q Query) *gorm.DB
+	// Ordering that puts the most relevant books first
+	Rank(q Query) clause.Expression
+	Highlight(db *gorm.DB, libID uint, isbns []string, q Query) (map[string]Highlight, error)
+}
+
+// Engine for the dialect of the connection
+func For(db *gorm.DB) Engine {
+	if db.Dialector.Name() == "postgres" {
+		return postgresEngine{}
+	}
+	return sqliteEngine{}
+}
+
+// Splits free text into lower case words of letters and digits
+func Parse(text string) Query {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var q Query
+	for _, word := range words {
+		q.Terms = append(q.Terms, []string{word})
+	}
+	return q
+}
+
+// Parses the text and gives every term that is not the prefix of an indexed
+// word the closest indexed words as alternatives
+func Prepare(db *gorm.DB, libID uint, text string) (Query, error) {
+	q := Parse(text)
+	if q.Empty() {
+		return q, nil
+	}
+
+	vocabulary, err := For(db).Vocabulary(db, libID)
+	if err != nil {
+		return q, err
+	}
+	for i, term := range q.Terms {
+		q.Terms[i] = append(term, corrections(term[0], vocabulary)...)
+	}
+	return q, nil
+}
+
+// Words within typo distance of the term, closest first. Nothing is returned
+// when the term already prefixes a word, or is too short to correct safely
+func corrections(term string, vocabulary []string) []string {
+	maxDistance := 0
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		maxDistance = 2
+	case n >= 4:
+		maxDistance = 1
+	}
+	if maxDistance == 0 {
+		return nil
+	}
+
+	type candidate struct {
+		word     string
+		distance int
+	}
+	var candidates []candidate
+	termRunes := []rune(term)
+	for _, word := range vocabulary {
+		if strings.HasPrefix(word, term) {
+			return nil
+		}
+		wordRunes := []rune(word)
+		distance := editDistance(termRunes, wordRunes)
+		// A TYPO IN THE PREFIX OF A LONGER WORD
+		if len(wordRunes) > len(termRunes) {
+			if d := editDistance(termRunes, wordRunes[:len(termRunes)]); d < distance {
+				distance = d
+			}
+		}
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{word, distance})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].word < candidates[j].word
+	})
+	var words []string
+	for _, c := range candidates {
+		if len(words) == maxAlternatives {
+			break
+		}
+		words = append(words, c.word)
+	}
+	return words
+}
+
+// Optimal string alignment distance: insertions, deletions, substitutions
+// and transpositions of adjacent letters each count as one edit
+func editDistance(a, b []rune) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
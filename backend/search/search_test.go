@@ -0,0 +1,129 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupIndex(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Books{}, &models.BookItem{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	// A BOOK FROM BEFORE THE INDEX EXISTED IS BACKFILLED
+	db.Create(&models.Books{ISBN: "9780306406157", LibID: 1, Title: "Go Programming", Authors: "John Doe", Publisher: "Tech Press", Version: "1st"})
+	if err := For(db).Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate search index: %v", err)
+	}
+	// MIGRATING TWICE IS HARMLESS
+	if err := For(db).Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate search index again: %v", err)
+	}
+
+	db.Create(&models.Books{ISBN: "9781617294549", LibID: 1, Title: "Rust in Action", Authors: "Tim McNamara", Publisher: "Manning", Version: "1st", Description: "Systems programming explained through Rust"})
+	db.Create(&models.Books{ISBN: "9781492071266", LibID: 1, Title: "Learning Go", Authors: "Jon Bodner", Publisher: "O'Reilly", Version: "1st"})
+	return db
+}
+
+func matching(t *testing.T, db *gorm.DB, text string) []string {
+	q, err := Prepare(db, 1, text)
+	assert.NoError(t, err)
+
+	engine := For(db)
+	var isbns []string
+	err = engine.Match(db.Model(&models.Books{}).Where("lib_id = ?", 1), q).
+		Order(engine.Rank(q)).Order("isbn ASC").Pluck("isbn", &isbns).Error
+	assert.NoError(t, err)
+	return isbns
+}
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, [][]string{{"go"}, {"o"}, {"reilly"}, {"2nd"}}, Parse(" Go, O'Reilly 2nd* ").Terms)
+	assert.True(t, Parse(`"*" -`).Empty())
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance([]rune("rust"), []rune("rust")))
+	assert.Equal(t, 1, editDistance([]rune("rsut"), []rune("rust")))
+	assert.Equal(t, 1, editDistance([]rune("progamming"), []rune("programming")))
+	assert.Equal(t, 3, editDistance([]rune("kitten"), []rune("sitting")))
+}
+
+func TestCorrections(t *testing.T) {
+	vocabulary := []string{"programming", "program", "rust", "action"}
+	assert.Equal(t, []string{"programming"}, corrections("progamming", vocabulary))
+	assert.Equal(t, []string{"rust"}, corrections("rsut", vocabulary))
+	// PREFIX OF AN INDEXED WORD NEEDS NO CORRECTION
+	assert.Nil(t, corrections("prog", vocabulary))
+	// TOO SHORT TO GUESS
+	assert.Nil(t, corrections("gp", vocabulary))
+}
+
+func TestSQLiteMatchAndRank(t *testing.T) {
+	db := setupIndex(t)
+
+	// TITLE MATCHES RANK ABOVE DESCRIPTION MATCHES
+	assert.Equal(t, []string{"9780306406157", "9781617294549"}, matching(t, db, "programming"))
+	assert.Equal(t, []string{"9781492071266"}, matching(t, db, "go learn"))
+	assert.Equal(t, []string{"9781617294549"}, matching(t, db, "mcnamara rust"))
+	assert.Equal(t, []string{"9781617294549"}, matching(t, db, "Rsut"))
+	assert.Empty(t, matching(t, db, "haskell"))
+
+	// UPDATES AND DELETES KEEP THE INDEX IN SYNC
+	db.Model(&models.Books{}).Where("isbn = ?", "9781492071266").Update("title", "Learning Haskell")
+	assert.Equal(t, []string{"9781492071266"}, matching(t, db, "haskell"))
+	db.Where("isbn = ?", "9781492071266").Delete(&models.Books{})
+	assert.Empty(t, matching(t, db, "haskell"))
+}
+
+func TestSQLiteVocabulary_ScopedToLibrary(t *testing.T) {
+	db := setupIndex(t)
+	db.Create(&models.Books{ISBN: "9781718500853", LibID: 2, Title: "Haskell Programming", Authors: "Chris Allen", Publisher: "Lorepub", Version: "1st"})
+
+	words, err := For(db).Vocabulary(db, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, words, "rust")
+	assert.NotContains(t, words, "haskell")
+
+	words, err = For(db).Vocabulary(db, 2)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"haskell", "programming", "chris", "allen", "lorepub"}, words)
+
+	// ANOTHER LIBRARY'S BOOKS DO NOT SUGGEST CORRECTIONS
+	q, err := Prepare(db, 1, "haskel")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"haskel"}}, q.Terms)
+}
+
+func TestSQLiteHighlight(t *testing.T) {
+	db := setupIndex(t)
+
+	q, _ := Prepare(db, 1, "rust programming")
+	highlights, err := For(db).Highlight(db, 1, []string{"9781617294549"}, q)
+	assert.NoError(t, err)
+	assert.Contains(t, highlights["9781617294549"].Title, "<mark>Rust</mark>")
+	assert.Contains(t, highlights["9781617294549"].Snippet, "<mark>programming</mark>")
+}
+
+func TestSQLiteHighlight_EscapesTheBookText(t *testing.T) {
+	db := setupIndex(t)
+	db.Create(&models.Books{ISBN: "9780000000002", LibID: 1, Title: "<script>alert(1)</script> & Rust", Authors: "A <b>Bold</b> Author", Publisher: "Press", Version: "1st"})
+
+	q, _ := Prepare(db, 1, "rust")
+	highlights, err := For(db).Highlight(db, 1, []string{"9780000000002"}, q)
+	assert.NoError(t, err)
+	assert.Equal(t, "&lt;script&gt;alert(1)&lt;/script&gt; &amp; <mark>Rust</mark>", highlights["9780000000002"].Title)
+	assert.Equal(t, "A &lt;b&gt;Bold&lt;/b&gt; Author", highlights["9780000000002"].Authors)
+}
+
+func TestMarkMatches(t *testing.T) {
+	assert.Equal(t, `<mark>O&#39;Reilly</mark> &lt;i&gt;`, markMatches(startMatch+"O'Reilly"+stopMatch+" <i>"))
+}
@@ -0,0 +1,155 @@
+package search
+
+import (
+	"database/sql"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Indexed columns of books_fts, in order
+var ftsColumns = []string{"title", "authors", "publisher", "description"}
+
+// Relevance weight of a match in each indexed column
+var ftsWeights = []int{8, 4, 2, 1}
+
+// books_fts mirrors the text of every books row under the same rowid. FTS5 is
+// used when the driver is built with it, FTS4 otherwise
+type sqliteEngine struct{}
+
+func isFTS5(db *gorm.DB) bool {
+	var sql string
+	db.Raw("SELECT sql FROM sqlite_master WHERE name = 'books_fts'").Scan(&sql)
+	return strings.Contains(strings.ToLower(sql), "fts5")
+}
+
+func (sqliteEngine) Migrate(db *gorm.DB) error {
+	columns := strings.Join(ftsColumns, ", ")
+
+	if !db.Migrator().HasTable("books_fts") {
+		err := db.Exec("CREATE VIRTUAL TABLE books_fts USING fts5(" + columns + ", tokenize = 'unicode61 remove_diacritics 2')").Error
+		if err != nil && strings.Contains(err.Error(), "no such module") {
+			err = db.Exec("CREATE VIRTUAL TABLE books_fts USING fts4(" + columns + ", tokenize=unicode61 \"remove_diacritics=2\")").Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	values := "new." + strings.Join(ftsColumns, ", new.")
+	statements := []string{
+		// VOCABULARY OF EVERY LIBRARY AT ONCE, NO LONGER USED
+		"DROP TABLE IF EXISTS books_fts_vocab",
+		"CREATE TRIGGER IF NOT EXISTS books_fts_insert AFTER INSERT ON books BEGIN " +
+			"INSERT INTO books_fts(rowid, " + columns + ") VALUES (new.rowid, " + values + "); END",
+		"CREATE TRIGGER IF NOT EXISTS books_fts_delete AFTER DELETE ON books BEGIN " +
+			"DELETE FROM books_fts WHERE rowid = old.rowid; END",
+		"CREATE TRIGGER IF NOT EXISTS books_fts_update AFTER UPDATE ON books BEGIN " +
+			"DELETE FROM books_fts WHERE rowid = old.rowid; " +
+			"INSERT INTO books_fts(rowid, " + columns + ") VALUES (new.rowid, " + values + "); END",
+		// BOOKS THAT EXISTED BEFORE THE INDEX
+		"INSERT INTO books_fts(rowid, " + columns + ") SELECT rowid, " + columns + " FROM books " +
+			"WHERE rowid NOT IN (SELECT rowid FROM books_fts)",
+	}
+	// THE WORDS OF EACH ROW, SO THE VOCABULARY CAN BE NARROWED TO A LIBRARY
+	if isFTS5(db) {
+		statements = append(statements, "CREATE VIRTUAL TABLE IF NOT EXISTS books_fts_instances USING fts5vocab(books_fts, 'instance')")
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Indexed words of the books of a library. FTS4 can not list the words of a
+// row, so there the text of the library's books is split the way queries are
+func (sqliteEngine) Vocabulary(db *gorm.DB, libID uint) ([]string, error) {
+	var words []string
+	if isFTS5(db) {
+		err := db.Raw("SELECT DISTINCT books_fts_instances.term FROM books_fts_instances "+
+			"JOIN books ON books.rowid = books_fts_instances.doc WHERE books.lib_id = ?", libID).Scan(&words).Error
+		return words, err
+	}
+
+	var texts []string
+	if err := db.Raw("SELECT "+strings.Join(ftsColumns, " || ' ' || ")+" FROM books WHERE lib_id = ?", libID).Scan(&texts).Error; err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, term := range Parse(text).Terms {
+			if !seen[term[0]] {
+				seen[term[0]] = true
+				words = append(words, term[0])
+			}
+		}
+	}
+	return words, nil
+}
+
+// Terms joined as "(go* OR og*) AND (programming*)", optionally limited to a column
+func matchExpression(q Query, column string) string {
+	prefix := ""
+	if column != "" {
+		prefix = column + ":"
+	}
+	groups := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		alternatives := make([]string, 0, len(term))
+		for _, word := range term {
+			alternatives = append(alternatives, prefix+word+"*")
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	return strings.Join(groups, " AND ")
+}
+
+func (sqliteEngine) Match(query *gorm.DB, q Query) *gorm.DB {
+	return query.Where("books.rowid IN (SELECT rowid FROM books_fts WHERE books_fts MATCH ?)", matchExpression(q, ""))
+}
+
+// FTS4 has no ranking function, so on both FTS versions books score the
+// weights of the columns the whole query matches in
+func (sqliteEngine) Rank(q Query) clause.Expression {
+	var parts []string
+	var vars []interface{}
+	for i, column := range ftsColumns {
+		parts = append(parts, "(books.rowid IN (SELECT rowid FROM books_fts WHERE books_fts MATCH ?)) * ?")
+		vars = append(vars, matchExpression(q, column), ftsWeights[i])
+	}
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                "(" + strings.Join(parts, " + ") + ") DESC",
+		Vars:               vars,
+		WithoutParentheses: true,
+	}}
+}
+
+func (sqliteEngine) Highlight(db *gorm.DB, libID uint, isbns []string, q Query) (map[string]Highlight, error) {
+	selects := "snippet(books_fts, @start, @stop, '…', 0, 64) AS title, " +
+		"snippet(books_fts, @start, @stop, '…', 1, 64) AS authors, " +
+		"snippet(books_fts, @start, @stop, '…', -1, 12) AS snippet"
+	if isFTS5(db) {
+		selects = "highlight(books_fts, 0, @start, @stop) AS title, " +
+			"highlight(books_fts, 1, @start, @stop) AS authors, " +
+			"snippet(books_fts, -1, @start, @stop, '…', 12) AS snippet"
+	}
+
+	var rows []struct {
+		ISBN string
+		Highlight
+	}
+	err := db.Raw("SELECT books.isbn, "+selects+" FROM books_fts JOIN books ON books.rowid = books_fts.rowid "+
+		"WHERE books_fts MATCH @match AND books.lib_id = @lib AND books.isbn IN @isbns",
+		sql.Named("start", startMatch), sql.Named("stop", stopMatch),
+		sql.Named("match", matchExpression(q, "")), sql.Named("lib", libID), sql.Named("isbns", isbns)).
+		Scan(&rows).Error
+
+	highlights := make(map[string]Highlight, len(rows))
+	for _, row := range rows {
+		highlights[row.ISBN] = row.Highlight.marked()
+	}
+	return highlights, err
+}
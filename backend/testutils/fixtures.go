@@ -0,0 +1,74 @@
+package testutils
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prabhatKr-1/lib-man-sys/backend/config"
+	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPassword is given to seeded users that do not set their own
+const DefaultPassword = "password123"
+
+// Seed holds the rows a handler test starts from. User passwords are plain text
+type Seed struct {
+	Libraries []models.Library
+	Users     []models.User
+}
+
+// Caller is who a route group acts as, in place of the auth middleware
+type Caller struct {
+	ID    uint
+	LibID uint
+	Email string
+	Role  string
+}
+
+// SetupRouter resets the test database, stores the seed with every password
+// hashed at the lowest bcrypt cost, and returns a router in gin's test mode
+func SetupRouter(seed Seed) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	SetupTestDB()
+
+	for _, library := range seed.Libraries {
+		if err := config.DB.Create(&library).Error; err != nil {
+			log.Fatalf("❌ Failed to seed library %d: %v", library.LibID, err)
+		}
+	}
+
+	hashes := map[string]string{}
+	for _, user := range seed.Users {
+		if user.Password == "" {
+			user.Password = DefaultPassword
+		}
+		if _, ok := hashes[user.Password]; !ok {
+			hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+			if err != nil {
+				log.Fatalf("❌ Failed to hash seed password: %v", err)
+			}
+			hashes[user.Password] = string(hash)
+		}
+		user.Password = hashes[user.Password]
+		if err := config.DB.Create(&user).Error; err != nil {
+			log.Fatalf("❌ Failed to seed user %s: %v", user.Email, err)
+		}
+	}
+	return gin.Default()
+}
+
+// AsCaller returns a route group whose handlers see the caller as logged in
+func AsCaller(router gin.IRouter, path string, caller Caller) *gin.RouterGroup {
+	return router.Group(path, func(c *gin.Context) {
+		c.Set("id", caller.ID)
+		c.Set("libid", caller.LibID)
+		if caller.Email != "" {
+			c.Set("email", caller.Email)
+		}
+		if caller.Role != "" {
+			c.Set("role", caller.Role)
+		}
+		c.Next()
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/prabhatKr-1/lib-man-sys/backend/config"
 	"github.com/prabhatKr-1/lib-man-sys/backend/models"
+	"github.com/prabhatKr-1/lib-man-sys/backend/search"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -24,14 +25,45 @@ func SetupTestDB() {
 	// Migrate tables
 	err = config.DB.AutoMigrate(
 		&models.Library{},
+		&models.Role{},
+		&models.RolePermission{},
 		&models.User{},
+		&models.Invitation{},
+		&models.APIKey{},
+		&models.APIKeyScope{},
+		&models.SSOConfig{},
+		&models.UserIdentity{},
+		&models.SSOLogin{},
+		&models.SigningKey{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordReset{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.MFAChallenge{},
+		&models.LoginThrottle{},
+		&models.PasswordPolicy{},
+		&models.PasswordHistory{},
 		&models.Books{},
+		&models.BookItem{},
+		&models.BookSubject{},
 		&models.IssueRegistry{},
 		&models.RequestEvents{},
+		&models.RequestTransition{},
+		&models.Hold{},
+		&models.FineEntry{},
+		&models.CirculationPolicy{},
+		&models.AuditEntry{},
 	)
 	if err != nil {
 		log.Fatalf("❌ Failed to migrate test database: %v", err)
 	}
+	if err = search.For(config.DB).Migrate(config.DB); err != nil {
+		log.Fatalf("❌ Failed to migrate search index: %v", err)
+	}
+	if err = config.ProtectAuditLog(config.DB); err != nil {
+		log.Fatalf("❌ Failed to protect the audit log: %v", err)
+	}
 
 	log.Println("✅ Test database migration successful")
 }
@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 APPENDIX B, SHA-1 SEED
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTP_RFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, hotp(rfcKey, Counter(time.Unix(unix, 0)), 8), "time %d", unix)
+	}
+}
+
+func TestCodeAndValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(rfcKey)
+	now := time.Unix(1234567890, 0)
+
+	code, err := Code(secret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "005924", code)
+
+	counter, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	// ONE STEP OF CLOCK DRIFT IS TOLERATED, TWO ARE NOT
+	_, ok = Validate(secret, code, now.Add(Period), 0)
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(2*Period), 0)
+	assert.False(t, ok)
+
+	// A USED STEP CAN NOT BE REPLAYED
+	_, ok = Validate(secret, code, now, counter)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	other, _ := GenerateSecret()
+	assert.NotEqual(t, secret, other)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "City Library", "owner@example.com")
+	assert.Equal(t, "otpauth://totp/City%20Library:owner@example.com?algorithm=SHA1&digits=6&issuer=City+Library&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	valid := map[string]string{
+		"9780306406157":     "9780306406157",
+		"978-0-306-40615-7": "9780306406157",
+		"0306406152":        "9780306406157",
+		"0-306-40615-2":     "9780306406157",
+		"080442957X":        "9780804429573",
+		"080442957x":        "9780804429573",
+		"9791234567896":     "9791234567896",
+	}
+	for input, expected := range valid {
+		isbn, err := NormalizeISBN(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, isbn, input)
+	}
+
+	for _, input := range []string{"", "123456", "0306406153", "9780306406158", "978030640615X", "X306406152"} {
+		_, err := NormalizeISBN(input)
+		assert.ErrorIs(t, err, ErrInvalidISBN, input)
+	}
+}
@@ -1,45 +1,137 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"math"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/prabhatKr-1/lib-man-sys/backend/keyring"
 )
 
+// Access tokens are short lived, refresh tokens renew them until the session ends
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// The session of a token was logged out, revoked or outlived its user's role
+var ErrSessionRevoked = errors.New("session revoked")
+
+// The user of a token has been deactivated
+var ErrAccountDeactivated = errors.New("account deactivated")
+
+// API keys carry this prefix, so a bearer token is known to be one before lookup
+const APIKeyPrefix = "lms_"
+
+// The API key is unknown, revoked or past its expiry
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
 type JWTValidatorFunc func(token string) (uint, uint, string, string, error)
 
-func GenerateJWT(id uint, LibID uint, email, role string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": email,
-		"role":  role,
-		"id":    id,
-		"libid": LibID,
-		"exp":   time.Now().Add(time.Hour * 72).Unix(),
-	})
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+// Keys access tokens are signed with. main opens the database-backed ring;
+// until then tokens are signed with a key kept in memory
+var Keys = keyring.NewEphemeral(keyring.EdDSA, keyring.Schedule{
+	Lifetime: 30 * 24 * time.Hour,
+	Overlap:  AccessTokenTTL,
+})
+
+// Claims of an access token
+type Claims struct {
+	UserID    uint   `json:"id"`
+	LibID     uint   `json:"libid"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
+	jwt.RegisteredClaims
 }
 
-func ValidateJWT(tokenString string) (id uint, LibID uint, email, role string, err error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+// Called by the parser after the registered claims check out
+func (c Claims) Validate() error {
+	if c.UserID == 0 || c.LibID == 0 || c.SessionID == 0 || c.Email == "" || c.Role == "" {
+		return jwt.ErrTokenInvalidClaims
+	}
+	return nil
+}
+
+// Name tokens are issued under, so other services can tell ours apart
+func tokenIssuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "lib-man-sys"
+}
+
+func GenerateJWT(id uint, LibID uint, email, role string, sessionID uint) (string, error) {
+	now := time.Now()
+	key, err := Keys.Signing(now)
+	if err != nil {
+		return "", err
+	}
+	return SignJWT(key, Claims{
+		UserID:    id,
+		LibID:     LibID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer(),
+			Subject:   strconv.FormatUint(uint64(id), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
 	})
+}
 
+// Signs claims as they are with the key, naming it in the kid header
+func SignJWT(key *keyring.Key, claims Claims) (string, error) {
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private())
+}
+
+// Claims of a signed, unexpired token. Expired tokens fail with an error
+// wrapping jwt.ErrTokenExpired
+func ParseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, Keys.Keyfunc,
+		jwt.WithValidMethods(keyring.Algorithms),
+		jwt.WithIssuer(tokenIssuer()),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return math.MaxUint64, math.MaxUint64, "", "", err
+		return nil, err
 	}
+	return claims, nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		email = claims["email"].(string)
-		role = claims["role"].(string)
-		floatId := claims["id"].(float64)
-		floatLibId := claims["libid"].(float64)
+// Checks the token alone. Routes use a validator that also checks the
+// session, see middleware.ValidateSession
+func ValidateJWT(tokenString string) (id uint, LibID uint, email, role string, err error) {
+	claims, err := ParseJWT(tokenString)
+	if err != nil {
+		return math.MaxUint64, math.MaxUint64, "", "", err
+	}
+	return claims.UserID, claims.LibID, claims.Email, claims.Role, nil
+}
 
-		id = uint(floatId)
-		LibID = uint(floatLibId)
-		return id, LibID, email, role, nil
+// Random URL-safe token to hand out, and the hash to store in its place
+func NewOpaqueToken() (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
 	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
 
-	return math.MaxUint64, math.MaxUint64, "", "", jwt.ErrTokenInvalidClaims
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }